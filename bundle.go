@@ -1,20 +1,25 @@
 package mirror
 
 import (
-	"errors"
 	"github.com/petomalina/mirror/pkg/bundle"
 	"github.com/petomalina/mirror/pkg/plugins"
-	"github.com/sirupsen/logrus"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 	"golang.org/x/tools/go/packages"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 
 	. "github.com/petomalina/mirror/pkg/logger"
 )
 
-// RunFunc is a callback that will be called when the app bootstrap finishes
+// RunFunc is a callback that will be called when the app bootstrap finishes.
+// It is called once for each out directory with the models of all packages
+// generated into it, see runPackages
 type RunFunc func(StructSlice, *Writer, *packages.Package) error
 
 // Writer is an alias for the underlying bundle.Writer type, hidden with its implementation details
@@ -34,7 +39,7 @@ func CreateDefaultApp(name string, runFunc RunFunc) *cli.App {
 		cli.StringFlag{
 			Name:  "pkg, p",
 			Value: ".",
-			Usage: "Package to be used for model determination",
+			Usage: "Package or package pattern (e.g. ./models/...) to be used for model determination",
 		},
 		cli.StringSliceFlag{
 			Name:   "models, m",
@@ -46,12 +51,52 @@ func CreateDefaultApp(name string, runFunc RunFunc) *cli.App {
 			Value: ".",
 			Usage: "Directory for the generated files to be saved in",
 		},
+		cli.BoolFlag{
+			Name:  "outRelative, r",
+			Usage: "Resolves the out directory relative to each source package instead of using one destination",
+		},
 		cli.StringFlag{
 			Name:   "verbosity, v",
 			Value:  "info",
 			Usage:  "Sets the logging level for the bundle",
 			EnvVar: "MIRROR_LOG_LEVEL",
 		},
+		cli.StringSliceFlag{
+			Name:   "logLevels",
+			Usage:  "Levels of the log subsystems (" + strings.Join(Subsystems(), ", ") + "), e.g. loader=debug",
+			EnvVar: "MIRROR_LOG_LEVELS",
+		},
+		cli.StringFlag{
+			Name:   "logFormat",
+			Value:  FormatText,
+			Usage:  "Format of the logs, either text or json",
+			EnvVar: "MIRROR_LOG_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "logOutput",
+			Value:  "stdout",
+			Usage:  "Output of the logs, either stdout, stderr or a path of a file",
+			EnvVar: "MIRROR_LOG_OUTPUT",
+		},
+		cli.StringSliceFlag{
+			Name:   "tags, t",
+			Usage:  "Build tags used when loading and building the package",
+			EnvVar: "MIRROR_TAGS",
+		},
+		cli.StringSliceFlag{
+			Name:   "buildFlags",
+			Usage:  "Additional flags passed to the go tool, e.g. -mod=vendor",
+			EnvVar: "MIRROR_BUILD_FLAGS",
+		},
+		cli.StringSliceFlag{
+			Name:  "env, e",
+			Usage: "Environment overrides (KEY=VALUE) for the go tool, e.g. CGO_ENABLED=1",
+		},
+		cli.StringFlag{
+			Name:   "go",
+			Usage:  "Path to the go binary used to load and build the package",
+			EnvVar: "MIRROR_GO",
+		},
 		cli.BoolFlag{
 			Name:  "generateSymbols, x",
 			Usage: "(experimental) Defines if symbols should be generated automatically or not",
@@ -60,115 +105,419 @@ func CreateDefaultApp(name string, runFunc RunFunc) *cli.App {
 			Name:  "preserveCache, c",
 			Usage: "(experimental) Preserves the cache after the build for further examination",
 		},
+		cli.BoolFlag{
+			Name:  "isolated, i",
+			Usage: "(experimental) Describes the models using a helper executable instead of loading them as a plugin",
+		},
+		cli.BoolFlag{
+			Name:  "noBuildCache",
+			Usage: "Always rebuilds the plugin instead of reusing the one built from unchanged sources",
+		},
+		cli.Int64Flag{
+			Name:  "cacheMaxSize",
+			Usage: "Size limit of the build cache in megabytes",
+			Value: plugins.DefaultCacheMaxSize / 1024 / 1024,
+		},
+		cli.DurationFlag{
+			Name:  "cacheMaxAge",
+			Usage: "Duration after which unused plugins are pruned from the build cache",
+			Value: plugins.DefaultCacheMaxAge,
+		},
 		cli.BoolFlag{
 			Name:  "watch, w",
 			Usage: "(experimental) Watches for file changes in the input directory and triggers the generator",
 		},
+		cli.DurationFlag{
+			Name:  "watchDebounce",
+			Usage: "Quiet period after the last change before the generator is triggered",
+			Value: plugins.DefaultWatchDebounce,
+		},
+		cli.DurationFlag{
+			Name:  "watchMaxWait",
+			Usage: "Longest time the generator is held back while changes keep coming",
+			Value: plugins.DefaultWatchMaxWait,
+		},
+		cli.StringSliceFlag{
+			Name:  "watchIgnore",
+			Usage: "Glob patterns of paths ignored by the watch, patterns prefixed with ! list the only watched files",
+			Value: &cli.StringSlice{},
+		},
 	}
-	app.Action = func(c *cli.Context) error {
-		logLevel, err := logrus.ParseLevel(c.String("verbosity"))
+	app.Before = func(c *cli.Context) error {
+		levels, err := ParseLevels(c.StringSlice("logLevels"))
+		if err != nil {
+			return err
+		}
+
+		err = L.Configure(Options{
+			Format: c.String("logFormat"),
+			Output: c.String("logOutput"),
+			Level:  c.String("verbosity"),
+			Levels: levels,
+		})
 		if err != nil {
 			L.
 				Method("Bundle", "CreateDefaultApp").
-				Errorln("An error occurred when parsing log level: ", err.Error())
+				Errorln("An error occurred when configuring the logger: ", err.Error())
 			return err
 		}
-		L.SetLevel(logLevel)
 
-		// validate the generateSymbols flag, so we can warn the user beforehand
-		if c.Bool("generateSymbols") {
-			if len(c.StringSlice("models")) == 0 {
-				return errors.New("can't use generateSymbols (-x) without specifying models")
-			}
-
-			if len(c.StringSlice("models")) == 1 && c.StringSlice("models")[0] == "all" {
-				return errors.New("using 'all' with generateSymbols (-x) is forbidden - can't find models")
-			}
+		if gg, ok := LookupGoGenerate(); ok {
+			return defaultGoGenerate(c, gg)
 		}
 
-		pkg, err := plugins.FindPackage(c.String("pkg"))
+		return nil
+	}
+	app.Action = func(c *cli.Context) error {
+		loader, err := newLoader(c)
 		if err != nil {
 			return err
 		}
 
-		loader := plugins.Loader{
-			TargetPath:      c.String("pkg"),
-			GenerateSymbols: c.Bool("generateSymbols"),
-			PreserveCache:   c.Bool("preserveCache"),
-		}
-
 		// one-shot load
 		if !c.Bool("watch") {
-			models, err := loader.Load(c.StringSlice("models"))
-
+			pkgSyms, err := loader.LoadPackages(c.StringSlice("models"))
 			if err != nil {
 				L.
 					Method("Bundle", "CreateDefaultApp").
 					Errorln("An error occurred when running the generator: ", err.Error())
+				return err
 			}
 
-			return runFunc(
-				ReflectStructs(models...).Each(func(s *Struct) {
-					s.OriginalPackage = pkg.PkgPath
-				}),
-				bundle.NewWriter(c.String("out")),
-				pkg,
-			)
-		} else { // watch for changes
-			done := make(chan bool)
-			modelsChan, errChan := loader.Watch(c.StringSlice("models"), done)
-
-			// create a channel for notifications from the console
-			sigs := make(chan os.Signal, 1)
-			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			_, err = runPackages(runFunc, pkgSyms, c.String("out"), c.Bool("outRelative"), nil)
+			return err
+		}
 
-			L.
-				Method("Bundle", "CreateDefaultApp").
-				Info("Starting fsnotify to watch and rebuild")
-
-		watchLoop:
-			for {
-				select {
-				case models, ok := <-modelsChan:
-					if !ok {
-						break watchLoop
-					}
+		return runWatch(runFunc, loader, c.StringSlice("models"), c.String("out"), c.Bool("outRelative"))
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:      "serve",
+			Usage:     "Keeps the models loaded and regenerates on changes, controlled through a local API",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "addr, a",
+					Value:  DefaultServeAddr,
+					Usage:  "Address of the API, either a loopback host:port or unix:<path> for a unix socket",
+					EnvVar: "MIRROR_SERVE_ADDR",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				// the generator flags are set before the command
+				global := c.Parent()
+
+				loader, err := newLoader(global)
+				if err != nil {
+					return err
+				}
+
+				server := &Server{
+					Loader:      loader,
+					Models:      global.StringSlice("models"),
+					RunFunc:     runFunc,
+					Out:         global.String("out"),
+					OutRelative: global.Bool("outRelative"),
+				}
+
+				return server.ListenAndServe(c.String("addr"))
+			},
+		},
+	}
+
+	return app
+}
 
-					err := runFunc(
-						ReflectStructs(models...).Each(func(s *Struct) {
-							s.OriginalPackage = pkg.PkgPath
-						}),
-						bundle.NewWriter(c.String("out")),
-						pkg,
-					)
+// defaultGoGenerate defaults the --pkg and --out flags to the directory of the
+// invoking go:generate directive and the models to the types declared after it.
+// ErrNoModelAfterDirective is returned only when no models are set otherwise
+func defaultGoGenerate(c *cli.Context, gg *GoGenerate) error {
+	dir, err := gg.Dir()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []string{"pkg", "out"} {
+		if c.IsSet(name) {
+			continue
+		}
+
+		L.
+			Method("Bundle", "CreateDefaultApp").
+			Debugln("Using ", name, " inferred from go:generate: ", dir)
+		err = c.Set(name, dir)
+		if err != nil {
+			return err
+		}
+	}
 
-					if err != nil {
-						L.
-							Method("Bundle", "CreateDefaultApp").
-							Errorln("An error occurred when running the generator: ", err.Error())
+	if len(c.StringSlice("models")) > 0 {
+		return nil
+	}
+
+	models, err := gg.ModelsAfterDirective()
+	if err != nil {
+		return err
+	}
+
+	L.
+		Method("Bundle", "CreateDefaultApp").
+		Debugln("Using models inferred from go:generate: ", models)
+	for _, m := range models {
+		err = c.Set("models", m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-						done <- true
+// newLoader creates the loader configured by the flags of the app
+func newLoader(c *cli.Context) (*plugins.Loader, error) {
+	// validate the generateSymbols flag, so we can warn the user beforehand
+	if c.Bool("generateSymbols") {
+		if len(c.StringSlice("models")) == 0 {
+			return nil, errors.New("can't use generateSymbols (-x) without specifying models")
+		}
+
+		if len(c.StringSlice("models")) == 1 && c.StringSlice("models")[0] == "all" {
+			return nil, errors.New("using 'all' with generateSymbols (-x) is forbidden - can't find models")
+		}
+	}
+
+	// the default patterns are used unless some are set
+	var ignore []string
+	if patterns := c.StringSlice("watchIgnore"); len(patterns) > 0 {
+		ignore = patterns
+	}
+
+	return &plugins.Loader{
+		TargetPath:        c.String("pkg"),
+		GenerateSymbols:   c.Bool("generateSymbols"),
+		PreserveCache:     c.Bool("preserveCache"),
+		Isolated:          c.Bool("isolated"),
+		DisableBuildCache: c.Bool("noBuildCache"),
+		CacheMaxSize:      c.Int64("cacheMaxSize") * 1024 * 1024,
+		CacheMaxAge:       c.Duration("cacheMaxAge"),
+		WatchIgnore:       ignore,
+		WatchIgnoreFiles:  &plugins.IgnoredFiles{},
+		WatchDebounce:     c.Duration("watchDebounce"),
+		WatchMaxWait:      c.Duration("watchMaxWait"),
+		BuildConfig: plugins.BuildConfig{
+			Tags:     c.StringSlice("tags"),
+			Flags:    c.StringSlice("buildFlags"),
+			Env:      c.StringSlice("env"),
+			GoBinary: c.String("go"),
+		},
+	}, nil
+}
+
+// runWatch runs the generator on every change until a signal is captured.
+// Failed iterations are reported and the watch continues, only failures
+// of the watcher itself stop it
+func runWatch(runFunc RunFunc, loader *plugins.Loader, models []string, out string, outRelative bool) error {
+	done := make(chan bool)
+	batches, errChan := loader.Watch(models, done)
+
+	// create a channel for notifications from the console
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	L.
+		Method("Bundle", "runWatch").
+		Info("Starting fsnotify to watch and rebuild")
+
+	// stop signals the watcher to stop watching for changes
+	stopped := false
+	stop := func() {
+		if !stopped {
+			stopped = true
+			close(done)
+		}
+	}
+	defer stop()
+
+	// generated are the files of the last successful generation
+	var generated []string
+	for {
+		select {
+		case batch, ok := <-batches:
+			if !ok {
+				// the watcher may have stopped because of a failure
+				for err := range errChan {
+					if _, recoverable := err.(*plugins.WatchError); !recoverable {
 						return err
 					}
+				}
+				return nil
+			}
 
-				case err := <-errChan:
-					done <- true
-					return err
+			started := time.Now()
+			files, err := runPackages(runFunc, batch.Packages, out, outRelative, generated)
+			if err == nil {
+				generated = files
+				ignoreGenerated(loader, files)
+			}
 
-				case <-sigs:
-					L.
-						Method("Bundle", "CreateDefaultApp").
-						Infoln("Captured exit signal, signaling watcher to stop")
-					// signal the watcher to stop watching for changes
-					done <- true
-				}
+			entry := L.
+				Method("Bundle", "runWatch").
+				WithFields(Fields{
+					"Changed":    len(batch.ChangedFiles),
+					"Load":       batch.Duration,
+					"Generation": time.Since(started),
+				})
+			if err != nil {
+				entry.Errorln("Generation failed, waiting for changes: ", err.Error())
+				break
+			}
+			entry.Infoln("Generation succeeded, changed files: ", batch.ChangedFiles)
+
+		case err, ok := <-errChan:
+			// both channels are closed at once when the watcher stops
+			if !ok {
+				return nil
 			}
+
+			watchErr, recoverable := err.(*plugins.WatchError)
+			if !recoverable {
+				L.
+					Method("Bundle", "runWatch").
+					Errorln("The watcher failed: ", err.Error())
+				return err
+			}
+
+			L.
+				Method("Bundle", "runWatch").
+				WithFields(Fields{
+					"Changed": len(watchErr.ChangedFiles),
+					"Load":    watchErr.Duration,
+				}).
+				Errorln("Loading failed, waiting for changes: ", watchErr.Error())
+
+		case <-sigs:
+			L.
+				Method("Bundle", "runWatch").
+				Infoln("Captured exit signal, signaling watcher to stop")
+			stop()
 		}
+	}
+}
 
-		return nil
+// runPackages calls the runFunc once for each out directory and returns paths
+// of the files created through the writers. The out directory is either shared
+// by all packages or resolved relative to each of them. Packages generated into
+// the same directory are passed to a single call, so the files of the directory
+// are generated at once from the models of all of them. The previous files
+// that were not generated again, e.g. of removed models, are removed
+func runPackages(runFunc RunFunc, pkgSyms []*plugins.PackageSymbols, out string, outRelative bool, previous []string) ([]string, error) {
+	dests, err := destinations(pkgSyms, out, outRelative)
+	if err != nil {
+		return nil, err
 	}
 
-	return app
+	files := []string{}
+	for _, d := range dests {
+		writer := bundle.NewWriter(d.dir)
+
+		err := runFunc(d.models, writer, d.pkg)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, writer.Paths()...)
+	}
+	sort.Strings(files)
+
+	if err := removeStale(previous, files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// removeStale removes the previous files which are not among the generated files
+func removeStale(previous, files []string) error {
+	generated := map[string]bool{}
+	for _, f := range files {
+		generated[f] = true
+	}
+
+	for _, f := range previous {
+		if generated[f] {
+			continue
+		}
+
+		if err := bundle.Remove(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// destination is an out directory with the models generated into it
+type destination struct {
+	dir    string
+	models StructSlice
+
+	// pkg is the package of the directory if it's one of the loaded
+	// packages, the first package generated into it otherwise
+	pkg *packages.Package
+}
+
+// destinations groups the models of the packages by their out directories
+// in the order of the packages. Absolute out directories are never resolved
+// relative to the packages
+func destinations(pkgSyms []*plugins.PackageSymbols, out string, outRelative bool) ([]*destination, error) {
+	dests := []*destination{}
+	byDir := map[string]*destination{}
+
+	for _, ps := range pkgSyms {
+		pkg := ps.Package
+
+		dir := out
+		if outRelative && !filepath.IsAbs(out) {
+			dir = filepath.Join(plugins.PackageDir(pkg), out)
+		}
+
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		d, ok := byDir[abs]
+		if !ok {
+			d = &destination{dir: dir, pkg: pkg}
+			byDir[abs] = d
+			dests = append(dests, d)
+		}
+		if sameDir(dir, plugins.PackageDir(pkg)) {
+			d.pkg = pkg
+		}
+
+		d.models = append(d.models, ReflectStructs(ps.Symbols...).Each(func(s *Struct) {
+			s.OriginalPackage = pkg.PkgPath
+			s.OriginalPackageName = pkg.Name
+		})...)
+	}
+
+	return dests, nil
+}
+
+// ignoreGenerated makes the watch of the loader ignore the generated files,
+// so they don't trigger the generator again. The files are ignored by their
+// paths, as the out dir may be the directory of the models
+func ignoreGenerated(loader *plugins.Loader, files []string) {
+	if loader.WatchIgnoreFiles == nil {
+		return
+	}
+
+	err := loader.WatchIgnoreFiles.Set(files)
+	if err != nil {
+		L.Method("Bundle", "ignoreGenerated").Warnln("Failed to ignore the generated files: ", err.Error())
+	}
 }
 
 // RunDefaultApp will automatically run the defaultly bundled application
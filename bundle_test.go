@@ -0,0 +1,171 @@
+package mirror
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const BundleTestDir = ".testbundle"
+
+type bundleOrder struct{}
+
+type bundleInvoice struct{}
+
+type BundleSuite struct {
+	suite.Suite
+}
+
+type RunPackagesCandidate struct {
+	name        string
+	out         string
+	outRelative bool
+
+	// calls are the dirs of the runFunc calls with the names of their models and package
+	calls []runPackagesCall
+	files []string
+}
+
+type runPackagesCall struct {
+	dir    string
+	models string
+	pkg    string
+}
+
+func (s *BundleSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(BundleTestDir))
+}
+
+// pkgSyms returns the orders and invoices packages, each with a single model
+func (s *BundleSuite) pkgSyms() []*plugins.PackageSymbols {
+	pkg := func(name string) *packages.Package {
+		return &packages.Package{
+			Name:    name,
+			PkgPath: "example.com/" + name,
+			GoFiles: []string{filepath.Join(BundleTestDir, name, "model.go")},
+		}
+	}
+
+	return []*plugins.PackageSymbols{
+		{Package: pkg("orders"), Symbols: []interface{}{&bundleOrder{}}},
+		{Package: pkg("invoices"), Symbols: []interface{}{&bundleInvoice{}}},
+	}
+}
+
+func (s *BundleSuite) TestRunPackages() {
+	abs, err := filepath.Abs(filepath.Join(BundleTestDir, "gen"))
+	s.NoError(err)
+
+	candidates := []RunPackagesCandidate{
+		{
+			name: "Generate all packages at once into the shared out dir",
+			out:  filepath.Join(BundleTestDir, "gen"),
+			calls: []runPackagesCall{
+				{dir: filepath.Join(BundleTestDir, "gen"), models: "bundleOrder bundleInvoice", pkg: "orders"},
+			},
+			files: []string{filepath.Join(BundleTestDir, "gen", "models.txt")},
+		},
+		{
+			name: "Pass the package of the out dir with the models of all packages",
+			out:  filepath.Join(BundleTestDir, "invoices"),
+			calls: []runPackagesCall{
+				{dir: filepath.Join(BundleTestDir, "invoices"), models: "bundleOrder bundleInvoice", pkg: "invoices"},
+			},
+			files: []string{filepath.Join(BundleTestDir, "invoices", "models.txt")},
+		},
+		{
+			name:        "Generate each package into its relative out dir",
+			out:         "gen",
+			outRelative: true,
+			calls: []runPackagesCall{
+				{dir: filepath.Join(BundleTestDir, "orders", "gen"), models: "bundleOrder", pkg: "orders"},
+				{dir: filepath.Join(BundleTestDir, "invoices", "gen"), models: "bundleInvoice", pkg: "invoices"},
+			},
+			files: []string{
+				filepath.Join(BundleTestDir, "invoices", "gen", "models.txt"),
+				filepath.Join(BundleTestDir, "orders", "gen", "models.txt"),
+			},
+		},
+		{
+			name:        "Generate into the absolute out dir regardless of the packages",
+			out:         abs,
+			outRelative: true,
+			calls: []runPackagesCall{
+				{dir: abs, models: "bundleOrder bundleInvoice", pkg: "orders"},
+			},
+			files: []string{filepath.Join(abs, "models.txt")},
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+		s.NoError(os.RemoveAll(BundleTestDir))
+
+		calls := []runPackagesCall{}
+		runFunc := func(models StructSlice, out *Writer, pkg *packages.Package) error {
+			names := ""
+			for i, m := range models {
+				if i > 0 {
+					names += " "
+				}
+				names += m.Name()
+			}
+			calls = append(calls, runPackagesCall{dir: out.Dir(), models: names, pkg: pkg.Name})
+
+			return generateNames(models, out, pkg)
+		}
+
+		files, err := runPackages(runFunc, s.pkgSyms(), c.out, c.outRelative, nil)
+		s.NoError(err)
+		s.EqualValues(c.calls, calls)
+		s.EqualValues(c.files, files)
+	}
+}
+
+func (s *BundleSuite) TestRunPackagesSharedFile() {
+	out := filepath.Join(BundleTestDir, "gen")
+
+	// repeated runs rewrite the file of the shared dir instead of appending to it
+	for i := 0; i < 2; i++ {
+		_, err := runPackages(generateNames, s.pkgSyms(), out, false, nil)
+		s.NoError(err)
+	}
+
+	bb, err := ioutil.ReadFile(filepath.Join(out, "models.txt"))
+	s.NoError(err)
+	s.EqualValues("package gen\n\n// bundleOrder\n// bundleInvoice\n", string(bb))
+}
+
+func (s *BundleSuite) TestRunPackagesRemoveStale() {
+	out := filepath.Join(BundleTestDir, "gen")
+	stale := filepath.Join(out, "stale.txt")
+	kept := filepath.Join(out, "kept.txt")
+
+	for _, f := range []string{stale, kept} {
+		s.NoError(os.MkdirAll(out, os.ModePerm))
+		s.NoError(ioutil.WriteFile(f, []byte("generated\n"), 0644))
+	}
+
+	runFunc := func(models StructSlice, w *Writer, pkg *packages.Package) error {
+		w.Keep("kept.txt")
+		return generateNames(models, w, pkg)
+	}
+
+	files, err := runPackages(runFunc, s.pkgSyms(), out, false, []string{stale, kept})
+	s.NoError(err)
+	s.EqualValues([]string{kept, filepath.Join(out, "models.txt")}, files)
+
+	_, err = os.Stat(stale)
+	s.True(os.IsNotExist(err))
+	_, err = os.Stat(kept)
+	s.NoError(err)
+}
+
+func TestBundleSuite(t *testing.T) {
+	suite.Run(t, &BundleSuite{})
+}
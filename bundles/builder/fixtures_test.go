@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+type Base struct {
+	ID string `builder:"required"`
+}
+
+type User struct {
+	Base
+
+	Name    string
+	Email   string        `builder:"required"`
+	Timeout time.Duration `default:"30s"`
+	Retries int           `default:"3"`
+	Build   string
+	Secret  string `builder:"-"`
+
+	password string
+}
+
+func (u *User) Validate() error {
+	if u.Name == "invalid" {
+		return errors.New("invalid name")
+	}
+
+	return nil
+}
+
+type Options struct {
+	Verbose bool
+}
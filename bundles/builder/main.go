@@ -0,0 +1,199 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+	"log"
+	"reflect"
+	"text/template"
+)
+
+// TagKey is the key of the struct tag with builder options, builder:"required"
+// makes the field required by the Build and builder:"-" skips the field
+const TagKey = "builder"
+
+// DefaultTagKey is the key of the struct tag with the default value
+// of the field, e.g. default:"30s"
+const DefaultTagKey = "default"
+
+// reserved are the methods of the builder that can't be used as setters,
+// fields with these names get setters with the With prefix
+var reserved = map[string]bool{
+	"Build":    true,
+	"Validate": true,
+}
+
+var builderTemplate = template.Must(template.New("builder").Parse(`
+// {{ .Name }}Builder builds {{ .Type }} step by step
+type {{ .Name }}Builder struct {
+	model {{ .Type }}
+	hooks []func(*{{ .Type }}) error
+{{- range .Fields }}{{ if .Required }}
+	{{ .Flag }} bool
+{{- end }}{{ end }}
+}
+
+// New{{ .Name }}Builder creates a builder with the default values set
+func New{{ .Name }}Builder() *{{ .Name }}Builder {
+	b := &{{ .Name }}Builder{}
+{{- range .Fields }}{{ if .Default }}
+	b.model.{{ .Name }} = {{ .Default }}
+{{- end }}{{ end }}
+
+	return b
+}
+{{ range .Fields }}
+// {{ .Setter }} sets the {{ .Name }} of the {{ $.Name }}
+func (b *{{ $.Name }}Builder) {{ .Setter }}(x {{ .Type }}) *{{ $.Name }}Builder {
+	b.model.{{ .Name }} = x
+{{- if .Required }}
+	b.{{ .Flag }} = true
+{{- end }}
+
+	return b
+}
+{{ end }}
+// Validate adds the hook validating the model before it is built
+func (b *{{ .Name }}Builder) Validate(hook func(*{{ .Type }}) error) *{{ .Name }}Builder {
+	b.hooks = append(b.hooks, hook)
+	return b
+}
+
+// Build returns the built model, or an error if a required field
+// was not set or the model is not valid
+func (b *{{ .Name }}Builder) Build() (*{{ .Type }}, error) {
+{{- if .Required }}
+	missing := []string{}
+{{- range .Fields }}{{ if .Required }}
+	if !b.{{ .Flag }} {
+		missing = append(missing, "{{ .Name }}")
+	}
+{{- end }}{{ end }}
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("{{ .Name }}Builder: missing required fields %s", strings.Join(missing, ", "))
+	}
+{{ end }}
+	m := b.model
+	for _, hook := range b.hooks {
+		if err := hook(&m); err != nil {
+			return nil, err
+		}
+	}
+{{- if .Validator }}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+{{- end }}
+
+	return &m, nil
+}
+`))
+
+type templateData struct {
+	Name string
+	Type string
+
+	// Validator is true if the model has the Validate() error method
+	Validator bool
+
+	// Required is true if any of the fields is required
+	Required bool
+
+	Fields []fieldData
+}
+
+type fieldData struct {
+	Name   string
+	Type   string
+	Setter string
+
+	Required bool
+	Flag     string
+
+	// Default is the Go expression of the default value, if any
+	Default string
+}
+
+func main() {
+	if err := mirror.RunDefaultApp("mirror-builder", ProcessModel); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the builder for each model. Setters are generated for
+// the exported fields, including the ones promoted from embedded structs
+func ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
+	temp := out.File("builder.go")
+	q := mirror.OutQualifier(out, pkg)
+
+	for _, rs := range models {
+		if q(rs.PkgPath(), rs.PackageName()) != "" {
+			temp.AddImports(rs.PkgPath())
+		}
+
+		data := &templateData{
+			Name:      rs.Name(),
+			Type:      rs.QualifiedName(q),
+			Validator: hasValidator(rs),
+		}
+
+		for _, f := range rs.PromotedFields() {
+			if !f.Exported() || f.HasTagOption(TagKey, "-") {
+				continue
+			}
+
+			fd := fieldData{
+				Name:     f.Field.Name,
+				Type:     rs.TypeString(f.Typ, q),
+				Setter:   f.Field.Name,
+				Required: f.HasTagOption(TagKey, "required"),
+				Flag:     "has" + f.Field.Name,
+			}
+			if reserved[fd.Setter] {
+				fd.Setter = "With" + fd.Setter
+			}
+
+			if value, ok := f.Field.Tag.Lookup(DefaultTagKey); ok {
+				lit, err := rs.Literal(f.Typ, value, q)
+				if err != nil {
+					return errors.Wrapf(err, "default of %s.%s", rs.Name(), f.Field.Name)
+				}
+				fd.Default = lit
+			}
+
+			temp.AddImports(rs.TypeImports(f.Typ, q)...)
+			data.Fields = append(data.Fields, fd)
+			data.Required = data.Required || fd.Required
+		}
+
+		// only the check of the required fields uses these
+		if data.Required {
+			temp.AddImports("fmt", "strings")
+		}
+
+		if err := temp.AddTemplate(builderTemplate, data); err != nil {
+			return err
+		}
+	}
+
+	return temp.Write()
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// hasValidator returns true if the model has the Validate() error method
+func hasValidator(rs *mirror.Struct) bool {
+	m, ok := reflect.PtrTo(rs.Type()).MethodByName("Validate")
+	if !ok {
+		return false
+	}
+
+	// the receiver is the first argument of the method
+	return m.Type.NumIn() == 1 && m.Type.NumOut() == 1 && m.Type.Out(0) == errorType
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// usageSource uses the builder generated into another package
+const usageSource = `func TestBuilder(t *testing.T) {
+	u, err := NewUserBuilder().ID("1").Name("Peter").Email("peter@x.io").WithBuild("b").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.ID != "1" || u.Name != "Peter" || u.Build != "b" || u.Timeout != 30*time.Second || u.Retries != 3 {
+		t.Fatal("Build", u)
+	}
+
+	_, err = NewUserBuilder().Name("Peter").Build()
+	if err == nil || !strings.Contains(err.Error(), "ID, Email") {
+		t.Fatal("Required", err)
+	}
+
+	_, err = NewUserBuilder().ID("1").Email("x").Name("invalid").Build()
+	if err == nil {
+		t.Fatal("Validate method")
+	}
+
+	_, err = NewUserBuilder().ID("1").Email("x").Validate(func(u *user.User) error {
+		return fmt.Errorf("hook")
+	}).Build()
+	if err == nil || err.Error() != "hook" {
+		t.Fatal("Validate hook", err)
+	}
+}
+`
+
+type BuilderSuite struct {
+	suite.Suite
+}
+
+func (s *BuilderSuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *BuilderSuite) TestProcessModel() {
+	outDir := bundletest.Dir("builder")
+	s.NoError(bundletest.WriteModule("1.16"))
+	s.NoError(bundletest.WritePackage("user", "fixtures_test.go"))
+
+	usage := bundle.NewWriter(outDir).File("usage_test.go")
+	usage.Imports = []string{"example.com/user", "fmt", "strings", "testing", "time"}
+	s.NoError(usage.AddStringTemplate(usageSource, nil))
+	s.NoError(usage.Write())
+
+	s.NoError(ProcessModel(bundletest.Models("user", &User{}), bundle.NewWriter(outDir), bundletest.Package("user")))
+
+	generated, err := ioutil.ReadFile(filepath.Join(outDir, "builder.go"))
+	s.NoError(err)
+	s.NotContains(string(generated), "Secret(")
+
+	// builders without required fields don't import the packages of the check
+	optionsDir := bundletest.Dir("options")
+	s.NoError(ProcessModel(bundletest.Models("user", &Options{}), bundle.NewWriter(optionsDir), bundletest.Package("user")))
+
+	generated, err = ioutil.ReadFile(filepath.Join(optionsDir, "builder.go"))
+	s.NoError(err)
+	s.NotContains(string(generated), `"fmt"`)
+	s.NotContains(string(generated), `"strings"`)
+
+	s.NoError(bundletest.GoTest())
+}
+
+func TestBuilderSuite(t *testing.T) {
+	suite.Run(t, &BuilderSuite{})
+}
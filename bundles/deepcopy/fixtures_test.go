@@ -0,0 +1,40 @@
+package main
+
+import "time"
+
+type Secret struct {
+	key []byte
+}
+
+func (s *Secret) DeepCopyInto(out *Secret) {
+	out.key = append([]byte{}, s.key...)
+}
+
+type Address struct {
+	Street string
+	Lines  []string
+}
+
+type Node struct {
+	Value    int
+	Next     *Node
+	Children []*Node
+}
+
+type Tags []string
+
+type User struct {
+	Name      string
+	Tags      Tags
+	Labels    map[string][]string
+	Address   *Address
+	Addresses []Address
+	Meta      map[string]*Address
+	Matrix    [2][]int
+	CreatedAt time.Time
+	Secret    Secret
+	Root      Node
+	OnChange  func()
+
+	scores []int
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+	"log"
+	"reflect"
+	"text/template"
+	"time"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+var (
+	ErrOutsideOfPackage = errors.New("Deep copy methods can be generated only into the package of the models")
+)
+
+var deepCopyTemplate = template.Must(template.New("deepcopy").Parse(`
+// DeepCopyInto deep copies the receiver into the out, which must be non-nil
+func (in *{{ .Name }}) DeepCopyInto(out *{{ .Name }}) {
+{{ .Body -}}
+}
+
+// DeepCopy returns a deep copy of the receiver, nil for nil receivers
+func (in *{{ .Name }}) DeepCopy() *{{ .Name }} {
+	if in == nil {
+		return nil
+	}
+
+	out := new({{ .Name }})
+	in.DeepCopyInto(out)
+	return out
+}
+`))
+
+type templateData struct {
+	Name string
+	Body string
+}
+
+func main() {
+	if err := mirror.RunDefaultApp("mirror-deepcopy", ProcessModel); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the DeepCopy and DeepCopyInto methods for each model.
+// Methods are declared on the models, so they are generated into their package
+func ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
+	temp := out.File("deepcopy.go")
+	q := mirror.OutQualifier(out, pkg)
+
+	// models call the generated methods of each other
+	generated := map[reflect.Type]bool{}
+	for _, rs := range models {
+		if rs.Type() != nil {
+			generated[rs.Type()] = true
+		}
+	}
+
+	for _, rs := range models {
+		if q(rs.PkgPath(), rs.PackageName()) != "" {
+			return errors.Wrap(ErrOutsideOfPackage, rs.Name())
+		}
+
+		c := &copier{
+			Code:      mirror.NewCode(rs, q),
+			generated: generated,
+		}
+		c.copyModel()
+		temp.AddImports(c.Imports...)
+
+		err := temp.AddTemplate(deepCopyTemplate, &templateData{
+			Name: rs.Name(),
+			Body: c.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return temp.Write()
+}
+
+// copier writes statements deep copying the model. All in and out
+// expressions passed around are addressable, out holds either the
+// zero value or a shallow copy of the in
+type copier struct {
+	*mirror.Code
+
+	generated map[reflect.Type]bool
+}
+
+// copyModel writes the body of the DeepCopyInto of the model, which
+// can't call the method itself
+func (c *copier) copyModel() {
+	t := c.Model.Type()
+	c.Line(1, "*out = *in")
+
+	if t.Kind() != reflect.Struct {
+		if deep(t) {
+			c.copyKind(t, "*in", "*out", 1)
+		}
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if deep(f.Type) || c.hasMethods(f.Type) {
+			c.copyValue(f.Type, "in."+f.Name, "out."+f.Name, 1)
+		}
+	}
+}
+
+// copyValue writes statements deep copying the in into the out, preferring
+// the deep copy methods of the type if it has any
+func (c *copier) copyValue(t reflect.Type, in, out string, depth int) {
+	switch {
+	case c.generated[t] || hasDeepCopyInto(t):
+		c.Line(depth, "%s.DeepCopyInto(&%s)", mirror.Paren(in), out)
+	case hasDeepCopy(t):
+		c.Line(depth, "%s = %s.DeepCopy()", out, mirror.Paren(in))
+	case !deep(t):
+		c.Line(depth, "%s = %s", out, in)
+	default:
+		c.copyKind(t, in, out, depth)
+	}
+}
+
+// copyKind writes statements deep copying the in into the out by the kind of the type
+func (c *copier) copyKind(t reflect.Type, in, out string, depth int) {
+	if !c.Accessible(t, isDeep) {
+		L.Method("Bundle", "copyKind").Warnln("Sharing ", in, " of ", c.Model.Name(), ", ", t, " is not accessible")
+		c.Line(depth, "%s = %s", out, in)
+		return
+	}
+
+	if !c.Enter(t) {
+		L.Method("Bundle", "copyKind").Warnln("Sharing ", in, " of ", c.Model.Name(), ", ", t, " is recursive")
+		c.Line(depth, "%s = %s", out, in)
+		return
+	}
+	defer c.Leave(t)
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		c.Line(depth, "if %s != nil {", in)
+		c.Line(depth+1, "in, out := &%s, &%s", in, out)
+		c.Line(depth+1, "*out = new(%s)", c.Type(t.Elem()))
+		c.copyValue(t.Elem(), "**in", "**out", depth+1)
+		c.Line(depth, "}")
+
+	case reflect.Slice:
+		c.Line(depth, "if %s != nil {", in)
+		c.Line(depth+1, "in, out := &%s, &%s", in, out)
+		c.Line(depth+1, "*out = make(%s, len(*in))", c.Type(t))
+		if deep(t.Elem()) || c.hasMethods(t.Elem()) {
+			c.Line(depth+1, "for i := range *in {")
+			c.copyValue(t.Elem(), "(*in)[i]", "(*out)[i]", depth+2)
+			c.Line(depth+1, "}")
+		} else {
+			c.Line(depth+1, "copy(*out, *in)")
+		}
+		c.Line(depth, "}")
+
+	case reflect.Map:
+		c.Line(depth, "if %s != nil {", in)
+		c.Line(depth+1, "in, out := &%s, &%s", in, out)
+		c.Line(depth+1, "*out = make(%s, len(*in))", c.Type(t))
+		c.Line(depth+1, "for key, val := range *in {")
+		if deep(t.Elem()) || c.hasMethods(t.Elem()) {
+			c.Line(depth+2, "var outVal %s", c.Type(t.Elem()))
+			c.copyValue(t.Elem(), "val", "outVal", depth+2)
+			c.Line(depth+2, "(*out)[key] = outVal")
+		} else {
+			c.Line(depth+2, "(*out)[key] = val")
+		}
+		c.Line(depth+1, "}")
+		c.Line(depth, "}")
+
+	case reflect.Array:
+		c.Line(depth, "{")
+		c.Line(depth+1, "in, out := &%s, &%s", in, out)
+		c.Line(depth+1, "for i := range *in {")
+		c.copyValue(t.Elem(), "(*in)[i]", "(*out)[i]", depth+2)
+		c.Line(depth+1, "}")
+		c.Line(depth, "}")
+
+	case reflect.Struct:
+		c.Line(depth, "{")
+		c.Line(depth+1, "in, out := &%s, &%s", in, out)
+		c.Line(depth+1, "*out = *in")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if deep(f.Type) || c.hasMethods(f.Type) {
+				c.copyValue(f.Type, "in."+f.Name, "out."+f.Name, depth+1)
+			}
+		}
+		c.Line(depth, "}")
+
+	default:
+		c.Line(depth, "%s = %s", out, in)
+	}
+}
+
+// hasMethods returns true if values of the type are copied by their methods
+func (c *copier) hasMethods(t reflect.Type) bool {
+	return c.generated[t] || hasDeepCopyInto(t) || hasDeepCopy(t)
+}
+
+// valueTypes share memory when assigned, but the shared memory is never
+// modified, so the assignment is their copy
+var valueTypes = map[reflect.Type]bool{
+	reflect.TypeOf(time.Time{}):      true,
+	reflect.TypeOf(&time.Location{}): true,
+}
+
+// deep returns true for types that share memory when assigned. Functions,
+// channels and interfaces are shared on purpose, as they can't be copied
+func deep(t reflect.Type) bool {
+	if valueTypes[t] {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Array:
+		return deep(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if deep(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isDeep filters the fields copied field by field
+func isDeep(f reflect.StructField) bool {
+	return deep(f.Type)
+}
+
+// hasDeepCopyInto returns true if the type has DeepCopyInto(*T)
+func hasDeepCopyInto(t reflect.Type) bool {
+	return mirror.HasMethod(t, "DeepCopyInto", []reflect.Type{reflect.PtrTo(t)}, nil)
+}
+
+// hasDeepCopy returns true if the type has DeepCopy() T
+func hasDeepCopy(t reflect.Type) bool {
+	return mirror.HasMethod(t, "DeepCopy", nil, []reflect.Type{t})
+}
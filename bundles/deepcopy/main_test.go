@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// usageSource mutates the original after copying it
+const usageSource = `package user
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeepCopy(t *testing.T) {
+	u := &User{
+		Name:      "Peter",
+		Tags:      Tags{"a"},
+		Labels:    map[string][]string{"k": {"v"}},
+		Address:   &Address{Lines: []string{"l"}},
+		Addresses: []Address{{Lines: []string{"l"}}},
+		Meta:      map[string]*Address{"home": {Street: "s"}},
+		Matrix:    [2][]int{{1}, {2}},
+		Secret:    Secret{key: []byte("k")},
+		Root:      Node{Next: &Node{Value: 1}, Children: []*Node{{Value: 2}}},
+		scores:    []int{1},
+	}
+
+	c := u.DeepCopy()
+	if !reflect.DeepEqual(u, c) {
+		t.Fatal("Copy differs", u, c)
+	}
+
+	u.Tags[0] = "x"
+	u.Labels["k"][0] = "x"
+	u.Address.Lines[0] = "x"
+	u.Addresses[0].Lines[0] = "x"
+	u.Meta["home"].Street = "x"
+	u.Matrix[0][0] = 9
+	u.Secret.key[0] = 'x'
+	u.Root.Next.Value = 9
+	u.Root.Children[0].Value = 9
+	u.scores[0] = 9
+
+	expected := &User{
+		Name:      "Peter",
+		Tags:      Tags{"a"},
+		Labels:    map[string][]string{"k": {"v"}},
+		Address:   &Address{Lines: []string{"l"}},
+		Addresses: []Address{{Lines: []string{"l"}}},
+		Meta:      map[string]*Address{"home": {Street: "s"}},
+		Matrix:    [2][]int{{1}, {2}},
+		Secret:    Secret{key: []byte("k")},
+		Root:      Node{Next: &Node{Value: 1}, Children: []*Node{{Value: 2}}},
+		scores:    []int{1},
+	}
+	if !reflect.DeepEqual(expected, c) {
+		t.Fatal("Copy shares memory", c)
+	}
+
+	var nilUser *User
+	if nilUser.DeepCopy() != nil {
+		t.Fatal("Nil copy")
+	}
+}
+`
+
+type DeepCopySuite struct {
+	suite.Suite
+}
+
+func (s *DeepCopySuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *DeepCopySuite) models() mirror.StructSlice {
+	return bundletest.Models("user", &User{}, &Address{}, &Node{}, new(Tags))
+}
+
+func (s *DeepCopySuite) TestProcessModel() {
+	s.NoError(bundletest.WriteModule("1.16"))
+	s.NoError(bundletest.WritePackage("user", "fixtures_test.go"))
+	s.NoError(bundletest.WriteFile("user", "usage_test.go", usageSource))
+
+	s.NoError(ProcessModel(s.models(), bundle.NewWriter(bundletest.Dir("user")), bundletest.Package("user")))
+	s.NoError(bundletest.GoTest())
+}
+
+func (s *DeepCopySuite) TestOutsideOfPackage() {
+	err := ProcessModel(s.models(), bundle.NewWriter(bundletest.Dir("out")), bundletest.Package("user"))
+	s.EqualValues(ErrOutsideOfPackage, errors.Cause(err))
+}
+
+func (s *DeepCopySuite) TestDeep() {
+	// times share only their immutable locations
+	s.False(deep(reflect.TypeOf(time.Time{})))
+	s.False(deep(reflect.TypeOf(&time.Location{})))
+	s.False(deep(reflect.TypeOf(struct{ CreatedAt time.Time }{})))
+
+	s.True(deep(reflect.TypeOf(&time.Time{})))
+	s.True(deep(reflect.TypeOf([]time.Time{})))
+}
+
+func TestDeepCopySuite(t *testing.T) {
+	suite.Run(t, &DeepCopySuite{})
+}
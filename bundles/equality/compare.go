@@ -0,0 +1,238 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"reflect"
+	"strconv"
+)
+
+// comparer writes statements of the Equal returning false once the compared
+// values differ. All compared expressions are addressable
+type comparer struct {
+	*mirror.Code
+
+	// defaults are the options of the fields without tags
+	defaults options
+
+	generated map[reflect.Type]bool
+}
+
+// equalModel writes the body of the Equal of the model, which can't call the method itself
+func (c *comparer) equalModel() error {
+	t := c.Model.Type()
+	o := c.defaults
+
+	if t.Kind() != reflect.Struct {
+		if c.compared(t, o) {
+			c.equalKind(t, "(*in)", "(*other)", o, 1)
+		}
+		return nil
+	}
+
+	return walkFields(t, o, func(f reflect.StructField, fo options) {
+		if c.compared(f.Type, fo) {
+			c.equalValue(f.Type, "in."+f.Name, "other."+f.Name, fo, 1)
+		}
+	})
+}
+
+// equalValue compares the values by their Equal method if they have one
+func (c *comparer) equalValue(t reflect.Type, a, b string, o options, depth int) {
+	switch {
+	case c.generated[t] || mirror.HasMethod(t, "Equal", []reflect.Type{reflect.PtrTo(t)}, []reflect.Type{boolType}):
+		c.Line(depth, "if !%s.Equal(&%s) {", mirror.Paren(a), b)
+	case mirror.HasMethod(t, "Equal", []reflect.Type{t}, []reflect.Type{boolType}):
+		c.Line(depth, "if !%s.Equal(%s) {", mirror.Paren(a), b)
+	case c.simple(t, o):
+		c.Line(depth, "if %s != %s {", a, b)
+	default:
+		c.equalKind(t, a, b, o, depth)
+		return
+	}
+
+	c.Line(depth+1, "return false")
+	c.Line(depth, "}")
+}
+
+// equalKind compares the values by the kind of the type
+func (c *comparer) equalKind(t reflect.Type, a, b string, o options, depth int) {
+	if !c.Accessible(t, included) || !c.Enter(t) {
+		c.deepEqual(a, b, depth)
+		return
+	}
+	defer c.Leave(t)
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		c.Line(depth, "if (%s == nil) != (%s == nil) {", a, b)
+		c.Line(depth+1, "return false")
+		c.Line(depth, "}")
+		if c.compared(t.Elem(), o) {
+			c.Line(depth, "if %s != nil {", a)
+			c.Line(depth+1, "a, b := %s, %s", a, b)
+			c.equalValue(t.Elem(), "(*a)", "(*b)", o, depth+1)
+			c.Line(depth, "}")
+		}
+
+	case reflect.Slice:
+		c.Line(depth, "if len(%s) != len(%s) {", a, b)
+		c.Line(depth+1, "return false")
+		c.Line(depth, "}")
+		if !c.compared(t.Elem(), o) {
+			return
+		}
+
+		c.Line(depth, "{")
+		c.Line(depth+1, "a, b := %s, %s", a, b)
+		if o.unordered {
+			c.unorderedSlice(t, o, depth+1)
+		} else {
+			c.Line(depth+1, "for i := range a {")
+			c.equalValue(t.Elem(), "a[i]", "b[i]", o, depth+2)
+			c.Line(depth+1, "}")
+		}
+		c.Line(depth, "}")
+
+	case reflect.Map:
+		c.Line(depth, "if len(%s) != len(%s) {", a, b)
+		c.Line(depth+1, "return false")
+		c.Line(depth, "}")
+		c.Line(depth, "{")
+		c.Line(depth+1, "a, b := %s, %s", a, b)
+		if c.compared(t.Elem(), o) {
+			c.Line(depth+1, "for key, va := range a {")
+			c.Line(depth+2, "vb, ok := b[key]")
+		} else {
+			c.Line(depth+1, "for key := range a {")
+			c.Line(depth+2, "_, ok := b[key]")
+		}
+		c.Line(depth+2, "if !ok {")
+		c.Line(depth+3, "return false")
+		c.Line(depth+2, "}")
+		if c.compared(t.Elem(), o) {
+			c.equalValue(t.Elem(), "va", "vb", o, depth+2)
+		}
+		c.Line(depth+1, "}")
+		c.Line(depth, "}")
+
+	case reflect.Array:
+		c.Line(depth, "{")
+		c.Line(depth+1, "a, b := &%s, &%s", a, b)
+		c.Line(depth+1, "for i := range a {")
+		c.equalValue(t.Elem(), "a[i]", "b[i]", o, depth+2)
+		c.Line(depth+1, "}")
+		c.Line(depth, "}")
+
+	case reflect.Struct:
+		c.Line(depth, "{")
+		c.Line(depth+1, "a, b := &%s, &%s", a, b)
+		_ = walkFields(t, o, func(f reflect.StructField, fo options) {
+			if c.compared(f.Type, fo) {
+				c.equalValue(f.Type, "a."+f.Name, "b."+f.Name, fo, depth+1)
+			}
+		})
+		c.Line(depth, "}")
+
+	case reflect.Float32, reflect.Float64:
+		c.Line(depth, "if %s != %s && !(math.Abs(float64(%s)-float64(%s)) <= %s) {", a, b, a, b, formatFloat(o.tolerance))
+		c.Line(depth+1, "return false")
+		c.Line(depth, "}")
+
+	case reflect.Complex64, reflect.Complex128:
+		c.Imports = append(c.Imports, "math/cmplx")
+		c.Line(depth, "if %s != %s && !(cmplx.Abs(complex128(%s)-complex128(%s)) <= %s) {", a, b, a, b, formatFloat(o.tolerance))
+		c.Line(depth+1, "return false")
+		c.Line(depth, "}")
+
+	default:
+		c.deepEqual(a, b, depth)
+	}
+}
+
+// unorderedSlice matches each element of a to a distinct equal element of b
+func (c *comparer) unorderedSlice(t reflect.Type, o options, depth int) {
+	c.Line(depth, "eq := func(x, y *%s) bool {", c.Type(t.Elem()))
+	c.equalValue(t.Elem(), "(*x)", "(*y)", o, depth+1)
+	c.Line(depth+1, "return true")
+	c.Line(depth, "}")
+	c.Line(depth, "matched := make([]bool, len(b))")
+	c.Line(depth, "for i := range a {")
+	c.Line(depth+1, "found := false")
+	c.Line(depth+1, "for j := range b {")
+	c.Line(depth+2, "if !matched[j] && eq(&a[i], &b[j]) {")
+	c.Line(depth+3, "matched[j], found = true, true")
+	c.Line(depth+3, "break")
+	c.Line(depth+2, "}")
+	c.Line(depth+1, "}")
+	c.Line(depth+1, "if !found {")
+	c.Line(depth+2, "return false")
+	c.Line(depth+1, "}")
+	c.Line(depth, "}")
+}
+
+// deepEqual compares values the generated code can't walk, e.g. interfaces
+func (c *comparer) deepEqual(a, b string, depth int) {
+	c.Imports = append(c.Imports, "reflect")
+	c.Line(depth, "if !reflect.DeepEqual(%s, %s) {", a, b)
+	c.Line(depth+1, "return false")
+	c.Line(depth, "}")
+}
+
+// simple returns true for types compared by the == operator
+func (c *comparer) simple(t reflect.Type, o options) bool {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return o.tolerance == 0
+	case reflect.Array:
+		return c.simple(t.Elem(), o) && !c.hasEqual(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			// all fields are compared by the operator, including the skipped ones
+			fo, ok, _ := fieldOptions(f, o)
+			if !ok || !c.simple(f.Type, fo) || c.hasEqual(f.Type) {
+				return false
+			}
+		}
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func:
+		return false
+	}
+
+	return true
+}
+
+// compared returns false for values without anything to compare, e.g. functions
+func (c *comparer) compared(t reflect.Type, o options) bool {
+	switch t.Kind() {
+	case reflect.Func:
+		return false
+	case reflect.Array:
+		return c.compared(t.Elem(), o)
+	case reflect.Struct:
+		if c.hasEqual(t) {
+			return true
+		}
+
+		compared := false
+		_ = walkFields(t, o, func(f reflect.StructField, fo options) {
+			compared = compared || c.compared(f.Type, fo)
+		})
+		return compared
+	}
+
+	return true
+}
+
+func (c *comparer) hasEqual(t reflect.Type) bool {
+	return c.generated[t] ||
+		mirror.HasMethod(t, "Equal", []reflect.Type{reflect.PtrTo(t)}, []reflect.Type{boolType}) ||
+		mirror.HasMethod(t, "Equal", []reflect.Type{t}, []reflect.Type{boolType})
+}
+
+var boolType = reflect.TypeOf(true)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
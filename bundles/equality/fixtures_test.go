@@ -0,0 +1,31 @@
+package main
+
+import "time"
+
+type Point struct {
+	X float64 `equal:"tolerance=0.01"`
+	Y float64 `equal:"tolerance=0.01"`
+}
+
+type Shape struct {
+	Name    string
+	Points  []Point
+	Tags    []string `equal:"unordered"`
+	Labels  map[string][]int
+	Parent  *Shape
+	Version int `equal:"-"`
+	Created time.Time
+	Meta    interface{}
+	OnDraw  func()
+	Scale   float64
+	Grid    [2][2]int
+	Sides   map[string]*Point
+}
+
+type Invalid struct {
+	X float64 `equal:"tolerance=small"`
+}
+
+type UnknownOption struct {
+	Tags []string `equal:"unorderd"`
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"reflect"
+)
+
+// hasher writes statements of the Hash mixing the hashed values into h.
+// Values the Equal doesn't compare field by field are not hashed, e.g.
+// tolerant floats or types with Equal methods but without Hash methods
+type hasher struct {
+	*mirror.Code
+
+	// defaults are the options of the fields without tags
+	defaults options
+
+	generated map[reflect.Type]bool
+}
+
+var uint64Type = reflect.TypeOf(uint64(0))
+
+// hashModel writes the body of the Hash of the model, which can't call the method itself
+func (h *hasher) hashModel() error {
+	t := h.Model.Type()
+	o := h.defaults
+
+	if t.Kind() != reflect.Struct {
+		h.hashKind(t, "(*in)", o, 1)
+		return nil
+	}
+
+	return walkFields(t, o, func(f reflect.StructField, fo options) {
+		h.hashValue(f.Type, "in."+f.Name, fo, 1)
+	})
+}
+
+// hashValue hashes the value by its Hash method if it has one
+func (h *hasher) hashValue(t reflect.Type, a string, o options, depth int) {
+	switch {
+	case h.generated[t] || mirror.HasMethod(t, "Hash", nil, []reflect.Type{uint64Type}):
+		h.Line(depth, "h = equalityMix(h, %s.Hash())", mirror.Paren(a))
+	case mirror.HasMethod(t, "Equal", []reflect.Type{reflect.PtrTo(t)}, []reflect.Type{boolType}) ||
+		mirror.HasMethod(t, "Equal", []reflect.Type{t}, []reflect.Type{boolType}):
+		// values equal by their method may differ in fields
+	default:
+		h.hashKind(t, a, o, depth)
+	}
+}
+
+// hashKind hashes the value by the kind of the type. Blocks with nothing
+// to hash are not written, so their variables are always used
+func (h *hasher) hashKind(t reflect.Type, a string, o options, depth int) {
+	if !h.Accessible(t, included) || !h.Enter(t) {
+		return
+	}
+	defer h.Leave(t)
+
+	switch t.Kind() {
+	case reflect.String:
+		h.Line(depth, "h = equalityMix(h, equalityString(string(%s)))", a)
+	case reflect.Bool:
+		h.Line(depth, "h = equalityMix(h, equalityBool(bool(%s)))", a)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		h.Line(depth, "h = equalityMix(h, uint64(%s))", a)
+	case reflect.Float32, reflect.Float64:
+		if o.tolerance == 0 {
+			h.Line(depth, "h = equalityMix(h, equalityFloat(float64(%s)))", a)
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if o.tolerance == 0 {
+			h.Line(depth, "h = equalityMix(h, equalityFloat(float64(real(%s))))", a)
+			h.Line(depth, "h = equalityMix(h, equalityFloat(float64(imag(%s))))", a)
+		}
+
+	case reflect.Ptr:
+		body := h.Capture(func() {
+			h.hashValue(t.Elem(), "(*a)", o, depth+1)
+		})
+		if body != "" {
+			h.Line(depth, "if %s != nil {", a)
+			h.Line(depth+1, "a := %s", a)
+			h.Write(body)
+			h.Line(depth, "}")
+		}
+
+	case reflect.Slice:
+		h.Line(depth, "h = equalityMix(h, uint64(len(%s)))", a)
+
+		if o.unordered {
+			// the sum doesn't depend on the order of the elements
+			body := h.Capture(func() {
+				h.hashValue(t.Elem(), "a[i]", o, depth+3)
+			})
+			if body != "" {
+				h.Line(depth, "{")
+				h.Line(depth+1, "a := %s", a)
+				h.Line(depth+1, "var sum uint64")
+				h.Line(depth+1, "for i := range a {")
+				h.Line(depth+2, "h := equalityOffset")
+				h.Write(body)
+				h.Line(depth+2, "sum += h")
+				h.Line(depth+1, "}")
+				h.Line(depth+1, "h = equalityMix(h, sum)")
+				h.Line(depth, "}")
+			}
+			return
+		}
+
+		body := h.Capture(func() {
+			h.hashValue(t.Elem(), "a[i]", o, depth+2)
+		})
+		if body != "" {
+			h.Line(depth, "{")
+			h.Line(depth+1, "a := %s", a)
+			h.Line(depth+1, "for i := range a {")
+			h.Write(body)
+			h.Line(depth+1, "}")
+			h.Line(depth, "}")
+		}
+
+	case reflect.Map:
+		h.Line(depth, "h = equalityMix(h, uint64(len(%s)))", a)
+
+		keyBody := h.Capture(func() {
+			h.hashValue(t.Key(), "key", o, depth+2)
+		})
+		valBody := h.Capture(func() {
+			h.hashValue(t.Elem(), "val", o, depth+2)
+		})
+		if keyBody == "" && valBody == "" {
+			return
+		}
+
+		key, val := "key", "val"
+		if keyBody == "" {
+			key = "_"
+		}
+		if valBody == "" {
+			val = "_"
+		}
+
+		// the sum doesn't depend on the order of the entries
+		h.Line(depth, "{")
+		h.Line(depth+1, "var sum uint64")
+		h.Line(depth+1, "for %s, %s := range %s {", key, val, a)
+		h.Line(depth+2, "h := equalityOffset")
+		h.Write(keyBody)
+		h.Write(valBody)
+		h.Line(depth+2, "sum += h")
+		h.Line(depth+1, "}")
+		h.Line(depth+1, "h = equalityMix(h, sum)")
+		h.Line(depth, "}")
+
+	case reflect.Array:
+		body := h.Capture(func() {
+			h.hashValue(t.Elem(), "a[i]", o, depth+2)
+		})
+		if body != "" {
+			h.Line(depth, "{")
+			h.Line(depth+1, "a := &%s", a)
+			h.Line(depth+1, "for i := range a {")
+			h.Write(body)
+			h.Line(depth+1, "}")
+			h.Line(depth, "}")
+		}
+
+	case reflect.Struct:
+		body := h.Capture(func() {
+			_ = walkFields(t, o, func(f reflect.StructField, fo options) {
+				h.hashValue(f.Type, "a."+f.Name, fo, depth+1)
+			})
+		})
+		if body != "" {
+			h.Line(depth, "{")
+			h.Line(depth+1, "a := &%s", a)
+			h.Write(body)
+			h.Line(depth, "}")
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"golang.org/x/tools/go/packages"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var (
+	ErrOutsideOfPackage = errors.New("Equality methods can be generated only into the package of the models")
+	ErrInvalidTolerance = errors.New("The float tolerance of the field is not a number")
+	ErrUnknownTagOption = errors.New("The option of the equal tag is unknown")
+)
+
+// TagKey is the key of the struct tag with the equality options of the field:
+// equal:"-" skips the field, equal:"unordered" compares its slices regardless
+// of the order, equal:"ordered" overrides the --unordered-slices and
+// equal:"tolerance=1e-9" compares its floats with the tolerance
+const TagKey = "equal"
+
+var helpersTemplate = template.Must(template.New("helpers").Parse(`
+// FNV-1a parameters of the generated hashes
+const (
+	equalityOffset uint64 = 14695981039346656037
+	equalityPrime  uint64 = 1099511628211
+)
+
+// equalityMix mixes the value into the hash
+func equalityMix(h, v uint64) uint64 {
+	for i := 0; i < 8; i++ {
+		h ^= v & 0xff
+		h *= equalityPrime
+		v >>= 8
+	}
+
+	return h
+}
+
+func equalityString(s string) uint64 {
+	h := equalityOffset
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= equalityPrime
+	}
+
+	return h
+}
+
+func equalityBool(b bool) uint64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// equalityFloat hashes the float, so the equal zeros hash equally
+func equalityFloat(f float64) uint64 {
+	if f == 0 {
+		return 0
+	}
+
+	return math.Float64bits(f)
+}
+`))
+
+var equalityTemplate = template.Must(template.New("equality").Parse(`
+// Equal returns true if the other {{ .Name }} equals the receiver
+func (in *{{ .Name }}) Equal(other *{{ .Name }}) bool {
+	if in == nil || other == nil {
+		return in == other
+	}
+{{ .Equal }}
+	return true
+}
+
+// Hash returns the hash of the {{ .Name }}, equal values have equal hashes
+func (in *{{ .Name }}) Hash() uint64 {
+	if in == nil {
+		return 0
+	}
+
+	h := equalityOffset
+{{ .Hash }}
+	return h
+}
+`))
+
+type templateData struct {
+	Name  string
+	Equal string
+	Hash  string
+}
+
+// Bundle generates the Equal and Hash methods of the models
+type Bundle struct {
+	// Tolerance is the default tolerance of float comparisons
+	Tolerance float64
+
+	// Unordered makes all slices compared regardless of the order
+	Unordered bool
+}
+
+func main() {
+	b := &Bundle{}
+	app := mirror.CreateDefaultApp("mirror-equality", b.ProcessModel)
+	app.Flags = append(app.Flags,
+		cli.Float64Flag{
+			Name:        "float-tolerance",
+			Usage:       "Compares floats with the tolerance, tolerant floats are not hashed",
+			EnvVar:      "MIRROR_EQUALITY_FLOAT_TOLERANCE",
+			Destination: &b.Tolerance,
+		},
+		cli.BoolFlag{
+			Name:        "unordered-slices",
+			Usage:       "Compares slices regardless of the order of their elements",
+			EnvVar:      "MIRROR_EQUALITY_UNORDERED_SLICES",
+			Destination: &b.Unordered,
+		},
+	)
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the Equal and Hash methods for each model. Methods are
+// declared on the models, so they are generated into their package
+func (b *Bundle) ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
+	temp := out.File("equality.go")
+	temp.AddImports("math")
+	q := mirror.OutQualifier(out, pkg)
+
+	defaults := options{tolerance: b.Tolerance, unordered: b.Unordered}
+
+	// models call the generated methods of each other
+	generated := map[reflect.Type]bool{}
+	for _, rs := range models {
+		if rs.Type() != nil {
+			generated[rs.Type()] = true
+		}
+	}
+
+	if err := temp.AddTemplate(helpersTemplate, nil); err != nil {
+		return err
+	}
+
+	for _, rs := range models {
+		if q(rs.PkgPath(), rs.PackageName()) != "" {
+			return errors.Wrap(ErrOutsideOfPackage, rs.Name())
+		}
+
+		if err := validateTags(rs.Type(), map[reflect.Type]bool{}); err != nil {
+			return err
+		}
+
+		eq := &comparer{Code: mirror.NewCode(rs, q), defaults: defaults, generated: generated}
+		if err := eq.equalModel(); err != nil {
+			return err
+		}
+
+		h := &hasher{Code: mirror.NewCode(rs, q), defaults: defaults, generated: generated}
+		if err := h.hashModel(); err != nil {
+			return err
+		}
+
+		temp.AddImports(eq.Imports...)
+		temp.AddImports(h.Imports...)
+
+		err := temp.AddTemplate(equalityTemplate, &templateData{
+			Name:  rs.Name(),
+			Equal: eq.String(),
+			Hash:  h.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return temp.Write()
+}
+
+// options are the equality options of a field and of all values within it
+type options struct {
+	tolerance float64
+	unordered bool
+}
+
+// fieldOptions returns the options of the field, false if the field is skipped
+func fieldOptions(f reflect.StructField, parent options) (options, bool, error) {
+	o := parent
+
+	tag, ok := f.Tag.Lookup(TagKey)
+	if !ok {
+		return o, true, nil
+	}
+
+	for _, opt := range strings.Split(tag, ",") {
+		switch {
+		case opt == "-":
+			return o, false, nil
+		case opt == "unordered":
+			o.unordered = true
+		case opt == "ordered":
+			o.unordered = false
+		case strings.HasPrefix(opt, "tolerance="):
+			tol, err := strconv.ParseFloat(strings.TrimPrefix(opt, "tolerance="), 64)
+			if err != nil {
+				return o, false, errors.Wrap(ErrInvalidTolerance, f.Name)
+			}
+			o.tolerance = tol
+		default:
+			return o, false, errors.Wrapf(ErrUnknownTagOption, "%s of %s", opt, f.Name)
+		}
+	}
+
+	return o, true, nil
+}
+
+// included filters the fields compared field by field
+func included(f reflect.StructField) bool {
+	_, ok, _ := fieldOptions(f, options{})
+	return ok
+}
+
+// walkFields calls the fn for each field of the struct that isn't skipped
+func walkFields(t reflect.Type, parent options, fn func(f reflect.StructField, o options)) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		o, ok, err := fieldOptions(f, parent)
+		if err != nil {
+			return err
+		}
+		if !ok || f.Name == "_" {
+			continue
+		}
+
+		fn(f, o)
+	}
+
+	return nil
+}
+
+// validateTags returns the error of the first invalid tag of the fields
+// of the type and of all types within it
+func validateTags(t reflect.Type, visited map[reflect.Type]bool) error {
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return validateTags(t.Elem(), visited)
+	case reflect.Map:
+		return validateTags(t.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if _, _, err := fieldOptions(t.Field(i), options{}); err != nil {
+				return errors.Wrapf(err, "%s", t)
+			}
+			if err := validateTags(t.Field(i).Type, visited); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
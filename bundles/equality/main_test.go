@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// usageSource compares shapes differing in a single field
+const usageSource = `package shape
+
+import (
+	"testing"
+	"time"
+)
+
+func shape() *Shape {
+	return &Shape{
+		Name:    "square",
+		Points:  []Point{{X: 0, Y: 0}, {X: 1, Y: 1}},
+		Tags:    []string{"a", "b"},
+		Labels:  map[string][]int{"k": {1}},
+		Parent:  &Shape{Name: "parent"},
+		Version: 1,
+		Created: time.Unix(10, 0),
+		Meta:    map[string]int{"m": 1},
+		Scale:   1.5,
+		Grid:    [2][2]int{{1, 2}, {3, 4}},
+		Sides:   map[string]*Point{"top": {X: 1}},
+	}
+}
+
+func TestEquality(t *testing.T) {
+	equal := []func(s *Shape){
+		func(s *Shape) {},
+		func(s *Shape) { s.Tags = []string{"b", "a"} },
+		func(s *Shape) { s.Points[1].X = 1.001 },
+		func(s *Shape) { s.Version = 2 },
+		func(s *Shape) { s.Created = s.Created.UTC() },
+		func(s *Shape) { s.OnDraw = func() {} },
+	}
+	for i, change := range equal {
+		a, b := shape(), shape()
+		change(b)
+
+		if !a.Equal(b) || !b.Equal(a) {
+			t.Fatal("Not equal", i)
+		}
+		if a.Hash() != b.Hash() {
+			t.Fatal("Hashes differ", i)
+		}
+	}
+
+	different := []func(s *Shape){
+		func(s *Shape) { s.Name = "circle" },
+		func(s *Shape) { s.Tags = []string{"a", "a"} },
+		func(s *Shape) { s.Points[1].X = 2 },
+		func(s *Shape) { s.Labels["k"][0] = 2 },
+		func(s *Shape) { s.Parent.Name = "other" },
+		func(s *Shape) { s.Parent = nil },
+		func(s *Shape) { s.Meta = map[string]int{"m": 2} },
+		func(s *Shape) { s.Scale = 1.6 },
+		func(s *Shape) { s.Grid[1][1] = 5 },
+		func(s *Shape) { s.Sides["top"].Y = 1 },
+		func(s *Shape) { s.Created = s.Created.Add(time.Second) },
+	}
+	for i, change := range different {
+		a, b := shape(), shape()
+		change(b)
+
+		if a.Equal(b) || b.Equal(a) {
+			t.Fatal("Equal", i)
+		}
+	}
+
+	var nilShape *Shape
+	if !nilShape.Equal(nil) || nilShape.Equal(shape()) || shape().Equal(nil) {
+		t.Fatal("Nil equality")
+	}
+}
+`
+
+type EqualitySuite struct {
+	suite.Suite
+}
+
+type EqualityCandidate struct {
+	name   string
+	models []interface{}
+
+	err error
+}
+
+func (s *EqualitySuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *EqualitySuite) TestProcessModel() {
+	s.NoError(bundletest.WriteModule("1.16"))
+	s.NoError(bundletest.WritePackage("shape", "fixtures_test.go"))
+	s.NoError(bundletest.WriteFile("shape", "usage_test.go", usageSource))
+
+	models := bundletest.Models("shape", &Shape{}, &Point{})
+	s.NoError((&Bundle{}).ProcessModel(models, bundle.NewWriter(bundletest.Dir("shape")), bundletest.Package("shape")))
+	s.NoError(bundletest.GoTest())
+}
+
+func (s *EqualitySuite) TestProcessModelDefaults() {
+	dir := bundletest.Dir("shape")
+	b := &Bundle{Tolerance: 0.5, Unordered: true}
+	s.NoError(b.ProcessModel(bundletest.Models("shape", &Shape{}), bundle.NewWriter(dir), bundletest.Package("shape")))
+
+	generated, err := ioutil.ReadFile(filepath.Join(dir, "equality.go"))
+	s.NoError(err)
+	s.Contains(string(generated), "<= 0.5")
+}
+
+func (s *EqualitySuite) TestProcessModelErrors() {
+	candidates := []EqualityCandidate{
+		{
+			name:   "Get error for invalid tolerance",
+			models: []interface{}{&Invalid{}},
+			err:    ErrInvalidTolerance,
+		},
+		{
+			name:   "Get error for an unknown tag option",
+			models: []interface{}{&UnknownOption{}},
+			err:    ErrUnknownTagOption,
+		},
+		{
+			name:   "Get error for a described model",
+			models: []interface{}{&plugins.TypeDescription{Name: "Point", Kind: "struct"}},
+			err:    mirror.ErrDescribedModel,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		err := (&Bundle{}).ProcessModel(bundletest.Models("shape", c.models...), bundle.NewWriter(bundletest.Dir("shape")), bundletest.Package("shape"))
+		s.EqualValues(c.err, errors.Cause(err))
+	}
+
+	err := (&Bundle{}).ProcessModel(bundletest.Models("shape", &Point{}), bundle.NewWriter(bundletest.Dir("out")), bundletest.Package("shape"))
+	s.EqualValues(ErrOutsideOfPackage, errors.Cause(err))
+}
+
+func TestEqualitySuite(t *testing.T) {
+	suite.Run(t, &EqualitySuite{})
+}
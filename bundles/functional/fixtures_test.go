@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+type Email string
+
+type User struct {
+	Email     Email
+	Name      string
+	Age       int
+	Tags      []string
+	CreatedAt time.Time
+
+	password string
+}
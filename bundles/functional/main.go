@@ -2,28 +2,45 @@ package main
 
 import (
 	"github.com/petomalina/mirror"
+	"github.com/urfave/cli"
 	"golang.org/x/tools/go/packages"
 	"log"
+	"os"
+	"reflect"
+	"text/template"
 )
 
-const functionalTemplate = `type {{ .TypeName }}Slice []*{{ .TypeName }}
-type {{ .TypeName }}MapCallback func(*{{ .TypeName }}) *{{ .TypeName }}
+var functionalTemplate = template.Must(template.New("functional").Parse(`
+// {{ .Slice }} is a slice of {{ .Name }} with functional operations
+type {{ .Slice }} []{{ .Elem }}
+type {{ .Name }}MapCallback func({{ .Elem }}) {{ .Elem }}
 
 // Map replaces each object in slice by its mapped descendant
-func (us {{ .TypeName }}Slice) Map(cb {{ .TypeName }}MapCallback) {{ .TypeName }}Slice {
-	newSlice := {{ .TypeName }}Slice{}
+func (us {{ .Slice }}) Map(cb {{ .Name }}MapCallback) {{ .Slice }} {
+	newSlice := {{ .Slice }}{}
 	for _, o := range us {
 		newSlice = append(newSlice, cb(o))
 	}
-	
+
 	return newSlice
 }
 
-type {{ .TypeName }}FilterCallback func(*{{ .TypeName }}) bool
+// Map{{ .Slice }} maps each object in slice to a value of any type
+func Map{{ .Slice }}[R any](us {{ .Slice }}, cb func({{ .Elem }}) R) []R {
+	res := make([]R, 0, len(us))
+	for _, o := range us {
+		res = append(res, cb(o))
+	}
+
+	return res
+}
+
+type {{ .Name }}FilterCallback func({{ .Elem }}) bool
 
-func (us {{ .TypeName }}Slice) Filter(cb {{ .TypeName }}FilterCallback) {{ .TypeName }}Slice {
-	newSlice := {{ .TypeName }}Slice{}
-	for _, o := range us  {
+// Filter returns objects the callback returns true for
+func (us {{ .Slice }}) Filter(cb {{ .Name }}FilterCallback) {{ .Slice }} {
+	newSlice := {{ .Slice }}{}
+	for _, o := range us {
 		if cb(o) {
 			newSlice = append(newSlice, o)
 		}
@@ -32,39 +49,233 @@ func (us {{ .TypeName }}Slice) Filter(cb {{ .TypeName }}FilterCallback) {{ .Type
 	return newSlice
 }
 
-type {{ .TypeName }}ReduceCallback func(interface{}, *{{ .TypeName }}) interface{} 
-
-func (us {{ .TypeName }}Slice) Reduce(cb {{ .TypeName }}ReduceCallback, init interface{}) interface{} {
-	var res = init
+// Reduce{{ .Slice }} reduces the slice into a single value of any type
+func Reduce{{ .Slice }}[R any](us {{ .Slice }}, cb func(R, {{ .Elem }}) R, init R) R {
+	res := init
 	for _, o := range us {
 		res = cb(res, o)
 	}
 
 	return res
 }
-`
 
-func main() {
-	if err := mirror.RunDefaultApp("mirror-functional", ProcessModel); err != nil {
-		log.Fatal(err)
+// Find returns the first object the callback returns true for
+func (us {{ .Slice }}) Find(cb {{ .Name }}FilterCallback) ({{ .Elem }}, bool) {
+	for _, o := range us {
+		if cb(o) {
+			return o, true
+		}
+	}
+
+	var zero {{ .Elem }}
+	return zero, false
+}
+
+// Any returns true if the callback returns true for any of the objects
+func (us {{ .Slice }}) Any(cb {{ .Name }}FilterCallback) bool {
+	_, ok := us.Find(cb)
+	return ok
+}
+
+// All returns true if the callback returns true for all of the objects
+func (us {{ .Slice }}) All(cb {{ .Name }}FilterCallback) bool {
+	for _, o := range us {
+		if !cb(o) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Partition splits the slice into objects the callback returns true
+// for and the rest of them
+func (us {{ .Slice }}) Partition(cb {{ .Name }}FilterCallback) ({{ .Slice }}, {{ .Slice }}) {
+	matched, rest := {{ .Slice }}{}, {{ .Slice }}{}
+	for _, o := range us {
+		if cb(o) {
+			matched = append(matched, o)
+		} else {
+			rest = append(rest, o)
+		}
+	}
+
+	return matched, rest
+}
+
+// Chunk splits the slice into chunks of the given size, the last
+// chunk may be smaller. Chunk panics if the size is not positive
+func (us {{ .Slice }}) Chunk(size int) []{{ .Slice }} {
+	if size < 1 {
+		panic("{{ .Slice }}.Chunk: size must be positive")
+	}
+
+	chunks := []{{ .Slice }}{}
+	for size < len(us) {
+		us, chunks = us[size:], append(chunks, us[:size:size])
+	}
+	if len(us) > 0 {
+		chunks = append(chunks, us)
+	}
+
+	return chunks
+}
+{{ range .Fields }}
+// Pluck{{ .Name }} returns {{ .Name }} of each object in slice
+func (us {{ $.Slice }}) Pluck{{ .Name }}() []{{ .Type }} {
+	res := make([]{{ .Type }}, 0, len(us))
+	for _, o := range us {
+		res = append(res, o.{{ .Name }})
+	}
+
+	return res
+}
+{{ if .Comparable }}
+// GroupBy{{ .Name }} groups objects in slice by their {{ .Name }}
+func (us {{ $.Slice }}) GroupBy{{ .Name }}() map[{{ .Type }}]{{ $.Slice }} {
+	groups := map[{{ .Type }}]{{ $.Slice }}{}
+	for _, o := range us {
+		groups[o.{{ .Name }}] = append(groups[o.{{ .Name }}], o)
 	}
+
+	return groups
+}
+
+// UniqueBy{{ .Name }} returns the first object for each {{ .Name }}
+func (us {{ $.Slice }}) UniqueBy{{ .Name }}() {{ $.Slice }} {
+	seen := map[{{ .Type }}]bool{}
+	newSlice := {{ $.Slice }}{}
+	for _, o := range us {
+		if !seen[o.{{ .Name }}] {
+			seen[o.{{ .Name }}] = true
+			newSlice = append(newSlice, o)
+		}
+	}
+
+	return newSlice
 }
 
+// IndexBy{{ .Name }} maps each {{ .Name }} to its object,
+// later objects override the earlier ones
+func (us {{ $.Slice }}) IndexBy{{ .Name }}() map[{{ .Type }}]{{ $.Elem }} {
+	index := make(map[{{ .Type }}]{{ $.Elem }}, len(us))
+	for _, o := range us {
+		index[o.{{ .Name }}] = o
+	}
+
+	return index
+}
+{{ end }}{{ if .Ordered }}
+// SortBy{{ .Name }} returns a copy of the slice stably sorted by {{ .Name }}
+func (us {{ $.Slice }}) SortBy{{ .Name }}() {{ $.Slice }} {
+	newSlice := append({{ $.Slice }}{}, us...)
+	sort.SliceStable(newSlice, func(i, j int) bool {
+		return newSlice[i].{{ .Name }} < newSlice[j].{{ .Name }}
+	})
+
+	return newSlice
+}
+{{ end }}{{ end }}`))
+
 type templateData struct {
-	TypeName string
+	Name  string
+	Slice string
+	Elem  string
+
+	Fields []fieldData
 }
 
-func ProcessModel(models mirror.StructSlice, out *mirror.Writer, _ *packages.Package) error {
+type fieldData struct {
+	Name string
+	Type string
+
+	// Comparable fields can be used as map keys
+	Comparable bool
+
+	// Ordered fields support the < operator
+	Ordered bool
+}
+
+// Bundle generates the slices of the models with functional operations
+type Bundle struct {
+	// Values makes the slices hold values of the models instead of pointers
+	Values bool
+}
+
+func main() {
+	b := &Bundle{}
+	app := mirror.CreateDefaultApp("mirror-functional", b.ProcessModel)
+	app.Flags = append(app.Flags, cli.BoolFlag{
+		Name:        "values",
+		Usage:       "Generates slices of model values instead of pointers to them",
+		EnvVar:      "MIRROR_FUNCTIONAL_VALUES",
+		Destination: &b.Values,
+	})
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the slice with operations for each model. Operations
+// over fields are generated for exported fields of struct models
+func (b *Bundle) ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
 	temp := out.File("functional.go")
+	q := mirror.OutQualifier(out, pkg)
 
 	for _, rs := range models {
-		err := temp.AddStringTemplate(functionalTemplate, &templateData{
-			TypeName: rs.Name(),
-		})
-		if err != nil {
+		data := &templateData{
+			Name:  rs.Name(),
+			Slice: rs.Name() + "Slice",
+			Elem:  "*" + rs.QualifiedName(q),
+		}
+		if b.Values {
+			data.Elem = rs.QualifiedName(q)
+		}
+
+		if pkgName := q(rs.PkgPath(), rs.PackageName()); pkgName != "" {
+			temp.AddImports(rs.PkgPath())
+		}
+
+		for _, f := range rs.RawFields() {
+			if !f.Exported() {
+				continue
+			}
+
+			fd := fieldData{
+				Name:       f.Field.Name,
+				Type:       rs.TypeString(f.Typ, q),
+				Comparable: f.Typ.Comparable(),
+				Ordered:    isOrdered(f.Typ),
+			}
+			if fd.Ordered {
+				temp.AddImports("sort")
+			}
+			temp.AddImports(rs.TypeImports(f.Typ, q)...)
+
+			data.Fields = append(data.Fields, fd)
+		}
+
+		if err := temp.AddTemplate(functionalTemplate, data); err != nil {
 			return err
 		}
 	}
 
 	return temp.Write()
 }
+
+// isOrdered returns true for types supporting the < operator
+func isOrdered(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// usageSource exercises the generated operations, the elem
+// function converts a User into an element of the slice
+const usageSource = `func TestOperations(t *testing.T) {
+	us := UserSlice{
+		elem(User{Email: "a@x.io", Name: "Carl", Age: 30}),
+		elem(User{Email: "b@x.io", Name: "Anna", Age: 20}),
+		elem(User{Email: "a@x.io", Name: "Bert", Age: 40}),
+	}
+
+	names := MapUserSlice(us, func(u {{ .Elem }}) string { return u.Name })
+	if len(names) != 3 || names[0] != "Carl" {
+		t.Fatal("Map", names)
+	}
+
+	total := ReduceUserSlice(us, func(sum int, u {{ .Elem }}) int { return sum + u.Age }, 0)
+	if total != 90 {
+		t.Fatal("Reduce", total)
+	}
+
+	if u, ok := us.Find(func(u {{ .Elem }}) bool { return u.Age > 30 }); !ok || u.Name != "Bert" {
+		t.Fatal("Find", u, ok)
+	}
+
+	if !us.Any(func(u {{ .Elem }}) bool { return u.Age == 20 }) || us.All(func(u {{ .Elem }}) bool { return u.Age > 20 }) {
+		t.Fatal("Any/All")
+	}
+
+	old, young := us.Partition(func(u {{ .Elem }}) bool { return u.Age >= 30 })
+	if len(old) != 2 || len(young) != 1 {
+		t.Fatal("Partition", old, young)
+	}
+
+	if chunks := us.Chunk(2); len(chunks) != 2 || len(chunks[1]) != 1 {
+		t.Fatal("Chunk", chunks)
+	}
+
+	if groups := us.GroupByEmail(); len(groups["a@x.io"]) != 2 {
+		t.Fatal("GroupBy", groups)
+	}
+
+	if unique := us.UniqueByEmail(); len(unique) != 2 || unique[0].Name != "Carl" {
+		t.Fatal("UniqueBy", unique)
+	}
+
+	if index := us.IndexByEmail(); index["a@x.io"].Name != "Bert" {
+		t.Fatal("IndexBy", index)
+	}
+
+	if sorted := us.SortByName(); sorted[0].Name != "Anna" || us[0].Name != "Carl" {
+		t.Fatal("SortBy", sorted)
+	}
+
+	var tags [][]string = us.PluckTags()
+	if len(tags) != 3 {
+		t.Fatal("Pluck", tags)
+	}
+}
+`
+
+type FunctionalSuite struct {
+	suite.Suite
+}
+
+type FunctionalCandidate struct {
+	name   string
+	values bool
+	elem   string
+	ref    string
+}
+
+func (s *FunctionalSuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *FunctionalSuite) TestProcessModel() {
+	candidates := []FunctionalCandidate{
+		{
+			name: "Generate slices of pointers",
+			elem: "*User",
+			ref:  "&u",
+		},
+		{
+			name:   "Generate slices of values",
+			values: true,
+			elem:   "User",
+			ref:    "u",
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		s.NoError(bundletest.WriteModule("1.18"))
+		s.NoError(bundletest.WritePackage("user", "fixtures_test.go"))
+
+		usage := bundle.NewWriter(bundletest.Dir("user")).File("usage_test.go")
+		usage.Imports = []string{"testing"}
+		s.NoError(usage.AddStringTemplate(usageSource, map[string]string{"Elem": c.elem}))
+		s.NoError(usage.AddStringTemplate(fmt.Sprintf("\nfunc elem(u User) %s { return %s }\n", c.elem, c.ref), nil))
+		s.NoError(usage.Write())
+
+		b := &Bundle{Values: c.values}
+		s.NoError(b.ProcessModel(bundletest.Models("user", &User{}), bundle.NewWriter(bundletest.Dir("user")), bundletest.Package("user")))
+		s.NoError(bundletest.GoTest())
+	}
+}
+
+func TestFunctionalSuite(t *testing.T) {
+	suite.Run(t, &FunctionalSuite{})
+}
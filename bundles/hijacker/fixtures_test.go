@@ -0,0 +1,18 @@
+package main
+
+import "time"
+
+type Email string
+
+type secret struct {
+	key int
+}
+
+type User struct {
+	Name     string
+	password string
+	count    int
+	email    Email
+	at       time.Time
+	secret   secret
+}
@@ -4,33 +4,75 @@ import (
 	"github.com/petomalina/mirror"
 	"golang.org/x/tools/go/packages"
 	"log"
+	"reflect"
 	"strings"
 	"text/template"
 )
 
 var typeTemplate = template.Must(template.New("type").Parse(`
-type Hijacked{{ .Name }} {{ .Package}}.{{ .Name }}
-`))
+// Hijacked{{ .Name }} gives access to unexported fields of {{ .Type }}
+type Hijacked{{ .Name }} {{ .Type }}
+
+// Hijack{{ .Name }} returns the hijacked view of the model
+func Hijack{{ .Name }}(m *{{ .Type }}) *Hijacked{{ .Name }} {
+	return (*Hijacked{{ .Name }})(m)
+}
+{{ if .Fields }}
+// offsets of the unexported fields of {{ .Type }} computed by the generator
+const (
+{{- range .Fields }}
+	{{ .Offset }} = {{ .Value }}
+{{- end }}
+)
+
+// init verifies the generated offsets against the current layout of the model
+func init() {
+	t := reflect.TypeOf((*Hijacked{{ .Name }})(nil)).Elem()
+	for _, f := range []struct {
+		name   string
+		offset uintptr
+		typ    reflect.Type
+	}{
+{{- range .Fields }}
+		{"{{ .Name }}", {{ .Offset }}, reflect.TypeOf((*{{ .Type }})(nil)).Elem()},
+{{- end }}
+	} {
+		field, ok := t.FieldByName(f.name)
+		if !ok || field.Offset != f.offset || field.Type != f.typ {
+			panic("hijacker: field " + f.name + " of {{ $.Type }} has changed, regenerate the hijacker")
+		}
+	}
+}
+{{ end }}`))
 
 type TypeTemplateData struct {
-	Package string
-	Name    string
+	Name string
+	Type string
+
+	Fields []FieldTemplateData
 }
 
 var hiJackedFieldTemplate = template.Must(template.New("hijackedField").Parse(`
-func (h *Hijacked{{ .Name }}) Get{{ .FieldName }}() ({{ .FieldType }}, error) {
-	return "", nil
+// Get{{ .Accessor }} returns the unexported {{ .Name }} field
+func (h *Hijacked{{ .Model }}) Get{{ .Accessor }}() {{ .Type }} {
+	return *(*{{ .Type }})(unsafe.Pointer(uintptr(unsafe.Pointer(h)) + {{ .Offset }}))
 }
 
-func (h *Hijacked{{ .Name }}) Set{{ .FieldName }}(x {{ .FieldType }}) error {
-	return nil
+// Set{{ .Accessor }} sets the unexported {{ .Name }} field
+func (h *Hijacked{{ .Model }}) Set{{ .Accessor }}(x {{ .Type }}) {
+	*(*{{ .Type }})(unsafe.Pointer(uintptr(unsafe.Pointer(h)) + {{ .Offset }})) = x
 }
 `))
 
 type FieldTemplateData struct {
-	Name      string
-	FieldName string
-	FieldType string
+	Model    string
+	Name     string
+	Accessor string
+	Type     string
+
+	// Offset is the name of the constant holding the Value of the offset
+	Offset string
+	Value  uintptr
 }
 
 func main() {
@@ -40,37 +82,52 @@ func main() {
 }
 
 func ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
 	temp := out.File("hijacker.go")
-	temp.Imports = models.PkgPaths()
+	q := mirror.OutQualifier(out, pkg)
 
-	// hijack and create types with fields
 	for _, r := range models {
-		err := temp.AddTemplate(typeTemplate, &TypeTemplateData{
-			Package: pkg.Name,
-			Name:    r.Name(),
-		})
-		if err != nil {
-			return err
+		if q(r.PkgPath(), r.PackageName()) != "" {
+			temp.AddImports(r.PkgPath())
+		}
+
+		data := &TypeTemplateData{
+			Name: r.Name(),
+			Type: r.QualifiedName(q),
 		}
 
-		mappings := make(map[string]string)
 		for _, f := range r.RawFields() {
-			// only hijack unexported fields
-			if f.Exported() {
+			// only hijack unexported fields, the user already has access to the rest
+			if f.Exported() || f.Field.Name == "_" || !referable(r, f.Typ, q) {
 				continue
 			}
 
-			// TODO: resolve the real type
-			mappings[strings.Title(f.Field.Name)] = "string"
+			accessor := strings.Title(f.Field.Name)
+			data.Fields = append(data.Fields, FieldTemplateData{
+				Model:    r.Name(),
+				Name:     f.Field.Name,
+				Accessor: accessor,
+				Type:     r.TypeString(f.Typ, q),
+				Offset:   "hijacked" + r.Name() + accessor + "Offset",
+				Value:    f.Field.Offset,
+			})
+			temp.AddImports(r.TypeImports(f.Typ, q)...)
 		}
 
-		for fieldName, fieldType := range mappings {
-			err := temp.AddTemplate(hiJackedFieldTemplate, &FieldTemplateData{
-				Name:      r.Name(),
-				FieldName: fieldName,
-				FieldType: fieldType,
-			})
+		if len(data.Fields) != 0 {
+			temp.AddImports("reflect", "unsafe")
+		}
+
+		err := temp.AddTemplate(typeTemplate, data)
+		if err != nil {
+			return err
+		}
 
+		for _, fd := range data.Fields {
+			err := temp.AddTemplate(hiJackedFieldTemplate, fd)
 			if err != nil {
 				return err
 			}
@@ -79,3 +136,23 @@ func ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.P
 
 	return temp.Write()
 }
+
+// referable returns false for types that can't be written in the generated
+// code, e.g. unexported types of other packages or unnamed structs
+func referable(r *mirror.Struct, t reflect.Type, q mirror.Qualifier) bool {
+	if t.Name() != "" {
+		exported := strings.Title(t.Name()) == t.Name()
+		return t.PkgPath() == "" || exported || !strings.Contains(r.TypeString(t, q), ".")
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Chan:
+		return referable(r, t.Elem(), q)
+	case reflect.Map:
+		return referable(r, t.Key(), q) && referable(r, t.Elem(), q)
+	case reflect.Interface:
+		return t.NumMethod() == 0
+	}
+
+	return false
+}
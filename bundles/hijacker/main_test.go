@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// usageSource uses the accessors generated into another package
+const usageSource = `func TestAccessors(t *testing.T) {
+	u := &user.User{Name: "Peter"}
+	h := HijackUser(u)
+
+	h.SetPassword("secret")
+	h.SetCount(42)
+	h.SetEmail("peter@x.io")
+	h.SetAt(time.Unix(10, 0))
+
+	if h.GetPassword() != "secret" || h.GetCount() != 42 || h.GetEmail() != "peter@x.io" || h.GetAt().Unix() != 10 {
+		t.Fatal("Accessors", h.GetPassword(), h.GetCount(), h.GetEmail(), h.GetAt())
+	}
+
+	if u.Name != "Peter" {
+		t.Fatal("Exported field was overwritten", u.Name)
+	}
+}
+`
+
+type HijackerMainSuite struct {
+	suite.Suite
+}
+
+func (s *HijackerMainSuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *HijackerMainSuite) TestProcessModel() {
+	outDir := bundletest.Dir("hijack")
+	s.NoError(bundletest.WriteModule("1.16"))
+	s.NoError(bundletest.WritePackage("user", "fixtures_test.go"))
+
+	usage := bundle.NewWriter(outDir).File("usage_test.go")
+	usage.Imports = []string{"example.com/user", "testing", "time"}
+	s.NoError(usage.AddStringTemplate(usageSource, nil))
+	s.NoError(usage.Write())
+
+	s.NoError(ProcessModel(bundletest.Models("user", &User{}), bundle.NewWriter(outDir), bundletest.Package("user")))
+
+	generated, err := ioutil.ReadFile(filepath.Join(outDir, "hijacker.go"))
+	s.NoError(err)
+
+	// fields of unexported types of other packages can't be accessed
+	s.NotContains(string(generated), "GetSecret")
+
+	s.NoError(bundletest.GoTest())
+}
+
+func TestHijackerMainSuite(t *testing.T) {
+	suite.Run(t, &HijackerMainSuite{})
+}
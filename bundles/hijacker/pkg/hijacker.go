@@ -2,24 +2,98 @@ package pkg
 
 import (
 	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
 	"reflect"
 	"unsafe"
 )
 
-type HijackedField struct {
+var (
+	ErrNotStructPointer = errors.New("Only non-nil pointers to structs can be hijacked")
+	ErrFieldNotFound    = errors.New("The struct has no field with the given name")
+	ErrFieldType        = errors.New("The value is not assignable to the field")
+	ErrNilEmbedded      = errors.New("The field is promoted through a nil embedded pointer")
+)
+
+// Hijacked gives access to all fields of the hijacked struct, including
+// the unexported ones
+type Hijacked struct {
+	value reflect.Value
+}
+
+// Hijack returns a Hijacked for the Ref of the model, which must be
+// a pointer to the struct so its fields can be set. Models described by
+// the isolated loader can't be hijacked
+func Hijack(model *mirror.Struct) (*Hijacked, error) {
+	// described models have no value to hijack
+	if model.Description != nil {
+		return nil, errors.Wrap(mirror.ErrDescribedModel, model.Name())
+	}
+
+	v := reflect.ValueOf(model.Ref)
+
+	// models loaded from plugins may be pointers to the pointers
+	for v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, ErrNotStructPointer
+	}
+
+	return &Hijacked{value: v.Elem()}, nil
 }
 
-func Hijack(model *mirror.Struct) error {
+// field returns a settable value of the field with the given name
+func (h *Hijacked) field(name string) (reflect.Value, error) {
+	f, ok := h.value.Type().FieldByName(name)
+	if !ok {
+		return reflect.Value{}, errors.Wrap(ErrFieldNotFound, name)
+	}
 
-	for _, f := range model.RawFields() {
-		// ignore exported fields - user already has access to them
-		if f.Exported() {
-			continue
+	// fields promoted through the embedded pointers are walked manually,
+	// as the FieldByIndex panics on the nil ones
+	field := h.value
+	for i, index := range f.Index {
+		if i > 0 && field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				return reflect.Value{}, errors.Wrapf(ErrNilEmbedded, "%s of %s", field.Type(), name)
+			}
+			field = field.Elem()
 		}
+		field = field.Field(index)
+	}
+
+	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem(), nil
+}
+
+// Get returns the value of the field with the given name
+func (h *Hijacked) Get(name string) (interface{}, error) {
+	field, err := h.field(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return field.Interface(), nil
+}
+
+// Set sets the field with the given name to x, which must be assignable
+// to the field. A nil x sets the field to its zero value
+func (h *Hijacked) Set(name string, x interface{}) error {
+	field, err := h.field(name)
+	if err != nil {
+		return err
+	}
+
+	if x == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
 
-		field := reflect.NewAt(f.Typ, unsafe.Pointer(f.Value.UnsafeAddr())).Elem()
-		field.Set(reflect.ValueOf("Hello"))
+	v := reflect.ValueOf(x)
+	if !v.Type().AssignableTo(field.Type()) {
+		return errors.Wrapf(ErrFieldType, "%s of %s to %s", v.Type(), name, field.Type())
 	}
 
+	field.Set(v)
 	return nil
 }
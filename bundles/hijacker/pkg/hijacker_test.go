@@ -1,19 +1,122 @@
 package pkg
 
 import (
+	"fmt"
 	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/pkg/plugins"
 	"github.com/petomalina/mirror/pkg/plugins/fixtures/user"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
 	"testing"
 )
 
+type base struct {
+	id int
+}
+
+type Account struct {
+	*base
+	Name string
+}
+
 type HijackerSuite struct {
 	suite.Suite
 }
 
+type HijackCandidate struct {
+	name  string
+	field string
+	value interface{}
+
+	expected interface{}
+	err      error
+}
+
 func (s *HijackerSuite) TestHijack() {
-	err := Hijack(mirror.ReflectStruct(user.XUser))
+	_, err := Hijack(mirror.ReflectStruct(user.XUser))
+	s.NoError(err)
+
+	_, err = Hijack(mirror.ReflectStruct(user.User{}))
+	s.EqualValues(ErrNotStructPointer, err)
+
+	var nilUser *user.User
+	_, err = Hijack(mirror.ReflectStruct(nilUser))
+	s.EqualValues(ErrNotStructPointer, err)
+
+	_, err = Hijack(mirror.ReflectStruct(&plugins.TypeDescription{Name: "User", Kind: "struct"}))
+	s.EqualValues(mirror.ErrDescribedModel, errors.Cause(err))
+}
+
+func (s *HijackerSuite) TestGetSet() {
+	candidates := []HijackCandidate{
+		{
+			name:     "Set unexported field",
+			field:    "password",
+			value:    "secret",
+			expected: "secret",
+		},
+		{
+			name:     "Set exported field",
+			field:    "Name",
+			value:    "Peter",
+			expected: "Peter",
+		},
+		{
+			name:     "Reset field to zero value",
+			field:    "password",
+			value:    nil,
+			expected: "",
+		},
+		{
+			name:  "Get error for value of other type",
+			field: "password",
+			value: 42,
+			err:   ErrFieldType,
+		},
+		{
+			name:  "Get error for missing field",
+			field: "salt",
+			value: "x",
+			err:   ErrFieldNotFound,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		h, err := Hijack(mirror.ReflectStruct(&user.User{}))
+		s.NoError(err)
+
+		err = h.Set(c.field, c.value)
+		s.EqualValues(c.err, errors.Cause(err))
+		if c.err != nil {
+			continue
+		}
+
+		value, err := h.Get(c.field)
+		s.NoError(err)
+		s.EqualValues(c.expected, value)
+	}
+}
+
+func (s *HijackerSuite) TestGetSetEmbedded() {
+	h, err := Hijack(mirror.ReflectStruct(&Account{}))
+	s.NoError(err)
+
+	_, err = h.Get("id")
+	s.EqualValues(ErrNilEmbedded, errors.Cause(err))
+	s.EqualValues(ErrNilEmbedded, errors.Cause(h.Set("id", 1)))
+
+	account := &Account{base: &base{}}
+	h, err = Hijack(mirror.ReflectStruct(account))
+	s.NoError(err)
+
+	s.NoError(h.Set("id", 42))
+	s.EqualValues(42, account.id)
+
+	value, err := h.Get("id")
 	s.NoError(err)
+	s.EqualValues(42, value)
 }
 
 func TestHijackerSuite(t *testing.T) {
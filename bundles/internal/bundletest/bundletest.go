@@ -0,0 +1,128 @@
+// Package bundletest writes go modules the code generated by the bundles is
+// compiled and tested within. The models of the module are written from the
+// fixture file of the bundle test, so they always match the reflected fixtures
+package bundletest
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/pkg/cp"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const (
+	// ModuleDir is the directory of the test module
+	ModuleDir = ".testmodule"
+
+	// ModulePath is the path of the test module
+	ModulePath = "example.com"
+
+	// ModelFile is the name of the file the models are written into
+	ModelFile = "model.go"
+)
+
+// WriteModule writes the go.mod of the test module with the given go version
+func WriteModule(goVersion string) error {
+	err := os.MkdirAll(ModuleDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(ModuleDir, "go.mod"), []byte("module "+ModulePath+"\n\ngo "+goVersion+"\n"), 0644)
+}
+
+// CopyModule copies the go.mod and go.sum from the directory into the test
+// module, e.g. for modules with requirements kept in testdata
+func CopyModule(dir string) error {
+	err := os.MkdirAll(ModuleDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []string{"go.mod", "go.sum"} {
+		err := cp.File(filepath.Join(dir, name), filepath.Join(ModuleDir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WritePackage writes the fixture file as the models of the package, with
+// the package clause changed to the package name
+func WritePackage(pkgName, fixtureFile string) error {
+	src, err := ioutil.ReadFile(fixtureFile)
+	if err != nil {
+		return err
+	}
+
+	src, err = plugins.RewritePackage(fixtureFile, src, pkgName, nil)
+	if err != nil {
+		return errors.Wrap(err, fixtureFile)
+	}
+
+	err = os.MkdirAll(Dir(pkgName), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(Dir(pkgName), ModelFile), src, 0644)
+}
+
+// WriteFile writes the source as the file of the package
+func WriteFile(pkgName, name, src string) error {
+	err := os.MkdirAll(Dir(pkgName), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(Dir(pkgName), name), []byte(src), 0644)
+}
+
+// Dir returns the directory of the package within the test module
+func Dir(pkgName string) string {
+	return filepath.Join(ModuleDir, pkgName)
+}
+
+// Package returns the package written by WritePackage
+func Package(pkgName string) *packages.Package {
+	return &packages.Package{
+		Name:    pkgName,
+		PkgPath: ModulePath + "/" + pkgName,
+		GoFiles: []string{filepath.Join(Dir(pkgName), ModelFile)},
+	}
+}
+
+// Models returns the reflected models as if they were loaded from the package
+func Models(pkgName string, models ...interface{}) mirror.StructSlice {
+	return mirror.ReflectStructs(models...).Each(func(st *mirror.Struct) {
+		st.OriginalPackage = ModulePath + "/" + pkgName
+		st.OriginalPackageName = pkgName
+	})
+}
+
+// GoTest runs the tests of the test module offline. The output of the go
+// tool is returned within the error when they fail
+func GoTest() error {
+	cmd := exec.Command("go", "test", "./...")
+	cmd.Dir = ModuleDir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrap(err, string(output))
+	}
+
+	return nil
+}
+
+// Clean removes the test module
+func Clean() error {
+	return os.RemoveAll(ModuleDir)
+}
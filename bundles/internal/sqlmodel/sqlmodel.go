@@ -0,0 +1,83 @@
+// Package sqlmodel maps the models to the SQL tables the same way for
+// the sql and repository bundles
+package sqlmodel
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrUnknownDialect  = errors.New("The SQL dialect is not supported, use postgres, mysql or sqlite")
+	ErrNoPrimaryKey    = errors.New("The model has no primary key, mark its columns by the pk option of the db tag")
+	ErrDuplicateColumn = errors.New("The column name is used by multiple fields of the model")
+)
+
+// TagKey is the key of the struct tag with the column options of the field,
+// e.g. db:"user_id,pk". The name is followed by the options: pk makes the
+// column a part of the primary key, index and unique index the column, named
+// ones (index=name) index the columns of all fields with the name, default=X
+// sets the SQL default and type=X the column type. db:"-" skips the field.
+// The repository bundle uses only the name and the pk option
+const TagKey = "db"
+
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+	SQLite   = "sqlite"
+)
+
+// quotes are the identifier quotes of the dialects
+var quotes = map[string]string{
+	Postgres: `"`,
+	MySQL:    "`",
+	SQLite:   `"`,
+}
+
+// CheckDialect returns ErrUnknownDialect if the dialect is not supported
+func CheckDialect(dialect string) error {
+	if _, ok := quotes[dialect]; !ok {
+		return errors.Wrap(ErrUnknownDialect, dialect)
+	}
+
+	return nil
+}
+
+// Quote quotes the identifier in the dialect, see CheckDialect
+func Quote(dialect, name string) string {
+	quote := quotes[dialect]
+	return quote + strings.Replace(name, quote, quote+quote, -1) + quote
+}
+
+// TableName returns the table of the model. Its name is returned by the TableName
+// method of the model if it has one, the model name in the snake case otherwise
+func TableName(rs *mirror.Struct) string {
+	if namer, ok := reflect.New(rs.Type()).Interface().(interface{ TableName() string }); ok {
+		return namer.TableName()
+	}
+
+	return SnakeCase(rs.Name())
+}
+
+// SnakeCase returns the name in the snake case, e.g. user_id for UserID
+func SnakeCase(name string) string {
+	runes := []rune(name)
+
+	b := &strings.Builder{}
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// words start by upper letters, acronyms end before the last of their letters
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+				b.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
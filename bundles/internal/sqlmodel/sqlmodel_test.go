@@ -0,0 +1,55 @@
+package sqlmodel
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type UserAccount struct{}
+
+type Order struct{}
+
+func (Order) TableName() string {
+	return "orders"
+}
+
+type SqlModelSuite struct {
+	suite.Suite
+}
+
+func (s *SqlModelSuite) TestSnakeCase() {
+	for name, expected := range map[string]string{
+		"User":      "user",
+		"UserID":    "user_id",
+		"HTTPProxy": "http_proxy",
+		"Address2":  "address2",
+		"V2Name":    "v2_name",
+	} {
+		s.EqualValues(expected, SnakeCase(name))
+	}
+}
+
+func (s *SqlModelSuite) TestQuote() {
+	s.EqualValues(`"user"`, Quote(Postgres, "user"))
+	s.EqualValues(`"a""b"`, Quote(SQLite, `a"b`))
+	s.EqualValues("`a``b`", Quote(MySQL, "a`b"))
+}
+
+func (s *SqlModelSuite) TestCheckDialect() {
+	for _, d := range []string{Postgres, MySQL, SQLite} {
+		s.NoError(CheckDialect(d))
+	}
+
+	s.EqualValues(ErrUnknownDialect, errors.Cause(CheckDialect("oracle")))
+}
+
+func (s *SqlModelSuite) TestTableName() {
+	s.EqualValues("user_account", TableName(mirror.ReflectStruct(&UserAccount{})))
+	s.EqualValues("orders", TableName(mirror.ReflectStruct(&Order{})))
+}
+
+func TestSqlModelSuite(t *testing.T) {
+	suite.Run(t, &SqlModelSuite{})
+}
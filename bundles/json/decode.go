@@ -0,0 +1,307 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// decoder writes statements of the decodeJSON reading the values from
+// the lexer l. All decoded expressions are addressable
+type decoder struct {
+	*mirror.Code
+
+	generated map[reflect.Type]bool
+}
+
+// decodeModel writes the body of the decodeJSON of the model
+func (d *decoder) decodeModel() {
+	t := d.Model.Type()
+	if t.Kind() != reflect.Struct {
+		d.decodeKind(t, "(*in)", false, 1)
+		return
+	}
+
+	d.Line(1, "if l.null() {")
+	d.Line(2, "return nil")
+	d.Line(1, "}")
+	d.decodeStruct(t, "in", 1)
+}
+
+// decodeValue decodes the value by its unmarshaler if it has one
+func (d *decoder) decodeValue(t reflect.Type, x string, quoted bool, depth int) {
+	switch {
+	case d.generated[t]:
+		d.Line(depth, "if err := %s.decodeJSON(l); err != nil {", mirror.Paren(x))
+		d.Line(depth+1, "return err")
+		d.Line(depth, "}")
+	case t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface:
+		d.decodeKind(t, x, quoted, depth)
+	case implements(t, unmarshalerType):
+		d.Line(depth, "if raw, err := l.raw(); err != nil {")
+		d.Line(depth+1, "return err")
+		d.Line(depth, "} else if err := %s.UnmarshalJSON(raw); err != nil {", mirror.Paren(x))
+		d.Line(depth+1, "return err")
+		d.Line(depth, "}")
+	case implements(t, textUnmarshalerType):
+		d.Line(depth, "if !l.null() {")
+		d.Line(depth+1, "if s, err := l.str(); err != nil {")
+		d.Line(depth+2, "return err")
+		d.Line(depth+1, "} else if err := %s.UnmarshalText([]byte(s)); err != nil {", mirror.Paren(x))
+		d.Line(depth+2, "return err")
+		d.Line(depth+1, "}")
+		d.Line(depth, "}")
+	default:
+		d.decodeKind(t, x, quoted, depth)
+	}
+}
+
+// decodeKind decodes the value by the kind of the type. Nulls leave the
+// values untouched, except for the nillable ones, which are set to nil
+func (d *decoder) decodeKind(t reflect.Type, x string, quoted bool, depth int) {
+	if !d.Accessible(t, jsonField) || !d.Enter(t) {
+		d.unmarshal(x, depth)
+		return
+	}
+	defer d.Leave(t)
+
+	switch t.Kind() {
+	case reflect.Bool:
+		d.scalar(t, x, "l.bool()", quoted, depth)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		d.scalar(t, x, "l.int("+bits(t)+")", quoted, depth)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		d.scalar(t, x, "l.uint("+bits(t)+")", quoted, depth)
+	case reflect.Float32, reflect.Float64:
+		d.scalar(t, x, "l.float("+bits(t)+")", quoted, depth)
+	case reflect.String:
+		d.scalar(t, x, "l.str()", quoted, depth)
+
+	case reflect.Ptr:
+		d.Line(depth, "if l.null() {")
+		d.Line(depth+1, "%s = nil", x)
+		d.Line(depth, "} else {")
+		d.Line(depth+1, "if %s == nil {", x)
+		d.Line(depth+2, "%s = new(%s)", x, d.Type(t.Elem()))
+		d.Line(depth+1, "}")
+		d.decodeValue(t.Elem(), "(*"+x+")", quoted, depth+1)
+		d.Line(depth, "}")
+
+	case reflect.Slice:
+		switch {
+		case bytesSlice(t) && t.Elem() != byteType:
+			d.unmarshal(x, depth)
+		case bytesSlice(t):
+			d.Imports = append(d.Imports, "encoding/base64")
+			d.Line(depth, "if l.null() {")
+			d.Line(depth+1, "%s = nil", x)
+			d.Line(depth, "} else if s, err := l.str(); err != nil {")
+			d.Line(depth+1, "return err")
+			d.Line(depth, "} else if b, err := base64.StdEncoding.DecodeString(s); err != nil {")
+			d.Line(depth+1, "return err")
+			d.Line(depth, "} else {")
+			d.Line(depth+1, "%s = %s(b)", x, d.Type(t))
+			d.Line(depth, "}")
+		default:
+			d.decodeSlice(t, x, depth)
+		}
+
+	case reflect.Array:
+		d.decodeArray(t, x, depth)
+
+	case reflect.Map:
+		if !stringKey(t.Key()) && !intKey(t.Key()) || implements(t.Key(), textUnmarshalerType) {
+			d.unmarshal(x, depth)
+			return
+		}
+		d.decodeMap(t, x, depth)
+
+	case reflect.Struct:
+		d.Line(depth, "if !l.null() {")
+		d.decodeStruct(t, x, depth+1)
+		d.Line(depth, "}")
+
+	default:
+		d.unmarshal(x, depth)
+	}
+}
+
+// scalar decodes the value read by the read expression, quoted values are
+// read by the lexer of the string contents
+func (d *decoder) scalar(t reflect.Type, x, read string, quoted bool, depth int) {
+	v := d.Var("v")
+
+	d.Line(depth, "if !l.null() {")
+	if quoted {
+		d.Line(depth+1, "q, err := l.quoted()")
+		d.Line(depth+1, "if err != nil {")
+		d.Line(depth+2, "return err")
+		d.Line(depth+1, "}")
+		d.Line(depth+1, "l := q")
+	}
+
+	d.Line(depth+1, "%s, err := %s", v, read)
+	d.Line(depth+1, "if err != nil {")
+	d.Line(depth+2, "return err")
+	d.Line(depth+1, "}")
+	if quoted {
+		d.Line(depth+1, "if err := l.end(); err != nil {")
+		d.Line(depth+2, "return err")
+		d.Line(depth+1, "}")
+	}
+	d.Line(depth+1, "%s = %s(%s)", x, d.Type(t), v)
+	d.Line(depth, "}")
+}
+
+// decodeSlice decodes the elements of the slice into its existing elements
+// first, like the encoding/json does, and appends the rest
+func (d *decoder) decodeSlice(t reflect.Type, x string, depth int) {
+	s, i, zero := d.Var("s"), d.Var("i"), d.Var("zero")
+
+	d.Line(depth, "if l.null() {")
+	d.Line(depth+1, "%s = nil", x)
+	d.Line(depth, "} else {")
+	d.Line(depth+1, "%s, %s := %s, 0", s, i, x)
+	d.Line(depth+1, "if err := l.array(func() error {")
+	d.Line(depth+2, "if %s >= len(%s) {", i, s)
+	d.Line(depth+3, "var %s %s", zero, d.Type(t.Elem()))
+	d.Line(depth+3, "%s = append(%s, %s)", s, s, zero)
+	d.Line(depth+2, "}")
+	d.decodeValue(t.Elem(), s+"["+i+"]", false, depth+2)
+	d.Line(depth+2, "%s++", i)
+	d.Line(depth+2, "return nil")
+	d.Line(depth+1, "}); err != nil {")
+	d.Line(depth+2, "return err")
+	d.Line(depth+1, "}")
+	d.Line(depth+1, "if %s = %s[:%s]; %s == nil {", s, s, i, s)
+	d.Line(depth+2, "%s = %s{}", s, d.Type(t))
+	d.Line(depth+1, "}")
+	d.Line(depth+1, "%s = %s", x, s)
+	d.Line(depth, "}")
+}
+
+// decodeArray decodes the elements of the array, skipping the extra
+// elements and zeroing the missing ones
+func (d *decoder) decodeArray(t reflect.Type, x string, depth int) {
+	i, zero := d.Var("i"), d.Var("zero")
+
+	d.Line(depth, "if !l.null() {")
+	d.Line(depth+1, "%s := 0", i)
+	d.Line(depth+1, "if err := l.array(func() error {")
+	d.Line(depth+2, "if %s >= len(%s) {", i, x)
+	d.Line(depth+3, "return l.skip()")
+	d.Line(depth+2, "}")
+	d.decodeValue(t.Elem(), x+"["+i+"]", false, depth+2)
+	d.Line(depth+2, "%s++", i)
+	d.Line(depth+2, "return nil")
+	d.Line(depth+1, "}); err != nil {")
+	d.Line(depth+2, "return err")
+	d.Line(depth+1, "}")
+	d.Line(depth+1, "var %s %s", zero, d.Type(t.Elem()))
+	d.Line(depth+1, "for ; %s < len(%s); %s++ {", i, x, i)
+	d.Line(depth+2, "%s[%s] = %s", x, i, zero)
+	d.Line(depth+1, "}")
+	d.Line(depth, "}")
+}
+
+// decodeMap decodes the entries into the map, which is created if it is nil
+func (d *decoder) decodeMap(t reflect.Type, x string, depth int) {
+	v := d.Var("v")
+
+	d.Line(depth, "if l.null() {")
+	d.Line(depth+1, "%s = nil", x)
+	d.Line(depth, "} else {")
+	d.Line(depth+1, "if %s == nil {", x)
+	d.Line(depth+2, "%s = make(%s)", x, d.Type(t))
+	d.Line(depth+1, "}")
+	d.Line(depth+1, "if err := l.object(func(key string) error {")
+	d.Line(depth+2, "var %s %s", v, d.Type(t.Elem()))
+	d.decodeValue(t.Elem(), v, false, depth+2)
+
+	key := t.Key()
+	switch {
+	case stringKey(key):
+		d.Line(depth+2, "%s[%s(key)] = %s", x, d.Type(key), v)
+	default:
+		parse := "strconv.ParseUint(key, 10, " + bits(key) + ")"
+		if key.Kind() >= reflect.Int && key.Kind() <= reflect.Int64 {
+			parse = "strconv.ParseInt(key, 10, " + bits(key) + ")"
+		}
+
+		k := d.Var("k")
+		d.Line(depth+2, "%s, err := %s", k, parse)
+		d.Line(depth+2, "if err != nil {")
+		d.Line(depth+3, "return err")
+		d.Line(depth+2, "}")
+		d.Line(depth+2, "%s[%s(%s)] = %s", x, d.Type(key), k, v)
+	}
+
+	d.Line(depth+2, "return nil")
+	d.Line(depth+1, "}); err != nil {")
+	d.Line(depth+2, "return err")
+	d.Line(depth+1, "}")
+	d.Line(depth, "}")
+}
+
+// decodeStruct decodes the JSON fields of the struct, matching the keys
+// exactly first and case-insensitively second. Unknown keys are skipped
+func (d *decoder) decodeStruct(t reflect.Type, x string, depth int) {
+	fs := fields(t)
+
+	d.Line(depth, "if err := l.object(func(key string) error {")
+	if len(fs) == 0 {
+		d.Line(depth+1, "return l.skip()")
+	} else {
+		names := make([]string, len(fs))
+		for i, f := range fs {
+			names[i] = strconv.Quote(f.name)
+		}
+
+		d.Line(depth+1, "switch jsonMatch(key, []string{%s}) {", strings.Join(names, ", "))
+		for i, f := range fs {
+			d.Line(depth+1, "case %d:", i)
+
+			// embedded pointers of the promoted fields are allocated
+			ex := x
+			for _, sf := range f.path[:len(f.path)-1] {
+				ex += "." + sf.Name
+				if sf.Type.Kind() == reflect.Ptr {
+					d.Line(depth+2, "if %s == nil {", ex)
+					d.Line(depth+3, "%s = new(%s)", ex, d.Type(sf.Type.Elem()))
+					d.Line(depth+2, "}")
+				}
+			}
+
+			d.decodeValue(f.typ, fieldExpr(f, x), f.quoted, depth+2)
+		}
+		d.Line(depth+1, "default:")
+		d.Line(depth+2, "return l.skip()")
+		d.Line(depth+1, "}")
+		d.Line(depth+1, "return nil")
+	}
+	d.Line(depth, "}); err != nil {")
+	d.Line(depth+1, "return err")
+	d.Line(depth, "}")
+}
+
+// unmarshal decodes values the generated code can't walk, e.g. interfaces
+func (d *decoder) unmarshal(x string, depth int) {
+	d.Imports = append(d.Imports, "encoding/json")
+	d.Line(depth, "if raw, err := l.raw(); err != nil {")
+	d.Line(depth+1, "return err")
+	d.Line(depth, "} else if err := json.Unmarshal(raw, &%s); err != nil {", x)
+	d.Line(depth+1, "return err")
+	d.Line(depth, "}")
+}
+
+// bits returns the bit size of the parsed number, zero for the sizes
+// depending on the platform
+func bits(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		return "0"
+	}
+
+	return strconv.Itoa(t.Bits())
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"github.com/petomalina/mirror"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// encoder writes statements of the encodeJSON writing the values into buf.
+// All encoded expressions are addressable, so methods of pointers are called
+type encoder struct {
+	*mirror.Code
+
+	generated map[reflect.Type]bool
+}
+
+var (
+	marshalerType       = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// encodeModel writes the body of the encodeJSON of the model
+func (e *encoder) encodeModel() {
+	t := e.Model.Type()
+	if t.Kind() != reflect.Struct {
+		e.encodeKind(t, "(*in)", false, 1)
+		return
+	}
+
+	e.encodeStruct(t, "in", 1)
+}
+
+// encodeValue encodes the value by its marshaler if it has one
+func (e *encoder) encodeValue(t reflect.Type, x string, quoted bool, depth int) {
+	switch {
+	case e.generated[t]:
+		e.Line(depth, "if err := %s.encodeJSON(buf); err != nil {", mirror.Paren(x))
+		e.Line(depth+1, "return err")
+		e.Line(depth, "}")
+	case t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface:
+		e.encodeKind(t, x, quoted, depth)
+	case implements(t, marshalerType):
+		e.Imports = append(e.Imports, "encoding/json")
+		e.Line(depth, "if b, err := %s.MarshalJSON(); err != nil {", mirror.Paren(x))
+		e.Line(depth+1, "return err")
+		e.Line(depth, "} else if err := json.Compact(buf, b); err != nil {")
+		e.Line(depth+1, "return err")
+		e.Line(depth, "}")
+	case implements(t, textMarshalerType):
+		e.Line(depth, "if b, err := %s.MarshalText(); err != nil {", mirror.Paren(x))
+		e.Line(depth+1, "return err")
+		e.Line(depth, "} else {")
+		e.Line(depth+1, "jsonString(buf, string(b))")
+		e.Line(depth, "}")
+	default:
+		e.encodeKind(t, x, quoted, depth)
+	}
+}
+
+// encodeKind encodes the value by the kind of the type
+func (e *encoder) encodeKind(t reflect.Type, x string, quoted bool, depth int) {
+	if !e.Accessible(t, jsonField) || !e.Enter(t) {
+		e.marshal(x, depth)
+		return
+	}
+	defer e.Leave(t)
+
+	switch t.Kind() {
+	case reflect.Bool:
+		e.quote(quoted, depth, func() {
+			e.Line(depth, "jsonBool(buf, bool(%s))", x)
+		})
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.quote(quoted, depth, func() {
+			e.Line(depth, "jsonInt(buf, int64(%s))", x)
+		})
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.quote(quoted, depth, func() {
+			e.Line(depth, "jsonUint(buf, uint64(%s))", x)
+		})
+	case reflect.Float32, reflect.Float64:
+		e.quote(quoted, depth, func() {
+			e.Line(depth, "if err := jsonFloat(buf, float64(%s), %d); err != nil {", x, t.Bits())
+			e.Line(depth+1, "return err")
+			e.Line(depth, "}")
+		})
+	case reflect.String:
+		if quoted {
+			e.Line(depth, "jsonQuoted(buf, string(%s))", x)
+		} else {
+			e.Line(depth, "jsonString(buf, string(%s))", x)
+		}
+
+	case reflect.Ptr:
+		e.Line(depth, "if %s == nil {", x)
+		e.Line(depth+1, `buf.WriteString("null")`)
+		e.Line(depth, "} else {")
+		e.encodeValue(t.Elem(), "(*"+x+")", quoted, depth+1)
+		e.Line(depth, "}")
+
+	case reflect.Slice:
+		e.Line(depth, "if %s == nil {", x)
+		e.Line(depth+1, `buf.WriteString("null")`)
+		e.Line(depth, "} else {")
+		switch {
+		case bytesSlice(t) && t.Elem() != byteType:
+			// named bytes can't be converted to a byte slice
+			e.marshal(x, depth+1)
+		case bytesSlice(t):
+			e.Imports = append(e.Imports, "encoding/base64")
+			e.Line(depth+1, "buf.WriteByte('\"')")
+			e.Line(depth+1, "buf.WriteString(base64.StdEncoding.EncodeToString([]byte(%s)))", x)
+			e.Line(depth+1, "buf.WriteByte('\"')")
+		default:
+			e.encodeElems(t, x, depth+1)
+		}
+		e.Line(depth, "}")
+
+	case reflect.Array:
+		e.encodeElems(t, x, depth)
+
+	case reflect.Map:
+		if !stringKey(t.Key()) && !intKey(t.Key()) || implements(t.Key(), textMarshalerType) && t.Key().Kind() != reflect.String {
+			e.marshal(x, depth)
+			return
+		}
+		e.encodeMap(t, x, depth)
+
+	case reflect.Struct:
+		e.encodeStruct(t, x, depth)
+
+	default:
+		e.marshal(x, depth)
+	}
+}
+
+// encodeElems encodes the elements of the slice or array
+func (e *encoder) encodeElems(t reflect.Type, x string, depth int) {
+	i := e.Var("i")
+
+	e.Line(depth, "buf.WriteByte('[')")
+	e.Line(depth, "for %s := range %s {", i, x)
+	e.Line(depth+1, "if %s > 0 {", i)
+	e.Line(depth+2, "buf.WriteByte(',')")
+	e.Line(depth+1, "}")
+	e.encodeValue(t.Elem(), x+"["+i+"]", false, depth+1)
+	e.Line(depth, "}")
+	e.Line(depth, "buf.WriteByte(']')")
+}
+
+// encodeMap encodes the entries of the map sorted by their keys
+func (e *encoder) encodeMap(t reflect.Type, x string, depth int) {
+	keys, i, k, v := e.Var("keys"), e.Var("i"), e.Var("k"), e.Var("v")
+
+	e.Imports = append(e.Imports, "sort")
+	e.Line(depth, "if %s == nil {", x)
+	e.Line(depth+1, `buf.WriteString("null")`)
+	e.Line(depth, "} else {")
+	e.Line(depth+1, "%s := make([]%s, 0, len(%s))", keys, e.Type(t.Key()), x)
+	e.Line(depth+1, "for %s := range %s {", k, x)
+	e.Line(depth+2, "%s = append(%s, %s)", keys, keys, k)
+	e.Line(depth+1, "}")
+
+	// keys are sorted as strings, like the encoding/json does
+	if stringKey(t.Key()) {
+		e.Line(depth+1, "sort.Slice(%s, func(i, j int) bool { return %s[i] < %s[j] })", keys, keys, keys)
+	} else {
+		e.Line(depth+1, "sort.Slice(%s, func(i, j int) bool { return %s < %s })", keys, formatKey(t.Key(), keys+"[i]"), formatKey(t.Key(), keys+"[j]"))
+	}
+
+	e.Line(depth+1, "buf.WriteByte('{')")
+	e.Line(depth+1, "for %s, %s := range %s {", i, k, keys)
+	e.Line(depth+2, "if %s > 0 {", i)
+	e.Line(depth+3, "buf.WriteByte(',')")
+	e.Line(depth+2, "}")
+	e.Line(depth+2, "jsonString(buf, %s)", formatKey(t.Key(), k))
+	e.Line(depth+2, "buf.WriteByte(':')")
+	e.Line(depth+2, "%s := %s[%s]", v, x, k)
+	e.encodeValue(t.Elem(), v, false, depth+2)
+	e.Line(depth+1, "}")
+	e.Line(depth+1, "buf.WriteByte('}')")
+	e.Line(depth, "}")
+}
+
+// encodeStruct encodes the JSON fields of the struct, commas are written
+// by a flag if some of the fields may be omitted
+func (e *encoder) encodeStruct(t reflect.Type, x string, depth int) {
+	fs := fields(t)
+
+	first := ""
+	for _, f := range fs {
+		if f.omitEmpty || len(nilChecks(f, x)) > 0 {
+			first = e.Var("first")
+			break
+		}
+	}
+
+	e.Line(depth, "buf.WriteByte('{')")
+	if first != "" {
+		e.Line(depth, "%s := true", first)
+	}
+
+	for i, f := range fs {
+		fx := fieldExpr(f, x)
+
+		conds := nilChecks(f, x)
+		if f.omitEmpty {
+			if cond := nonEmpty(f.typ, fx); cond != "" {
+				conds = append(conds, cond)
+			}
+		}
+
+		d := depth
+		if len(conds) > 0 {
+			e.Line(d, "if %s {", strings.Join(conds, " && "))
+			d++
+		}
+
+		key := jsonKey(f.name)
+		switch {
+		case first != "":
+			e.Line(d, "if !%s {", first)
+			e.Line(d+1, "buf.WriteByte(',')")
+			e.Line(d, "}")
+			e.Line(d, "%s = false", first)
+		case i > 0:
+			key = "," + key
+		}
+		e.Line(d, "buf.WriteString(%s)", strconv.Quote(key))
+		e.encodeValue(f.typ, fx, f.quoted, d)
+
+		if len(conds) > 0 {
+			e.Line(depth, "}")
+		}
+	}
+
+	e.Line(depth, "buf.WriteByte('}')")
+}
+
+// quote writes the value written by the fn as a string if it is quoted
+func (e *encoder) quote(quoted bool, depth int, fn func()) {
+	if quoted {
+		e.Line(depth, "buf.WriteByte('\"')")
+	}
+	fn()
+	if quoted {
+		e.Line(depth, "buf.WriteByte('\"')")
+	}
+}
+
+// marshal encodes values the generated code can't walk, e.g. interfaces
+func (e *encoder) marshal(x string, depth int) {
+	e.Imports = append(e.Imports, "encoding/json")
+	e.Line(depth, "if b, err := json.Marshal(&%s); err != nil {", x)
+	e.Line(depth+1, "return err")
+	e.Line(depth, "} else {")
+	e.Line(depth+1, "buf.Write(b)")
+	e.Line(depth, "}")
+}
+
+// fieldExpr returns the expression of the field, selected through the embedded structs
+func fieldExpr(f field, x string) string {
+	for _, sf := range f.path {
+		x += "." + sf.Name
+	}
+
+	return x
+}
+
+// nilChecks returns the conditions of the embedded pointers the field is promoted through
+func nilChecks(f field, x string) []string {
+	var conds []string
+	for _, sf := range f.path[:len(f.path)-1] {
+		x += "." + sf.Name
+		if sf.Type.Kind() == reflect.Ptr {
+			conds = append(conds, x+" != nil")
+		}
+	}
+
+	return conds
+}
+
+// nonEmpty returns the condition of the value not being empty for the omitempty
+func nonEmpty(t reflect.Type, x string) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return x
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return x + " != 0"
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return "len(" + x + ") != 0"
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		return x + " != nil"
+	}
+
+	// structs are never empty
+	return ""
+}
+
+// jsonKey returns the encoded key of the field followed by the colon
+func jsonKey(name string) string {
+	b, _ := json.Marshal(name)
+	return string(b) + ":"
+}
+
+// formatKey returns the string expression of the map key
+func formatKey(t reflect.Type, k string) string {
+	switch {
+	case stringKey(t):
+		return "string(" + k + ")"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		return "strconv.FormatInt(int64(" + k + "), 10)"
+	}
+
+	return "strconv.FormatUint(uint64(" + k + "), 10)"
+}
+
+func stringKey(t reflect.Type) bool {
+	return t.Kind() == reflect.String
+}
+
+func intKey(t reflect.Type) bool {
+	return t.Kind() >= reflect.Int && t.Kind() <= reflect.Uintptr
+}
+
+var byteType = reflect.TypeOf(byte(0))
+
+// bytesSlice returns true for slices encoded as base64 strings
+func bytesSlice(t reflect.Type) bool {
+	return t.Elem().Kind() == reflect.Uint8 &&
+		!implements(t.Elem(), marshalerType) && !implements(t.Elem(), textMarshalerType)
+}
+
+// implements returns true if the type or the pointer to it implements the interface
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(iface)
+}
+
+// jsonField filters the fields walked by the generated code
+func jsonField(f reflect.StructField) bool {
+	return f.Anonymous || f.PkgPath == "" && f.Tag.Get("json") != "-"
+}
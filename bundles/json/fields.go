@@ -0,0 +1,195 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// field is a JSON field of a struct, as encoding/json resolves it
+type field struct {
+	name string
+
+	// path are the struct fields leading to the field, the embedded ones
+	// followed by the field itself
+	path []reflect.StructField
+	typ  reflect.Type
+
+	tagged    bool
+	omitEmpty bool
+	quoted    bool
+}
+
+// fields returns the JSON fields of the struct in the order of encoding/json.
+// Fields of embedded structs without names are flattened into the struct,
+// the shallower and tagged ones dominating the others of the same name
+func fields(t reflect.Type) []field {
+	current := []field{}
+	next := []field{{typ: t}}
+
+	count, nextCount := map[reflect.Type]int{}, map[reflect.Type]int{}
+	visited := map[reflect.Type]bool{}
+
+	var all []field
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, f := range current {
+			if visited[f.typ] {
+				continue
+			}
+			visited[f.typ] = true
+
+			for i := 0; i < f.typ.NumField(); i++ {
+				sf := f.typ.Field(i)
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if sf.PkgPath != "" {
+					continue
+				}
+
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+
+				name, opts := parseTag(tag)
+				if !validName(name) {
+					name = ""
+				}
+
+				path := append(append([]reflect.StructField{}, f.path...), sf)
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+
+				quoted := false
+				if containsOption(opts, "string") {
+					switch ft.Kind() {
+					case reflect.Bool, reflect.String,
+						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+						reflect.Float32, reflect.Float64:
+						quoted = true
+					}
+				}
+
+				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
+					tagged := name != ""
+					if name == "" {
+						name = sf.Name
+					}
+
+					all = append(all, field{
+						name:      name,
+						path:      path,
+						typ:       sf.Type,
+						tagged:    tagged,
+						omitEmpty: containsOption(opts, "omitempty"),
+						quoted:    quoted,
+					})
+
+					// the duplicate annihilates the fields of structs embedded multiple times
+					if count[f.typ] > 1 {
+						all = append(all, all[len(all)-1])
+					}
+					continue
+				}
+
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, field{name: ft.Name(), path: path, typ: ft})
+				}
+			}
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		x, y := all[i], all[j]
+		if x.name != y.name {
+			return x.name < y.name
+		}
+		if len(x.path) != len(y.path) {
+			return len(x.path) < len(y.path)
+		}
+		if x.tagged != y.tagged {
+			return x.tagged
+		}
+		return lessIndex(x.path, y.path)
+	})
+
+	dominant := all[:0]
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].name == all[i].name {
+			j++
+		}
+
+		// fields of the same depth and tagging are ambiguous and dropped
+		if j-i == 1 || len(all[i].path) < len(all[i+1].path) || all[i].tagged && !all[i+1].tagged {
+			dominant = append(dominant, all[i])
+		}
+		i = j
+	}
+
+	sort.Slice(dominant, func(i, j int) bool {
+		return lessIndex(dominant[i].path, dominant[j].path)
+	})
+
+	return dominant
+}
+
+func lessIndex(a, b []reflect.StructField) bool {
+	for i := range a {
+		if i >= len(b) {
+			return false
+		}
+		if a[i].Index[0] != b[i].Index[0] {
+			return a[i].Index[0] < b[i].Index[0]
+		}
+	}
+
+	return len(a) < len(b)
+}
+
+func parseTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+func containsOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validName returns true for names encoding/json accepts in tags
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+
+	return true
+}
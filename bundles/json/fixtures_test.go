@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Celsius float64
+
+func (c Celsius) MarshalJSON() ([]byte, error) {
+	return []byte(" " + strconv.FormatFloat(float64(c), 'f', 1, 64) + " "), nil
+}
+
+func (c *Celsius) UnmarshalJSON(b []byte) error {
+	f, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	*c = Celsius(f)
+	return err
+}
+
+type Level int
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(strings.Repeat("+", int(l))), nil
+}
+
+func (l *Level) UnmarshalText(b []byte) error {
+	*l = Level(len(b))
+	return nil
+}
+
+type Base struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+type Meta struct {
+	Source  string
+	Version int `json:"version,string"`
+}
+
+type Item struct {
+	Name  string   `json:"name"`
+	Price float64  `json:"price,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type Order struct {
+	Base
+	*Meta
+	Customer string           `json:"customer"`
+	Note     string           `json:"note,omitempty"`
+	Count    int64            `json:"count,string"`
+	Paid     bool             `json:"paid,string"`
+	Code     string           `json:"code,string"`
+	Items    []Item           `json:"items"`
+	Ptr      *Item            `json:"ptr"`
+	Lookup   map[string]*Item `json:"lookup,omitempty"`
+	Counts   map[int]uint8    `json:"counts"`
+	Temp     Celsius          `json:"temp"`
+	Level    Level            `json:"level"`
+	Levels   map[Level]int    `json:"levels"`
+	Data     []byte           `json:"data"`
+	Grid     [2]int           `json:"grid"`
+	Extra    interface{}      `json:"extra"`
+	Ratio    float32          `json:"ratio"`
+	Raw      json.RawMessage  `json:"raw"`
+	Skip     string           `json:"-"`
+	Dash     string           `json:"-,"`
+	Nested   *Order           `json:"nested,omitempty"`
+	secret   string
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+	"log"
+	"reflect"
+	"text/template"
+)
+
+var (
+	ErrOutsideOfPackage = errors.New("JSON methods can be generated only into the package of the models")
+)
+
+// helpersTemplate are the functions shared by the generated methods. Strings
+// and floats are written the same way the encoding/json writes them
+var helpersTemplate = template.Must(template.New("helpers").Parse(`
+const jsonHex = "0123456789abcdef"
+
+func jsonString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+
+			buf.WriteString(s[start:i])
+			switch b {
+			case '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case '\b':
+				buf.WriteString("\\b")
+			case '\f':
+				buf.WriteString("\\f")
+			case '\n':
+				buf.WriteString("\\n")
+			case '\r':
+				buf.WriteString("\\r")
+			case '\t':
+				buf.WriteString("\\t")
+			default:
+				buf.WriteString("\\u00")
+				buf.WriteByte(jsonHex[b>>4])
+				buf.WriteByte(jsonHex[b&0xF])
+			}
+
+			i++
+			start = i
+			continue
+		}
+
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			buf.WriteString(s[start:i])
+			buf.WriteString("\\ufffd")
+			i += size
+			start = i
+			continue
+		}
+
+		if c == '\u2028' || c == '\u2029' {
+			buf.WriteString(s[start:i])
+			buf.WriteString("\\u202")
+			buf.WriteByte(jsonHex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+
+		i += size
+	}
+
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
+
+// jsonQuoted writes the string encoded as a string, for the string option
+func jsonQuoted(buf *bytes.Buffer, s string) {
+	var q bytes.Buffer
+	jsonString(&q, s)
+	jsonString(buf, q.String())
+}
+
+func jsonBool(buf *bytes.Buffer, b bool) {
+	var scratch [8]byte
+	buf.Write(strconv.AppendBool(scratch[:0], b))
+}
+
+func jsonInt(buf *bytes.Buffer, i int64) {
+	var scratch [24]byte
+	buf.Write(strconv.AppendInt(scratch[:0], i, 10))
+}
+
+func jsonUint(buf *bytes.Buffer, u uint64) {
+	var scratch [24]byte
+	buf.Write(strconv.AppendUint(scratch[:0], u, 10))
+}
+
+func jsonFloat(buf *bytes.Buffer, f float64, bits int) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return errors.New("json: unsupported value: " + strconv.FormatFloat(f, 'g', -1, bits))
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	var scratch [64]byte
+	b := strconv.AppendFloat(scratch[:0], f, format, -1, bits)
+
+	// exponents are written without the leading zero, e.g. 1e-7
+	if format == 'e' {
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+
+	buf.Write(b)
+	return nil
+}
+
+// jsonMatch returns the index of the name matching the key, names matching
+// exactly are preferred to the case-insensitive ones. -1 is returned if none matches
+func jsonMatch(key string, names []string) int {
+	for i, name := range names {
+		if name == key {
+			return i
+		}
+	}
+
+	for i, name := range names {
+		if strings.EqualFold(name, key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// jsonLexer reads the values of the JSON data
+type jsonLexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *jsonLexer) fail(context string) error {
+	if l.pos >= len(l.data) {
+		return errors.New("json: unexpected end of JSON input")
+	}
+
+	return errors.New("json: invalid character " + strconv.QuoteRune(rune(l.data[l.pos])) + " " + context)
+}
+
+// peek returns the next byte after the whitespace, 0 at the end of the data
+func (l *jsonLexer) peek() byte {
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case ' ', '\t', '\n', '\r':
+			l.pos++
+		default:
+			return l.data[l.pos]
+		}
+	}
+
+	return 0
+}
+
+func (l *jsonLexer) expect(c byte, context string) error {
+	if l.peek() != c || l.pos >= len(l.data) {
+		return l.fail(context)
+	}
+
+	l.pos++
+	return nil
+}
+
+// end returns an error if anything but whitespace follows
+func (l *jsonLexer) end() error {
+	if l.peek(); l.pos < len(l.data) {
+		return l.fail("after top-level value")
+	}
+
+	return nil
+}
+
+// null reads the null if it is next and returns true
+func (l *jsonLexer) null() bool {
+	if l.peek() == 'n' && bytes.HasPrefix(l.data[l.pos:], []byte("null")) {
+		l.pos += 4
+		return true
+	}
+
+	return false
+}
+
+// token returns the next literal, e.g. a number
+func (l *jsonLexer) token() []byte {
+	l.peek()
+
+	start := l.pos
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case ',', ':', '}', ']', '{', '[', '"', ' ', '\t', '\n', '\r':
+			return l.data[start:l.pos]
+		}
+		l.pos++
+	}
+
+	return l.data[start:l.pos]
+}
+
+func (l *jsonLexer) bool() (bool, error) {
+	switch string(l.token()) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	return false, l.fail("looking for beginning of value")
+}
+
+func (l *jsonLexer) number() (string, error) {
+	t := l.token()
+	if !jsonNumber(t) {
+		return "", l.fail("looking for beginning of value")
+	}
+
+	return string(t), nil
+}
+
+func (l *jsonLexer) int(bits int) (int64, error) {
+	n, err := l.number()
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(n, 10, bits)
+}
+
+func (l *jsonLexer) uint(bits int) (uint64, error) {
+	n, err := l.number()
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(n, 10, bits)
+}
+
+func (l *jsonLexer) float(bits int) (float64, error) {
+	n, err := l.number()
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(n, bits)
+}
+
+// str reads the string, invalid UTF-8 is replaced by the replacement character
+func (l *jsonLexer) str() (string, error) {
+	if err := l.expect('"', "looking for beginning of string"); err != nil {
+		return "", err
+	}
+
+	var s []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return string(s), nil
+
+		case c < ' ':
+			return "", l.fail("in string literal")
+
+		case c == '\\':
+			l.pos++
+			if l.pos >= len(l.data) {
+				return "", l.fail("in string escape code")
+			}
+
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case '"', '\\', '/':
+				s = append(s, e)
+			case 'b':
+				s = append(s, '\b')
+			case 'f':
+				s = append(s, '\f')
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'u':
+				r := l.hex()
+				if r < 0 {
+					return "", l.fail("in \\u hexadecimal character escape")
+				}
+
+				// surrogate pairs are decoded together, lone surrogates are replaced
+				if utf16.IsSurrogate(r) {
+					pos := l.pos
+					r2 := rune(-1)
+					if l.pos+1 < len(l.data) && l.data[l.pos] == '\\' && l.data[l.pos+1] == 'u' {
+						l.pos += 2
+						r2 = l.hex()
+					}
+
+					if dec := utf16.DecodeRune(r, r2); dec != unicode.ReplacementChar {
+						r = dec
+					} else {
+						l.pos = pos
+						r = unicode.ReplacementChar
+					}
+				}
+
+				var rb [utf8.UTFMax]byte
+				s = append(s, rb[:utf8.EncodeRune(rb[:], r)]...)
+			default:
+				l.pos--
+				return "", l.fail("in string escape code")
+			}
+
+		case c < utf8.RuneSelf:
+			s = append(s, c)
+			l.pos++
+
+		default:
+			r, size := utf8.DecodeRune(l.data[l.pos:])
+			if r == utf8.RuneError && size == 1 {
+				s = append(s, "\uFFFD"...)
+			} else {
+				s = append(s, l.data[l.pos:l.pos+size]...)
+			}
+			l.pos += size
+		}
+	}
+
+	return "", l.fail("in string literal")
+}
+
+// hex reads the 4 hexadecimal digits of the \u escape, -1 if they are invalid
+func (l *jsonLexer) hex() rune {
+	if l.pos+4 > len(l.data) {
+		return -1
+	}
+
+	var r rune
+	for _, c := range l.data[l.pos : l.pos+4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c = c - '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return -1
+		}
+		r = r*16 + rune(c)
+	}
+
+	l.pos += 4
+	return r
+}
+
+// quoted returns the lexer of the contents of the string, for the string option
+func (l *jsonLexer) quoted() (*jsonLexer, error) {
+	s, err := l.str()
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonLexer{data: []byte(s)}, nil
+}
+
+// object reads the object, the fn reads the value of the key
+func (l *jsonLexer) object(fn func(key string) error) error {
+	if err := l.expect('{', "looking for beginning of object"); err != nil {
+		return err
+	}
+	if l.peek() == '}' {
+		l.pos++
+		return nil
+	}
+
+	for {
+		key, err := l.str()
+		if err != nil {
+			return err
+		}
+		if err := l.expect(':', "after object key"); err != nil {
+			return err
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+
+		switch l.peek() {
+		case ',':
+			l.pos++
+		case '}':
+			l.pos++
+			return nil
+		default:
+			return l.fail("after object key:value pair")
+		}
+	}
+}
+
+// array reads the array, the fn reads each of its values
+func (l *jsonLexer) array(fn func() error) error {
+	if err := l.expect('[', "looking for beginning of array"); err != nil {
+		return err
+	}
+	if l.peek() == ']' {
+		l.pos++
+		return nil
+	}
+
+	for {
+		if err := fn(); err != nil {
+			return err
+		}
+
+		switch l.peek() {
+		case ',':
+			l.pos++
+		case ']':
+			l.pos++
+			return nil
+		default:
+			return l.fail("after array element")
+		}
+	}
+}
+
+// skip reads the next value without decoding it
+func (l *jsonLexer) skip() error {
+	switch l.peek() {
+	case '{':
+		return l.object(func(string) error {
+			return l.skip()
+		})
+	case '[':
+		return l.array(l.skip)
+	case '"':
+		_, err := l.str()
+		return err
+	}
+
+	switch t := string(l.token()); {
+	case t == "true" || t == "false" || t == "null" || jsonNumber([]byte(t)):
+		return nil
+	}
+
+	return l.fail("looking for beginning of value")
+}
+
+// raw reads the next value and returns its data
+func (l *jsonLexer) raw() ([]byte, error) {
+	l.peek()
+
+	start := l.pos
+	if err := l.skip(); err != nil {
+		return nil, err
+	}
+
+	return l.data[start:l.pos], nil
+}
+
+// jsonNumber returns true if the literal is a valid JSON number
+func jsonNumber(b []byte) bool {
+	digits := func(i int) int {
+		for i < len(b) && '0' <= b[i] && b[i] <= '9' {
+			i++
+		}
+		return i
+	}
+
+	i := 0
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+
+	switch {
+	case i < len(b) && b[i] == '0':
+		i++
+	case i < len(b) && '1' <= b[i] && b[i] <= '9':
+		i = digits(i)
+	default:
+		return false
+	}
+
+	if i < len(b) && b[i] == '.' {
+		if j := digits(i + 1); j > i+1 {
+			i = j
+		} else {
+			return false
+		}
+	}
+
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		if j := digits(i); j > i {
+			i = j
+		} else {
+			return false
+		}
+	}
+
+	return i == len(b)
+}
+`))
+
+var jsonTemplate = template.Must(template.New("json").Parse(`
+// MarshalJSON encodes the {{ .Name }} as JSON without reflection
+func (in {{ .Name }}) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := in.encodeJSON(buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (in *{{ .Name }}) encodeJSON(buf *bytes.Buffer) error {
+{{ .Encode }}
+	return nil
+}
+
+// UnmarshalJSON decodes the {{ .Name }} from JSON without reflection
+func (in *{{ .Name }}) UnmarshalJSON(data []byte) error {
+	l := &jsonLexer{data: data}
+	if err := in.decodeJSON(l); err != nil {
+		return err
+	}
+
+	return l.end()
+}
+
+func (in *{{ .Name }}) decodeJSON(l *jsonLexer) error {
+{{ .Decode }}
+	return nil
+}
+`))
+
+type templateData struct {
+	Name   string
+	Encode string
+	Decode string
+}
+
+func main() {
+	if err := mirror.RunDefaultApp("mirror-json", ProcessModel); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the MarshalJSON and UnmarshalJSON methods for each
+// model following its json tags. Values the generated code can't walk, e.g.
+// interfaces, are handled by the encoding/json. Methods are declared on the
+// models, so they are generated into their package
+func ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
+	temp := out.File("json.go")
+	temp.AddImports("bytes", "errors", "math", "strconv", "strings", "unicode", "unicode/utf16", "unicode/utf8")
+	q := mirror.OutQualifier(out, pkg)
+
+	// models call the generated methods of each other
+	generated := map[reflect.Type]bool{}
+	for _, rs := range models {
+		if rs.Type() != nil {
+			generated[rs.Type()] = true
+		}
+	}
+
+	if err := temp.AddTemplate(helpersTemplate, nil); err != nil {
+		return err
+	}
+
+	for _, rs := range models {
+		if q(rs.PkgPath(), rs.PackageName()) != "" {
+			return errors.Wrap(ErrOutsideOfPackage, rs.Name())
+		}
+
+		enc := &encoder{Code: mirror.NewCode(rs, q), generated: generated}
+		enc.encodeModel()
+
+		dec := &decoder{Code: mirror.NewCode(rs, q), generated: generated}
+		dec.decodeModel()
+
+		temp.AddImports(enc.Imports...)
+		temp.AddImports(dec.Imports...)
+
+		err := temp.AddTemplate(jsonTemplate, &templateData{
+			Name:   rs.Name(),
+			Encode: enc.String(),
+			Decode: dec.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return temp.Write()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"reflect"
+	"testing"
+)
+
+// usageSource compares the generated methods to the encoding/json, which
+// encodes the plain types without the methods
+const usageSource = `package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type plainOrder Order
+
+type plainItem Item
+
+func order() *Order {
+	return &Order{
+		Base:     Base{ID: 7, Created: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)},
+		Meta:     &Meta{Source: "web", Version: 3},
+		Customer: "Jane <jane@example.com> & \"co\"\n\u2028\t",
+		Count:    -42,
+		Paid:     true,
+		Code:     "a\"b",
+		Items:    []Item{{Name: "apple", Price: 1.5}, {Name: "pear", Tags: []string{"fresh"}}},
+		Lookup:   map[string]*Item{"b": {Name: "b"}, "a": nil},
+		Counts:   map[int]uint8{10: 1, 9: 2, -1: 3},
+		Temp:     36.6,
+		Level:    2,
+		Levels:   map[Level]int{1: 1, 3: 3},
+		Data:     []byte("hello"),
+		Grid:     [2]int{1, 2},
+		Extra:    map[string]interface{}{"x": []interface{}{1.0, "y", nil}},
+		Ratio:    0.1,
+		Raw:      json.RawMessage(` + "`{\"raw\": [1, 2]}`" + `),
+		Skip:     "skipped",
+		Dash:     "dash",
+		Nested:   &Order{Customer: "nested", Items: []Item{}, Raw: json.RawMessage("null")},
+		secret:   "secret",
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	empty := &Order{Raw: json.RawMessage("null")}
+	tiny := &Order{Ratio: 1e-7, Counts: map[int]uint8{}, Raw: json.RawMessage("1e21")}
+
+	for i, o := range []*Order{order(), empty, tiny} {
+		got, err := json.Marshal(o)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		want, err := json.Marshal((*plainOrder)(o))
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("%d: marshaled\n%s\nexpected\n%s", i, got, want)
+		}
+
+		decoded, plain := &Order{}, &plainOrder{}
+		if err := json.Unmarshal(got, decoded); err != nil {
+			t.Fatal(i, err)
+		}
+		if err := json.Unmarshal(want, plain); err != nil {
+			t.Fatal(i, err)
+		}
+		if !reflect.DeepEqual(decoded, (*Order)(plain)) {
+			t.Fatalf("%d: unmarshaled\n%#v\nexpected\n%#v", i, decoded, plain)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	inputs := []string{
+		` + "`" + `{
+			"ID": 1, "CUSTOMER": "é😀\ud800x\/", "unknown": {"a": [1, {"b": null}]},
+			"Source": "src", "version": "5", "count": "12", "paid": "false", "code": "\"c\"",
+			"items": [{"name": "x", "price": 2e3}, {"NAME": "y", "tags": null}],
+			"ptr": {"name": "p"}, "lookup": {"k": null}, "counts": {"-5": 1},
+			"temp": 12.5, "level": "+++", "levels": {"++": 2}, "data": "aGk=",
+			"grid": [4, 5, 6], "extra": [true, {"n": 1}], "ratio": 0.25, "raw": {"z": 1},
+			"Skip": "x", "-": "dash", "nested": {"nested": null, "grid": [1]}
+		}` + "`" + `,
+		` + "`" + `{"items": null, "ptr": null, "data": null, "extra": null, "grid": null}` + "`" + `,
+		` + "`" + `null` + "`" + `,
+		"{\"customer\": \"a\xffb\"}",
+	}
+
+	for i, in := range inputs {
+		decoded, plain := order(), (*plainOrder)(order())
+
+		if err := json.Unmarshal([]byte(in), decoded); err != nil {
+			t.Fatal(i, err)
+		}
+		if err := json.Unmarshal([]byte(in), plain); err != nil {
+			t.Fatal(i, err)
+		}
+		if !reflect.DeepEqual(decoded, (*Order)(plain)) {
+			t.Fatalf("%d: unmarshaled\n%#v\nexpected\n%#v", i, decoded, plain)
+		}
+	}
+
+	invalid := []string{` + "`{\"id\": 1.5}`, `{\"id\" 1}`, `{\"count\": 12}`, `[1]`, `{\"customer\": \"x\"} x`, `{\"grid\": [01]}`" + `}
+	for _, in := range invalid {
+		if err := json.Unmarshal([]byte(in), &Order{}); err == nil {
+			t.Fatal("Unmarshaled invalid", in)
+		}
+	}
+}
+
+func TestItem(t *testing.T) {
+	item := Item{Name: "x", Tags: []string{}}
+
+	got, _ := json.Marshal(item)
+	want, _ := json.Marshal(plainItem(item))
+	if string(got) != string(want) {
+		t.Fatalf("marshaled %s, expected %s", got, want)
+	}
+}
+`
+
+type JSONSuite struct {
+	suite.Suite
+}
+
+type JSONCandidate struct {
+	name   string
+	models []interface{}
+	outDir string
+
+	err error
+}
+
+func (s *JSONSuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *JSONSuite) TestProcessModel() {
+	s.NoError(bundletest.WriteModule("1.16"))
+	s.NoError(bundletest.WritePackage("api", "fixtures_test.go"))
+	s.NoError(bundletest.WriteFile("api", "usage_test.go", usageSource))
+
+	models := bundletest.Models("api", &Order{}, &Item{})
+	s.NoError(ProcessModel(models, bundle.NewWriter(bundletest.Dir("api")), bundletest.Package("api")))
+	s.NoError(bundletest.GoTest())
+}
+
+func (s *JSONSuite) TestProcessModelErrors() {
+	candidates := []JSONCandidate{
+		{
+			name:   "Get error for models outside of the out package",
+			models: []interface{}{&Item{}},
+			outDir: bundletest.Dir("out"),
+			err:    ErrOutsideOfPackage,
+		},
+		{
+			name:   "Get error for a described model",
+			models: []interface{}{&plugins.TypeDescription{Name: "Item", Kind: "struct"}},
+			outDir: bundletest.Dir("api"),
+			err:    mirror.ErrDescribedModel,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		err := ProcessModel(bundletest.Models("api", c.models...), bundle.NewWriter(c.outDir), bundletest.Package("api"))
+		s.EqualValues(c.err, errors.Cause(err))
+	}
+}
+
+func (s *JSONSuite) TestFields() {
+	names := []string{}
+	for _, f := range fields(reflect.TypeOf(Order{})) {
+		names = append(names, f.name)
+	}
+
+	s.EqualValues([]string{
+		"id", "created", "Source", "version", "customer", "note", "count", "paid", "code", "items", "ptr",
+		"lookup", "counts", "temp", "level", "levels", "data", "grid", "extra", "ratio", "raw", "-", "nested",
+	}, names)
+}
+
+func TestJSONSuite(t *testing.T) {
+	suite.Run(t, &JSONSuite{})
+}
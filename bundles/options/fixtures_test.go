@@ -0,0 +1,18 @@
+package main
+
+import "time"
+
+type Config struct {
+	Name    string
+	Timeout time.Duration `default:"30s"`
+	Retries int           `default:"3"`
+	Debug   bool          `option:"-"`
+
+	token    string `option:""`
+	internal string
+}
+
+type Server struct {
+	Name string
+	Port uint16 `default:"8080"`
+}
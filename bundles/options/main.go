@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+	"log"
+	"strings"
+	"text/template"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+// TagKey is the key of the struct tag with option settings. option:"-" skips
+// an exported field and any option tag adds an unexported field, which can be
+// set only by options generated into the package of the model
+const TagKey = "option"
+
+// DefaultTagKey is the key of the struct tag with the default value
+// of the field, e.g. default:"30s"
+const DefaultTagKey = "default"
+
+var optionsTemplate = template.Must(template.New("options").Parse(`
+// {{ .Name }}Option configures the {{ .Type }} created by the New{{ .Name }}
+type {{ .Name }}Option func(*{{ .Type }})
+
+// New{{ .Name }} creates the {{ .Type }} with the default values and applies the options
+func New{{ .Name }}(opts ...{{ .Name }}Option) *{{ .Type }} {
+	m := &{{ .Type }}{}
+{{- range .Fields }}{{ if .Default }}
+	m.{{ .Name }} = {{ .Default }}
+{{- end }}{{ end }}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+{{ range .Fields }}
+// {{ .Option }} sets the {{ .Name }} of the {{ $.Name }}
+func {{ .Option }}(x {{ .Type }}) {{ $.Name }}Option {
+	return func(m *{{ $.Type }}) {
+		m.{{ .Name }} = x
+	}
+}
+{{ end }}`))
+
+type templateData struct {
+	Name string
+	Type string
+
+	Fields []fieldData
+}
+
+type fieldData struct {
+	Name   string
+	Type   string
+	Option string
+
+	// Default is the Go expression of the default value, if any
+	Default string
+}
+
+func main() {
+	if err := mirror.RunDefaultApp("mirror-options", ProcessModel); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the constructor with functional options for each model.
+// Options named the same for multiple models are prefixed by the model name
+func ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
+	temp := out.File("options.go")
+	q := mirror.OutQualifier(out, pkg)
+
+	all := []*templateData{}
+	counts := map[string]int{}
+
+	for _, rs := range models {
+		if q(rs.PkgPath(), rs.PackageName()) != "" {
+			temp.AddImports(rs.PkgPath())
+		}
+
+		data := &templateData{
+			Name: rs.Name(),
+			Type: rs.QualifiedName(q),
+		}
+
+		for _, f := range rs.PromotedFields() {
+			_, tagged := f.Field.Tag.Lookup(TagKey)
+			if f.HasTagOption(TagKey, "-") || !f.Exported() && !tagged {
+				continue
+			}
+
+			// unexported fields can't be set outside of the model package
+			if !f.Exported() && q(rs.PkgPath(), rs.PackageName()) != "" {
+				L.Method("Bundle", "ProcessModel").Warnln("Skipping unexported field ", rs.Name(), ".", f.Field.Name, " outside of its package")
+				continue
+			}
+
+			fd := fieldData{
+				Name:   f.Field.Name,
+				Type:   rs.TypeString(f.Typ, q),
+				Option: "With" + strings.Title(f.Field.Name),
+			}
+
+			if value, ok := f.Field.Tag.Lookup(DefaultTagKey); ok {
+				lit, err := rs.Literal(f.Typ, value, q)
+				if err != nil {
+					return errors.Wrapf(err, "default of %s.%s", rs.Name(), f.Field.Name)
+				}
+				fd.Default = lit
+			}
+
+			temp.AddImports(rs.TypeImports(f.Typ, q)...)
+			data.Fields = append(data.Fields, fd)
+			counts[fd.Option]++
+		}
+
+		all = append(all, data)
+	}
+
+	for _, data := range all {
+		for i, fd := range data.Fields {
+			if counts[fd.Option] > 1 {
+				data.Fields[i].Option = "With" + data.Name + strings.Title(fd.Name)
+			}
+		}
+
+		if err := temp.AddTemplate(optionsTemplate, data); err != nil {
+			return err
+		}
+	}
+
+	return temp.Write()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// usageSource uses the options generated into the package of the models
+const usageSource = `func TestOptions(t *testing.T) {
+	c := NewConfig(WithConfigName("api"), WithRetries(5), WithToken("secret"))
+	if c.Name != "api" || c.Timeout != 30*time.Second || c.Retries != 5 || c.token != "secret" {
+		t.Fatal("Config", c)
+	}
+
+	s := NewServer(WithServerName("web"))
+	if s.Name != "web" || s.Port != 8080 {
+		t.Fatal("Server", s)
+	}
+}
+`
+
+type OptionsSuite struct {
+	suite.Suite
+}
+
+func (s *OptionsSuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *OptionsSuite) TestProcessModel() {
+	dir := bundletest.Dir("config")
+	s.NoError(bundletest.WriteModule("1.16"))
+	s.NoError(bundletest.WritePackage("config", "fixtures_test.go"))
+
+	usage := bundle.NewWriter(dir).File("usage_test.go")
+	usage.Imports = []string{"testing", "time"}
+	s.NoError(usage.AddStringTemplate(usageSource, nil))
+	s.NoError(usage.Write())
+
+	models := bundletest.Models("config", &Config{}, &Server{})
+	s.NoError(ProcessModel(models, bundle.NewWriter(dir), bundletest.Package("config")))
+
+	generated, err := ioutil.ReadFile(filepath.Join(dir, "options.go"))
+	s.NoError(err)
+	s.NotContains(string(generated), "WithDebug")
+	s.NotContains(string(generated), "WithInternal")
+
+	s.NoError(bundletest.GoTest())
+}
+
+func TestOptionsSuite(t *testing.T) {
+	suite.Run(t, &OptionsSuite{})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Base struct {
+	ID        int64 `db:"id,pk"`
+	CreatedAt time.Time
+}
+
+type User struct {
+	Base
+	Email   string `db:",unique"`
+	Name    string `db:"full_name"`
+	Nick    *string
+	Age     sql.NullInt32
+	Limit   int
+	secret  string
+	Skipped string `db:"-"`
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+type Membership struct {
+	UserID int64  `db:",pk"`
+	Type   string `db:",pk"`
+}
+
+type NoKey struct {
+	Name string
+}
+
+type Duplicate struct {
+	ID     int64  `db:",pk"`
+	First  string `db:"name"`
+	Second string `db:"name"`
+}
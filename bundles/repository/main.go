@@ -0,0 +1,451 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/bundles/internal/sqlmodel"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"golang.org/x/tools/go/packages"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// reserved are the fields of the filter that can't be used as column filters,
+// columns with these names get filters with the With prefix
+var reserved = map[string]bool{
+	"Limit":  true,
+	"Offset": true,
+}
+
+var helpersTemplate = template.Must(template.New("helpers").Parse(`
+// Queryer executes the queries of the repositories, it is implemented
+// by *sql.DB, *sql.Tx and *sql.Conn
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// RowScanner scans the columns of a row, it is implemented by *sql.Row and *sql.Rows
+type RowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func sqlPlaceholder(n int) string {
+	return {{ . }}
+}
+`))
+
+var repositoryTemplate = template.Must(template.New("repository").Parse(`
+// {{ .Name }}Columns are the columns of the {{ .Name }} in the order scanned by the Scan{{ .Name }}
+const {{ .Name }}Columns = {{ .Columns }}
+
+// {{ .Name }}Filter filters the {{ .Name }} listed by the {{ .Name }}Repository by
+// the equality of the columns, nil fields don't filter. Offset is applied
+// only together with the Limit
+type {{ .Name }}Filter struct {
+{{- range .Fields }}
+	{{ .Filter }} {{ .FilterType }}
+{{- end }}
+
+	Limit  int
+	Offset int
+}
+
+// {{ .Name }}Repository stores the {{ .Name }} in the {{ .Table }} table
+type {{ .Name }}Repository struct {
+	db Queryer
+}
+
+// New{{ .Name }}Repository creates the repository querying the db
+func New{{ .Name }}Repository(db Queryer) *{{ .Name }}Repository {
+	return &{{ .Name }}Repository{db: db}
+}
+
+// Insert inserts the {{ .Name }} as a new row
+func (r *{{ .Name }}Repository) Insert(ctx context.Context, m *{{ .Type }}) error {
+	_, err := r.db.ExecContext(ctx, {{ .Insert }}, {{ .InsertArgs }})
+	return err
+}
+
+// Get returns the {{ .Name }} with the primary key, sql.ErrNoRows if there is none
+func (r *{{ .Name }}Repository) Get(ctx context.Context, {{ .KeyParams }}) (*{{ .Type }}, error) {
+	return Scan{{ .Name }}(r.db.QueryRowContext(ctx, {{ .Get }}, {{ .KeyArgs }}))
+}
+{{ if .Update }}
+// Update updates the row of the {{ .Name }} with its primary key
+func (r *{{ .Name }}Repository) Update(ctx context.Context, m *{{ .Type }}) error {
+	_, err := r.db.ExecContext(ctx, {{ .Update }}, {{ .UpdateArgs }})
+	return err
+}
+{{ end }}
+// Delete deletes the row of the {{ .Name }} with the primary key
+func (r *{{ .Name }}Repository) Delete(ctx context.Context, {{ .KeyParams }}) error {
+	_, err := r.db.ExecContext(ctx, {{ .Delete }}, {{ .KeyArgs }})
+	return err
+}
+
+// List returns the {{ .Name }} matching the filter ordered by the primary key,
+// all of them if the filter is nil
+func (r *{{ .Name }}Repository) List(ctx context.Context, filter *{{ .Name }}Filter) ([]*{{ .Type }}, error) {
+	if filter == nil {
+		filter = &{{ .Name }}Filter{}
+	}
+
+	var where []string
+	var args []interface{}
+{{- range .Fields }}
+	if filter.{{ .Filter }} != nil {
+		args = append(args, *filter.{{ .Filter }})
+		where = append(where, {{ .Condition }}+sqlPlaceholder(len(args)))
+	}
+{{- end }}
+
+	query := {{ .List }}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += {{ .OrderBy }}
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT " + sqlPlaceholder(len(args))
+
+		if filter.Offset > 0 {
+			args = append(args, filter.Offset)
+			query += " OFFSET " + sqlPlaceholder(len(args))
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return Scan{{ .Name }}Rows(rows)
+}
+
+// Scan{{ .Name }} scans the row of the {{ .Name }}Columns
+func Scan{{ .Name }}(s RowScanner) (*{{ .Type }}, error) {
+	m := &{{ .Type }}{}
+	if err := s.Scan({{ .ScanArgs }}); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Scan{{ .Name }}Rows scans the rows of the {{ .Name }}Columns and closes them
+func Scan{{ .Name }}Rows(rows *sql.Rows) ([]*{{ .Type }}, error) {
+	defer rows.Close()
+
+	ms := []*{{ .Type }}{}
+	for rows.Next() {
+		m, err := Scan{{ .Name }}(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	return ms, rows.Err()
+}
+`))
+
+type templateData struct {
+	Name  string
+	Type  string
+	Table string
+
+	Fields []fieldData
+
+	// Go literals of the queries, Update is empty if all columns are keys
+	Columns string
+	Insert  string
+	Get     string
+	Update  string
+	Delete  string
+	List    string
+	OrderBy string
+
+	InsertArgs string
+	UpdateArgs string
+	KeyParams  string
+	KeyArgs    string
+	ScanArgs   string
+}
+
+type fieldData struct {
+	Name   string
+	Column string
+	Param  string
+	Type   string
+	Key    bool
+
+	Filter     string
+	FilterType string
+
+	// Condition is the Go literal of the filter condition without the placeholder
+	Condition string
+}
+
+// Bundle generates the repositories of the models
+type Bundle struct {
+	// Dialect is the SQL dialect of the generated queries, postgres if not set
+	Dialect string
+}
+
+func main() {
+	b := &Bundle{}
+	app := mirror.CreateDefaultApp("mirror-repository", b.ProcessModel)
+	app.Flags = append(app.Flags, cli.StringFlag{
+		Name:        "dialect",
+		Usage:       "SQL dialect of the generated queries, postgres, mysql or sqlite",
+		EnvVar:      "MIRROR_SQL_DIALECT",
+		Value:       sqlmodel.Postgres,
+		Destination: &b.Dialect,
+	})
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the repository for each model, storing it in the
+// table of the model named by sqlmodel.TableName
+func (b *Bundle) ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
+	dialect := b.Dialect
+	if dialect == "" {
+		dialect = sqlmodel.Postgres
+	}
+	if err := sqlmodel.CheckDialect(dialect); err != nil {
+		return err
+	}
+
+	temp := out.File("repository.go")
+	temp.AddImports("context", "database/sql", "strings")
+	q := mirror.OutQualifier(out, pkg)
+
+	placeholder := `"?"`
+	if dialect == sqlmodel.Postgres {
+		placeholder = `"$" + strconv.Itoa(n)`
+		temp.AddImports("strconv")
+	}
+	if err := temp.AddTemplate(helpersTemplate, placeholder); err != nil {
+		return err
+	}
+
+	for _, rs := range models {
+		if q(rs.PkgPath(), rs.PackageName()) != "" {
+			temp.AddImports(rs.PkgPath())
+		}
+
+		data, err := repository(rs, q, dialect)
+		if err != nil {
+			return errors.Wrap(err, rs.Name())
+		}
+
+		for _, f := range rs.PromotedFields() {
+			temp.AddImports(rs.TypeImports(f.Typ, q)...)
+		}
+
+		if err := temp.AddTemplate(repositoryTemplate, data); err != nil {
+			return err
+		}
+	}
+
+	return temp.Write()
+}
+
+// repository returns the template data of the repository of the model with the queries
+func repository(rs *mirror.Struct, q mirror.Qualifier, dialect string) (*templateData, error) {
+	fields, err := columns(rs, q)
+	if err != nil {
+		return nil, err
+	}
+
+	ident := func(name string) string {
+		return sqlmodel.Quote(dialect, name)
+	}
+
+	table := sqlmodel.TableName(rs)
+
+	var cols, placeholders, insertArgs, scanArgs []string
+	var sets, setArgs, keys, keyParams, keyArgs []string
+	for i := range fields {
+		f := &fields[i]
+		f.Condition = literal(ident(f.Column) + " = ")
+
+		cols = append(cols, ident(f.Column))
+		placeholders = append(placeholders, placeholderOf(dialect, len(placeholders)+1))
+		insertArgs = append(insertArgs, "m."+f.Name)
+		scanArgs = append(scanArgs, "&m."+f.Name)
+	}
+
+	// keys follow the set columns in the arguments of the update
+	for _, f := range fields {
+		if !f.Key {
+			sets = append(sets, ident(f.Column)+" = "+placeholderOf(dialect, len(sets)+1))
+			setArgs = append(setArgs, "m."+f.Name)
+		}
+	}
+	for _, f := range fields {
+		if f.Key {
+			keys = append(keys, ident(f.Column))
+			keyParams = append(keyParams, f.Param+" "+f.Type)
+			keyArgs = append(keyArgs, f.Param)
+			setArgs = append(setArgs, "m."+f.Name)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, sqlmodel.ErrNoPrimaryKey
+	}
+
+	where := func(offset int) string {
+		conds := make([]string, len(keys))
+		for i, k := range keys {
+			conds[i] = k + " = " + placeholderOf(dialect, offset+i+1)
+		}
+
+		return " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	selectAll := "SELECT " + strings.Join(cols, ", ") + " FROM " + ident(table)
+	data := &templateData{
+		Name:   rs.Name(),
+		Type:   rs.QualifiedName(q),
+		Table:  table,
+		Fields: fields,
+
+		Columns: literal(strings.Join(cols, ", ")),
+		Insert: literal("INSERT INTO " + ident(table) + " (" + strings.Join(cols, ", ") +
+			") VALUES (" + strings.Join(placeholders, ", ") + ")"),
+		Get:     literal(selectAll + where(0)),
+		Delete:  literal("DELETE FROM " + ident(table) + where(0)),
+		List:    literal(selectAll),
+		OrderBy: literal(" ORDER BY " + strings.Join(keys, ", ")),
+
+		InsertArgs: strings.Join(insertArgs, ", "),
+		UpdateArgs: strings.Join(setArgs, ", "),
+		KeyParams:  strings.Join(keyParams, ", "),
+		KeyArgs:    strings.Join(keyArgs, ", "),
+		ScanArgs:   strings.Join(scanArgs, ", "),
+	}
+	if len(sets) > 0 {
+		data.Update = literal("UPDATE " + ident(table) + " SET " + strings.Join(sets, ", ") + where(len(sets)))
+	}
+
+	return data, nil
+}
+
+// columns returns the fields of the columns of the model. Fields of embedded
+// structs are promoted to the model, unless the embedded struct has a column name
+func columns(rs *mirror.Struct, q mirror.Qualifier) ([]fieldData, error) {
+	var fields []fieldData
+	seen := map[string]bool{}
+	for _, f := range rs.PromotedFields() {
+		opts := f.TagOptions(sqlmodel.TagKey)
+		if !f.Exported() || len(opts) > 0 && opts[0] == "-" {
+			continue
+		}
+
+		name := ""
+		if len(opts) > 0 {
+			name, opts = opts[0], opts[1:]
+		}
+
+		if f.Field.Anonymous && name == "" && f.Typ.Kind() == reflect.Struct && !scannable(f.Typ) {
+			continue
+		}
+
+		if name == "" {
+			name = sqlmodel.SnakeCase(f.Field.Name)
+		}
+		if seen[name] {
+			return nil, errors.Wrap(sqlmodel.ErrDuplicateColumn, name)
+		}
+		seen[name] = true
+
+		fd := fieldData{
+			Name:   f.Field.Name,
+			Column: name,
+			Param:  paramName(f.Field.Name),
+			Type:   rs.TypeString(f.Typ, q),
+			Filter: f.Field.Name,
+		}
+		for _, opt := range opts {
+			fd.Key = fd.Key || opt == "pk"
+		}
+		if reserved[fd.Filter] {
+			fd.Filter = "With" + fd.Filter
+		}
+
+		// pointers filter by the values they point to
+		fd.FilterType = "*" + fd.Type
+		if f.Typ.Kind() == reflect.Ptr {
+			fd.FilterType = fd.Type
+		}
+
+		fields = append(fields, fd)
+	}
+
+	return fields, nil
+}
+
+var scannerType = reflect.TypeOf((*interface {
+	Scan(src interface{}) error
+})(nil)).Elem()
+
+// scannable returns true if the struct is stored as a single column,
+// e.g. time.Time and the null types of database/sql
+func scannable(t reflect.Type) bool {
+	return t.PkgPath() == "time" && t.Name() == "Time" || reflect.PtrTo(t).Implements(scannerType)
+}
+
+// literal returns the Go literal of the query, raw unless it contains backquotes
+func literal(query string) string {
+	if strings.Contains(query, "`") {
+		return strconv.Quote(query)
+	}
+
+	return "`" + query + "`"
+}
+
+// placeholderOf returns the n-th placeholder of the query in the dialect
+func placeholderOf(dialect string, n int) string {
+	if dialect == sqlmodel.Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+
+	return "?"
+}
+
+// paramName returns the name of the parameter of the field, e.g. userID for UserID
+func paramName(field string) string {
+	runes := []rune(field)
+
+	// leading acronyms are lowered together, except for the start of the next word
+	i := 1
+	for i < len(runes) && unicode.IsUpper(runes[i]) && (i+1 == len(runes) || unicode.IsUpper(runes[i+1])) {
+		i++
+	}
+
+	name := strings.ToLower(string(runes[:i])) + string(runes[i:])
+	switch name {
+	case "ctx", "m", "r", "break", "case", "chan", "const", "continue", "default", "defer", "else",
+		"fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package",
+		"range", "return", "select", "struct", "switch", "type", "var":
+		return name + "Key"
+	}
+
+	return name
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/bundles/internal/sqlmodel"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const usageSource = `package user
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = ` + "`" + `
+CREATE TABLE "users" (
+	"id" INTEGER NOT NULL PRIMARY KEY,
+	"created_at" DATETIME NOT NULL,
+	"email" TEXT NOT NULL,
+	"full_name" TEXT NOT NULL,
+	"nick" TEXT,
+	"age" INTEGER,
+	"limit" INTEGER NOT NULL
+);
+CREATE TABLE "membership" (
+	"user_id" INTEGER NOT NULL,
+	"type" TEXT NOT NULL,
+	PRIMARY KEY ("user_id", "type")
+);
+` + "`" + `
+
+func ids(users []*User, err error) []int64 {
+	if err != nil {
+		panic(err)
+	}
+
+	ids := []int64{}
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+
+	return ids
+}
+
+func TestRepository(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// every connection has its own in-memory database
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	users := NewUserRepository(db)
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	nick := "jd"
+	for i, email := range []string{"john@example.com", "jane@example.com", "joe@example.com"} {
+		u := &User{Base: Base{ID: int64(i + 1), CreatedAt: created}, Email: email, Name: "Doe", Limit: i}
+		if i == 0 {
+			u.Nick, u.Age = &nick, sql.NullInt32{Int32: 30, Valid: true}
+		}
+
+		if err := users.Insert(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err := users.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "john@example.com" || *u.Nick != "jd" || u.Age.Int32 != 30 || !u.CreatedAt.Equal(created) {
+		t.Fatalf("Unexpected user %+v", u)
+	}
+
+	u.Name, u.Nick, u.Age = "Smith", nil, sql.NullInt32{}
+	if err := users.Update(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := users.Get(ctx, 1); err != nil || u.Name != "Smith" || u.Nick != nil || u.Age.Valid {
+		t.Fatalf("Unexpected updated user %+v, %v", u, err)
+	}
+
+	name, email, limit := "Doe", "jane@example.com", 2
+	if got := ids(users.List(ctx, &UserFilter{Name: &name})); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatal("Unexpected users by name", got)
+	}
+	if got := ids(users.List(ctx, &UserFilter{Name: &name, Email: &email})); len(got) != 1 || got[0] != 2 {
+		t.Fatal("Unexpected users by name and email", got)
+	}
+	if got := ids(users.List(ctx, &UserFilter{WithLimit: &limit})); len(got) != 1 || got[0] != 3 {
+		t.Fatal("Unexpected users by the limit column", got)
+	}
+	if got := ids(users.List(ctx, &UserFilter{Limit: 1, Offset: 1})); len(got) != 1 || got[0] != 2 {
+		t.Fatal("Unexpected page of users", got)
+	}
+	if got := ids(users.List(ctx, nil)); len(got) != 3 {
+		t.Fatal("Unexpected users", got)
+	}
+
+	if err := users.Delete(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Get(ctx, 2); err != sql.ErrNoRows {
+		t.Fatal("Expected no rows, got", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+UserColumns+" FROM users WHERE id > ? ORDER BY id DESC", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(ScanUserRows(rows)); len(got) != 1 || got[0] != 3 {
+		t.Fatal("Unexpected scanned users", got)
+	}
+
+	memberships := NewMembershipRepository(db)
+	if err := memberships.Insert(ctx, &Membership{UserID: 1, Type: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := memberships.Get(ctx, 1, "admin"); err != nil || m.Type != "admin" {
+		t.Fatalf("Unexpected membership %+v, %v", m, err)
+	}
+	if err := memberships.Delete(ctx, 1, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := memberships.List(ctx, nil); err != nil || len(ms) != 0 {
+		t.Fatalf("Unexpected memberships %+v, %v", ms, err)
+	}
+}
+`
+
+type RepositorySuite struct {
+	suite.Suite
+}
+
+type RepositoryCandidate struct {
+	name    string
+	dialect string
+	models  []interface{}
+
+	err error
+}
+
+func (s *RepositorySuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *RepositorySuite) TestProcessModel() {
+	// the testdata module requires the driver of the generated tests
+	s.NoError(bundletest.CopyModule("testdata"))
+	s.NoError(bundletest.WritePackage("user", "fixtures_test.go"))
+	s.NoError(bundletest.WriteFile("user", "usage_test.go", usageSource))
+
+	models := bundletest.Models("user", &User{}, &Membership{})
+	b := &Bundle{Dialect: sqlmodel.SQLite}
+	s.NoError(b.ProcessModel(models, bundle.NewWriter(bundletest.Dir("user")), bundletest.Package("user")))
+
+	// repositories of other packages and dialects only need to compile
+	for _, d := range []string{sqlmodel.Postgres, sqlmodel.MySQL} {
+		b := &Bundle{Dialect: d}
+		s.NoError(b.ProcessModel(models, bundle.NewWriter(bundletest.Dir(d)), bundletest.Package("user")))
+	}
+
+	if reason := driverUnavailable(); reason != "" {
+		s.T().Skip("Skipping the generated tests, " + reason)
+	}
+	s.NoError(bundletest.GoTest())
+}
+
+func (s *RepositorySuite) TestProcessModelErrors() {
+	candidates := []RepositoryCandidate{
+		{
+			name:    "Get error for an unknown dialect",
+			dialect: "oracle",
+			models:  []interface{}{&Membership{}},
+			err:     sqlmodel.ErrUnknownDialect,
+		},
+		{
+			name:    "Get error for a model without primary key",
+			dialect: sqlmodel.Postgres,
+			models:  []interface{}{&NoKey{}},
+			err:     sqlmodel.ErrNoPrimaryKey,
+		},
+		{
+			name:    "Get error for a duplicate column",
+			dialect: sqlmodel.Postgres,
+			models:  []interface{}{&Duplicate{}},
+			err:     sqlmodel.ErrDuplicateColumn,
+		},
+		{
+			name:    "Get error for a described model",
+			dialect: sqlmodel.Postgres,
+			models:  []interface{}{&plugins.TypeDescription{Name: "User", Kind: "struct"}},
+			err:     mirror.ErrDescribedModel,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		b := &Bundle{Dialect: c.dialect}
+		err := b.ProcessModel(bundletest.Models("user", c.models...), bundle.NewWriter(bundletest.Dir("user")), bundletest.Package("user"))
+		s.EqualValues(c.err, errors.Cause(err))
+	}
+}
+
+func (s *RepositorySuite) TestParamName() {
+	for field, expected := range map[string]string{
+		"ID":      "id",
+		"UserID":  "userID",
+		"URLPath": "urlPath",
+		"Type":    "typeKey",
+		"M":       "mKey",
+	} {
+		s.EqualValues(expected, paramName(field))
+	}
+}
+
+// driverUnavailable returns why the sqlite driver of the test module can't be
+// built offline, an empty string if it can. It needs the cgo and the module cache
+func driverUnavailable() string {
+	out, err := exec.Command("go", "env", "CGO_ENABLED").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "1" {
+		return "the sqlite driver requires the cgo"
+	}
+
+	cmd := exec.Command("go", "mod", "download", "github.com/mattn/go-sqlite3")
+	cmd.Dir = bundletest.ModuleDir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+	if err := cmd.Run(); err != nil {
+		return "the sqlite driver is not in the module cache"
+	}
+
+	return ""
+}
+
+func TestRepositorySuite(t *testing.T) {
+	suite.Run(t, &RepositorySuite{})
+}
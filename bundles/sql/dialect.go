@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/petomalina/mirror/bundles/internal/sqlmodel"
+	"github.com/pkg/errors"
+	"reflect"
+	"time"
+)
+
+// Dialect maps the Go types to the column types of the database
+// and writes the statements in its SQL
+type Dialect struct {
+	Name string
+
+	quote string
+	kinds map[reflect.Kind]string
+	bytes string
+	time  string
+}
+
+var dialects = map[string]*Dialect{
+	sqlmodel.Postgres: {
+		Name: sqlmodel.Postgres,
+		kinds: map[reflect.Kind]string{
+			reflect.Bool:    "BOOLEAN",
+			reflect.Int8:    "SMALLINT",
+			reflect.Uint8:   "SMALLINT",
+			reflect.Int16:   "SMALLINT",
+			reflect.Uint16:  "INTEGER",
+			reflect.Int32:   "INTEGER",
+			reflect.Uint32:  "BIGINT",
+			reflect.Int:     "BIGINT",
+			reflect.Int64:   "BIGINT",
+			reflect.Uint:    "NUMERIC(20)",
+			reflect.Uint64:  "NUMERIC(20)",
+			reflect.Float32: "REAL",
+			reflect.Float64: "DOUBLE PRECISION",
+			reflect.String:  "TEXT",
+		},
+		bytes: "BYTEA",
+		time:  "TIMESTAMP WITH TIME ZONE",
+	},
+	sqlmodel.MySQL: {
+		Name: sqlmodel.MySQL,
+		kinds: map[reflect.Kind]string{
+			reflect.Bool:    "BOOLEAN",
+			reflect.Int8:    "TINYINT",
+			reflect.Uint8:   "TINYINT UNSIGNED",
+			reflect.Int16:   "SMALLINT",
+			reflect.Uint16:  "SMALLINT UNSIGNED",
+			reflect.Int32:   "INT",
+			reflect.Uint32:  "INT UNSIGNED",
+			reflect.Int:     "BIGINT",
+			reflect.Int64:   "BIGINT",
+			reflect.Uint:    "BIGINT UNSIGNED",
+			reflect.Uint64:  "BIGINT UNSIGNED",
+			reflect.Float32: "FLOAT",
+			reflect.Float64: "DOUBLE",
+			reflect.String:  "VARCHAR(255)",
+		},
+		bytes: "BLOB",
+		time:  "DATETIME(6)",
+	},
+	sqlmodel.SQLite: {
+		Name: sqlmodel.SQLite,
+		kinds: map[reflect.Kind]string{
+			reflect.Bool:    "BOOLEAN",
+			reflect.Int8:    "INTEGER",
+			reflect.Uint8:   "INTEGER",
+			reflect.Int16:   "INTEGER",
+			reflect.Uint16:  "INTEGER",
+			reflect.Int32:   "INTEGER",
+			reflect.Uint32:  "INTEGER",
+			reflect.Int:     "INTEGER",
+			reflect.Int64:   "INTEGER",
+			reflect.Uint:    "INTEGER",
+			reflect.Uint64:  "INTEGER",
+			reflect.Float32: "REAL",
+			reflect.Float64: "REAL",
+			reflect.String:  "TEXT",
+		},
+		bytes: "BLOB",
+		time:  "DATETIME",
+	},
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// nullTypes are the nullable types of the database/sql and their values
+var nullTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+	reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+	reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+	reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+	reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+	reflect.TypeOf(sql.NullTime{}):    timeType,
+}
+
+// ColumnType returns the column type of the Go type and whether the column
+// is nullable, which pointers and the null types of database/sql are
+func (d *Dialect) ColumnType(t reflect.Type) (string, bool, error) {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	if value, ok := nullTypes[t]; ok {
+		t, nullable = value, true
+	}
+
+	switch {
+	case t == timeType:
+		return d.time, nullable, nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return d.bytes, nullable, nil
+	}
+
+	if typ, ok := d.kinds[t.Kind()]; ok {
+		return typ, nullable, nil
+	}
+
+	return "", false, errors.Wrap(ErrColumnType, t.String())
+}
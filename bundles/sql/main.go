@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/bundles/internal/sqlmodel"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrDialectChanged   = errors.New("The dialect differs from the dialect of the previous schema, which can't be migrated")
+	ErrColumnType       = errors.New("The type of the field has no column type, set it by the type option of the db tag")
+	ErrUnknownTagOption = errors.New("The option of the db tag is unknown")
+)
+
+const (
+	// SchemaFile is the DDL of all tables of the models
+	SchemaFile = "schema.sql"
+
+	// SnapshotFile is the schema of the previous generation the migrations are diffed against
+	SnapshotFile = "schema.json"
+
+	// MigrationsDir is the directory of the migrations, numbered by their order
+	MigrationsDir = "migrations"
+)
+
+var migrationFile = regexp.MustCompile(`^(\d+)_.*\.sql$`)
+
+// Bundle generates the schema and migrations of the tables of the models
+type Bundle struct {
+	// Dialect is the SQL dialect of the generated statements, postgres if not set
+	Dialect string
+}
+
+func main() {
+	b := &Bundle{}
+	app := mirror.CreateDefaultApp("mirror-sql", b.ProcessModel)
+	app.Flags = append(app.Flags, cli.StringFlag{
+		Name:        "dialect",
+		Usage:       "SQL dialect of the generated schema, postgres, mysql or sqlite",
+		EnvVar:      "MIRROR_SQL_DIALECT",
+		Value:       sqlmodel.Postgres,
+		Destination: &b.Dialect,
+	})
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the schema of the tables of the models together with
+// the migration of the changes since the previous generation, whose schema
+// is stored as the snapshot in the out directory
+func (b *Bundle) ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
+	name := b.Dialect
+	if name == "" {
+		name = sqlmodel.Postgres
+	}
+
+	d, ok := dialects[name]
+	if !ok {
+		return errors.Wrap(sqlmodel.ErrUnknownDialect, name)
+	}
+
+	schema := &Schema{Dialect: d.Name}
+	for _, rs := range models {
+		t, err := d.Table(rs)
+		if err != nil {
+			return errors.Wrap(err, rs.Name())
+		}
+		schema.Tables = append(schema.Tables, t)
+	}
+
+	previous, err := readSnapshot(out.Dir())
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.Dialect != schema.Dialect {
+		return errors.Wrapf(ErrDialectChanged, "%s to %s", previous.Dialect, schema.Dialect)
+	}
+
+	// migrations of the previous generations stay as they are
+	existing, err := migrations(out.Dir())
+	if err != nil {
+		return err
+	}
+	for _, name := range existing {
+		out.Keep(filepath.Join(MigrationsDir, name))
+	}
+
+	if migration := d.Migrate(previous, schema); migration != "" {
+		f := out.RawFile(filepath.Join(MigrationsDir, fmt.Sprintf("%04d_schema.up.sql", nextMigration(existing))))
+		f.AddString(migration)
+		if err := f.Write(); err != nil {
+			return err
+		}
+	}
+
+	ddl := out.RawFile(SchemaFile)
+	for i, t := range schema.Tables {
+		if i > 0 {
+			ddl.AddString("\n")
+		}
+		ddl.AddString(d.CreateTable(t))
+	}
+	if err := ddl.Write(); err != nil {
+		return err
+	}
+
+	snapshot, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f := out.RawFile(SnapshotFile)
+	f.AddString(string(snapshot) + "\n")
+	return f.Write()
+}
+
+// Table returns the table of the model, named by sqlmodel.TableName
+func (d *Dialect) Table(rs *mirror.Struct) (*Table, error) {
+	t := &Table{Name: sqlmodel.TableName(rs)}
+
+	var fields []reflect.StructField
+	for _, f := range rs.RawFields() {
+		fields = append(fields, f.Field)
+	}
+
+	indexes := map[string]*Index{}
+	if err := d.columns(t, fields, indexes); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// columns adds the columns of the fields to the table, flattening the embedded structs
+func (d *Dialect) columns(t *Table, fields []reflect.StructField, indexes map[string]*Index) error {
+	for _, sf := range fields {
+		f := &mirror.RawStructFieldType{Field: sf, Typ: sf.Type}
+
+		opts := f.TagOptions(sqlmodel.TagKey)
+		if sf.PkgPath != "" && !sf.Anonymous || len(opts) > 0 && opts[0] == "-" {
+			continue
+		}
+
+		name := ""
+		if len(opts) > 0 {
+			name, opts = opts[0], opts[1:]
+		}
+
+		embedded := sf.Type
+		if embedded.Kind() == reflect.Ptr {
+			embedded = embedded.Elem()
+		}
+		if sf.Anonymous && name == "" && embedded.Kind() == reflect.Struct && embedded != timeType {
+			if _, null := nullTypes[embedded]; !null {
+				var embeddedFields []reflect.StructField
+				for i := 0; i < embedded.NumField(); i++ {
+					embeddedFields = append(embeddedFields, embedded.Field(i))
+				}
+
+				if err := d.columns(t, embeddedFields, indexes); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sqlmodel.SnakeCase(sf.Name)
+		}
+		if t.Column(name) != nil {
+			return errors.Wrap(sqlmodel.ErrDuplicateColumn, name)
+		}
+
+		c := &Column{Name: name}
+		if err := d.column(t, c, sf, opts, indexes); err != nil {
+			return errors.Wrap(err, sf.Name)
+		}
+		t.Columns = append(t.Columns, c)
+	}
+
+	return nil
+}
+
+// column sets the column by the options of the tag of the field
+func (d *Dialect) column(t *Table, c *Column, sf reflect.StructField, opts []string, indexes map[string]*Index) error {
+	typ, nullable, err := d.ColumnType(sf.Type)
+	c.Type, c.Nullable = typ, nullable
+
+	for _, opt := range opts {
+		key, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			key, value = opt[:i], opt[i+1:]
+		}
+
+		switch key {
+		case "pk":
+			c.Primary = true
+		case "default":
+			c.Default = value
+		case "type":
+			c.Type, err = value, nil
+		case "index", "unique":
+			unique := key == "unique"
+			if value == "" {
+				value = map[bool]string{false: "idx_", true: "uq_"}[unique] + t.Name + "_" + c.Name
+			}
+
+			i, ok := indexes[value]
+			if !ok {
+				i = &Index{Name: value, Unique: unique}
+				indexes[value] = i
+				t.Indexes = append(t.Indexes, i)
+			}
+			i.Columns = append(i.Columns, c.Name)
+		default:
+			return errors.Wrap(ErrUnknownTagOption, opt)
+		}
+	}
+
+	return err
+}
+
+// readSnapshot returns the schema of the previous generation, nil if there is none
+func readSnapshot(dir string) (*Schema, error) {
+	bb, err := ioutil.ReadFile(filepath.Join(dir, SnapshotFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{}
+	if err := json.Unmarshal(bb, schema); err != nil {
+		return nil, errors.Wrap(err, SnapshotFile)
+	}
+
+	return schema, nil
+}
+
+// migrations returns the names of the existing migrations
+func migrations(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(dir, MigrationsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, info := range infos {
+		if !info.IsDir() && migrationFile.MatchString(info.Name()) {
+			names = append(names, info.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// nextMigration returns the number following the numbers of the migrations
+func nextMigration(names []string) int {
+	next := 1
+	for _, name := range names {
+		m := migrationFile.FindStringSubmatch(name)
+		if n, _ := strconv.Atoi(m[1]); n >= next {
+			next = n + 1
+		}
+	}
+
+	return next
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/bundles/internal/sqlmodel"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type Base struct {
+	ID        int64     `db:"id,pk"`
+	CreatedAt time.Time `db:",default=CURRENT_TIMESTAMP"`
+}
+
+type User struct {
+	Base
+	Email   string `db:",unique"`
+	Name    string `db:"full_name,index=idx_users_name"`
+	Nick    *string
+	Age     sql.NullInt32
+	Data    []byte
+	secret  string
+	Skipped string `db:"-"`
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+type UserV2 struct {
+	Base
+	Email   string `db:",unique"`
+	Name    string `db:"full_name"`
+	Nick    string
+	Age     sql.NullInt32
+	Country string `db:",default='SK'"`
+}
+
+func (UserV2) TableName() string {
+	return "users"
+}
+
+type Order struct {
+	ID     int64 `db:",pk"`
+	UserID int64 `db:",index"`
+	Total  float64
+}
+
+type Unsupported struct {
+	Labels map[string]string
+}
+
+type Duplicate struct {
+	First  string `db:"name"`
+	Second string `db:"name"`
+}
+
+type UnknownOption struct {
+	ID int64 `db:",primary"`
+}
+
+const postgresUsers = `CREATE TABLE "users" (
+	"id" BIGINT NOT NULL,
+	"created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	"email" TEXT NOT NULL,
+	"full_name" TEXT NOT NULL,
+	"nick" TEXT,
+	"age" INTEGER,
+	"data" BYTEA NOT NULL,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "uq_users_email" ON "users" ("email");
+CREATE INDEX "idx_users_name" ON "users" ("full_name");
+`
+
+const postgresOrder = `CREATE TABLE "order" (
+	"id" BIGINT NOT NULL,
+	"user_id" BIGINT NOT NULL,
+	"total" DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_order_user_id" ON "order" ("user_id");
+`
+
+type SqlSuite struct {
+	suite.Suite
+}
+
+type SqlCandidate struct {
+	name    string
+	dialect string
+	models  []interface{}
+
+	expected string
+	err      error
+}
+
+func (s *SqlSuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *SqlSuite) TestCreateTable() {
+	candidates := []SqlCandidate{
+		{
+			name:     "Create table of PostgreSQL",
+			dialect:  sqlmodel.Postgres,
+			models:   []interface{}{&User{}},
+			expected: postgresUsers,
+		},
+		{
+			name:    "Create table of MySQL",
+			dialect: sqlmodel.MySQL,
+			models:  []interface{}{&User{}},
+			expected: "CREATE TABLE `users` (\n" +
+				"\t`id` BIGINT NOT NULL,\n" +
+				"\t`created_at` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+				"\t`email` VARCHAR(255) NOT NULL,\n" +
+				"\t`full_name` VARCHAR(255) NOT NULL,\n" +
+				"\t`nick` VARCHAR(255),\n" +
+				"\t`age` INT,\n" +
+				"\t`data` BLOB NOT NULL,\n" +
+				"\tPRIMARY KEY (`id`)\n" +
+				");\n" +
+				"CREATE UNIQUE INDEX `uq_users_email` ON `users` (`email`);\n" +
+				"CREATE INDEX `idx_users_name` ON `users` (`full_name`);\n",
+		},
+		{
+			name:    "Create table of SQLite",
+			dialect: sqlmodel.SQLite,
+			models:  []interface{}{&Order{}},
+			expected: `CREATE TABLE "order" (
+	"id" INTEGER NOT NULL,
+	"user_id" INTEGER NOT NULL,
+	"total" REAL NOT NULL,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_order_user_id" ON "order" ("user_id");
+`,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		d := dialects[c.dialect]
+		t, err := d.Table(s.models(c.models...)[0])
+		s.NoError(err)
+		s.EqualValues(c.expected, d.CreateTable(t))
+	}
+}
+
+func (s *SqlSuite) TestProcessModel() {
+	out := bundletest.Dir("schema")
+	b := &Bundle{}
+
+	s.NoError(b.ProcessModel(s.models(&User{}, &Order{}), bundle.NewWriter(out), s.pkg()))
+	s.EqualValues(postgresUsers+postgresOrder, s.read(out, MigrationsDir, "0001_schema.up.sql"))
+	s.EqualValues(postgresUsers+"\n"+postgresOrder, s.read(out, SchemaFile))
+
+	s.NoError(b.ProcessModel(s.models(&UserV2{}), bundle.NewWriter(out), s.pkg()))
+	s.EqualValues(`DROP INDEX "idx_users_name";
+ALTER TABLE "users" ALTER COLUMN "nick" SET NOT NULL;
+ALTER TABLE "users" ADD COLUMN "country" TEXT NOT NULL DEFAULT 'SK';
+ALTER TABLE "users" DROP COLUMN "data";
+DROP TABLE "order";
+`, s.read(out, MigrationsDir, "0002_schema.up.sql"))
+
+	// unchanged models don't need any migration, the existing ones are kept
+	w := bundle.NewWriter(out)
+	s.NoError(b.ProcessModel(s.models(&UserV2{}), w, s.pkg()))
+	infos, err := ioutil.ReadDir(filepath.Join(out, MigrationsDir))
+	s.NoError(err)
+	s.Len(infos, 2)
+	s.Subset(w.Paths(), []string{
+		filepath.Join(out, MigrationsDir, "0001_schema.up.sql"),
+		filepath.Join(out, MigrationsDir, "0002_schema.up.sql"),
+	})
+}
+
+func (s *SqlSuite) TestMigrateMySQL() {
+	d := dialects[sqlmodel.MySQL]
+
+	from, err := d.Table(s.models(&User{})[0])
+	s.NoError(err)
+	to, err := d.Table(s.models(&UserV2{})[0])
+	s.NoError(err)
+
+	s.EqualValues("DROP INDEX `idx_users_name` ON `users`;\n"+
+		"ALTER TABLE `users` MODIFY COLUMN `nick` VARCHAR(255) NOT NULL;\n"+
+		"ALTER TABLE `users` ADD COLUMN `country` VARCHAR(255) NOT NULL DEFAULT 'SK';\n"+
+		"ALTER TABLE `users` DROP COLUMN `data`;\n",
+		d.Migrate(&Schema{Tables: []*Table{from}}, &Schema{Tables: []*Table{to}}))
+}
+
+func (s *SqlSuite) TestProcessModelErrors() {
+	candidates := []SqlCandidate{
+		{
+			name:    "Get error for an unknown dialect",
+			dialect: "oracle",
+			models:  []interface{}{&Order{}},
+			err:     sqlmodel.ErrUnknownDialect,
+		},
+		{
+			name:    "Get error for a type without column type",
+			dialect: sqlmodel.Postgres,
+			models:  []interface{}{&Unsupported{}},
+			err:     ErrColumnType,
+		},
+		{
+			name:    "Get error for a duplicate column",
+			dialect: sqlmodel.Postgres,
+			models:  []interface{}{&Duplicate{}},
+			err:     sqlmodel.ErrDuplicateColumn,
+		},
+		{
+			name:    "Get error for an unknown tag option",
+			dialect: sqlmodel.Postgres,
+			models:  []interface{}{&UnknownOption{}},
+			err:     ErrUnknownTagOption,
+		},
+		{
+			name:    "Get error for a described model",
+			dialect: sqlmodel.Postgres,
+			models:  []interface{}{&plugins.TypeDescription{Name: "Order", Kind: "struct"}},
+			err:     mirror.ErrDescribedModel,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		b := &Bundle{Dialect: c.dialect}
+		err := b.ProcessModel(s.models(c.models...), bundle.NewWriter(bundletest.Dir("schema")), s.pkg())
+		s.EqualValues(c.err, errors.Cause(err))
+	}
+}
+
+func (s *SqlSuite) TestProcessModelPackages() {
+	out := bundletest.Dir("schema")
+	models := append(bundletest.Models("users", &User{}), bundletest.Models("orders", &Order{})...)
+
+	// models of all packages generated into the dir share its schema
+	for i := 0; i < 2; i++ {
+		s.NoError((&Bundle{}).ProcessModel(models, bundle.NewWriter(out), bundletest.Package("users")))
+	}
+
+	s.EqualValues(postgresUsers+postgresOrder, s.read(out, MigrationsDir, "0001_schema.up.sql"))
+	infos, err := ioutil.ReadDir(filepath.Join(out, MigrationsDir))
+	s.NoError(err)
+	s.Len(infos, 1)
+
+	snapshot := &Schema{}
+	s.NoError(json.Unmarshal([]byte(s.read(out, SnapshotFile)), snapshot))
+	s.Len(snapshot.Tables, 2)
+}
+
+func (s *SqlSuite) TestDialectChanged() {
+	out := bundletest.Dir("schema")
+	s.NoError((&Bundle{}).ProcessModel(s.models(&Order{}), bundle.NewWriter(out), s.pkg()))
+
+	err := (&Bundle{Dialect: sqlmodel.MySQL}).ProcessModel(s.models(&Order{}), bundle.NewWriter(out), s.pkg())
+	s.EqualValues(ErrDialectChanged, errors.Cause(err))
+}
+
+func (s *SqlSuite) read(path ...string) string {
+	bb, err := ioutil.ReadFile(filepath.Join(path...))
+	s.NoError(err)
+
+	return string(bb)
+}
+
+func (s *SqlSuite) models(models ...interface{}) mirror.StructSlice {
+	return bundletest.Models("model", models...)
+}
+
+func (s *SqlSuite) pkg() *packages.Package {
+	return bundletest.Package("model")
+}
+
+func TestSqlSuite(t *testing.T) {
+	suite.Run(t, &SqlSuite{})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/petomalina/mirror/bundles/internal/sqlmodel"
+	"strings"
+)
+
+// Migrate returns the statements migrating the from schema to the to schema,
+// empty if there are no changes. Changes the dialect can't migrate, e.g.
+// of the primary keys, are written as comments to be migrated manually
+func (d *Dialect) Migrate(from, to *Schema) string {
+	if from == nil {
+		from = &Schema{}
+	}
+
+	b := &strings.Builder{}
+	for _, t := range to.Tables {
+		old := from.Table(t.Name)
+		if old == nil {
+			b.WriteString(d.CreateTable(t))
+			continue
+		}
+
+		d.alterTable(b, old, t)
+	}
+
+	for _, old := range from.Tables {
+		if to.Table(old.Name) == nil {
+			b.WriteString("DROP TABLE " + d.Quote(old.Name) + ";\n")
+		}
+	}
+
+	return b.String()
+}
+
+func (d *Dialect) alterTable(b *strings.Builder, old, t *Table) {
+	alter := "ALTER TABLE " + d.Quote(t.Name) + " "
+
+	// changed indexes are dropped and created again
+	for _, i := range old.Indexes {
+		if ni := t.Index(i.Name); ni == nil || !equalIndex(i, ni) {
+			b.WriteString(d.DropIndex(old, i))
+		}
+	}
+
+	if from, to := old.PrimaryKey(), t.PrimaryKey(); !equalStrings(from, to) {
+		b.WriteString("-- The primary key of " + d.Quote(t.Name) + " changed from (" + d.QuoteAll(from) +
+			") to (" + d.QuoteAll(to) + "), it must be migrated manually\n")
+	}
+
+	for _, c := range t.Columns {
+		oc := old.Column(c.Name)
+		switch {
+		case oc == nil:
+			b.WriteString(alter + "ADD COLUMN " + d.ColumnDefinition(c) + ";\n")
+		case oc.Type != c.Type || oc.Nullable != c.Nullable || oc.Default != c.Default:
+			d.alterColumn(b, t, oc, c)
+		}
+	}
+
+	for _, oc := range old.Columns {
+		if t.Column(oc.Name) == nil {
+			b.WriteString(alter + "DROP COLUMN " + d.Quote(oc.Name) + ";\n")
+		}
+	}
+
+	for _, i := range t.Indexes {
+		if oi := old.Index(i.Name); oi == nil || !equalIndex(oi, i) {
+			b.WriteString(d.CreateIndex(t, i))
+		}
+	}
+}
+
+// alterColumn writes the statements changing the type, nullability and default of the column
+func (d *Dialect) alterColumn(b *strings.Builder, t *Table, old, c *Column) {
+	alter := "ALTER TABLE " + d.Quote(t.Name) + " "
+
+	switch d.Name {
+	case sqlmodel.MySQL:
+		b.WriteString(alter + "MODIFY COLUMN " + d.ColumnDefinition(c) + ";\n")
+
+	case sqlmodel.SQLite:
+		b.WriteString("-- SQLite can't alter the column " + d.Quote(c.Name) + " of " + d.Quote(t.Name) +
+			", the table must be recreated with " + d.ColumnDefinition(c) + "\n")
+
+	default:
+		column := alter + "ALTER COLUMN " + d.Quote(c.Name) + " "
+		if old.Type != c.Type {
+			b.WriteString(column + "TYPE " + c.Type + ";\n")
+		}
+		if old.Nullable != c.Nullable && c.Nullable {
+			b.WriteString(column + "DROP NOT NULL;\n")
+		}
+		if old.Nullable != c.Nullable && !c.Nullable {
+			b.WriteString(column + "SET NOT NULL;\n")
+		}
+		if old.Default != c.Default && c.Default == "" {
+			b.WriteString(column + "DROP DEFAULT;\n")
+		}
+		if old.Default != c.Default && c.Default != "" {
+			b.WriteString(column + "SET DEFAULT " + c.Default + ";\n")
+		}
+	}
+}
+
+func equalIndex(a, b *Index) bool {
+	return a.Unique == b.Unique && equalStrings(a.Columns, b.Columns)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/petomalina/mirror/bundles/internal/sqlmodel"
+	"strings"
+)
+
+// Schema is the snapshot of the generated tables. It is stored in the out
+// directory, so the next generation can migrate the changes of the models
+type Schema struct {
+	Dialect string   `json:"dialect"`
+	Tables  []*Table `json:"tables"`
+}
+
+type Table struct {
+	Name    string    `json:"name"`
+	Columns []*Column `json:"columns"`
+	Indexes []*Index  `json:"indexes,omitempty"`
+}
+
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable,omitempty"`
+	Primary  bool   `json:"primary,omitempty"`
+
+	// Default is the SQL expression of the default value
+	Default string `json:"default,omitempty"`
+}
+
+type Index struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique,omitempty"`
+}
+
+// Table returns the table with the name, nil if there is none
+func (s *Schema) Table(name string) *Table {
+	for _, t := range s.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// Column returns the column with the name, nil if there is none
+func (t *Table) Column(name string) *Column {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Index returns the index with the name, nil if there is none
+func (t *Table) Index(name string) *Index {
+	for _, i := range t.Indexes {
+		if i.Name == name {
+			return i
+		}
+	}
+
+	return nil
+}
+
+// PrimaryKey returns the columns of the primary key
+func (t *Table) PrimaryKey() []string {
+	var pk []string
+	for _, c := range t.Columns {
+		if c.Primary {
+			pk = append(pk, c.Name)
+		}
+	}
+
+	return pk
+}
+
+// CreateTable returns the statements creating the table and its indexes
+func (d *Dialect) CreateTable(t *Table) string {
+	defs := make([]string, 0, len(t.Columns)+1)
+	for _, c := range t.Columns {
+		defs = append(defs, d.ColumnDefinition(c))
+	}
+	if pk := t.PrimaryKey(); len(pk) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+d.QuoteAll(pk)+")")
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("CREATE TABLE " + d.Quote(t.Name) + " (\n\t" + strings.Join(defs, ",\n\t") + "\n);\n")
+	for _, i := range t.Indexes {
+		b.WriteString(d.CreateIndex(t, i))
+	}
+
+	return b.String()
+}
+
+// ColumnDefinition returns the definition of the column as used by the CREATE TABLE
+func (d *Dialect) ColumnDefinition(c *Column) string {
+	def := d.Quote(c.Name) + " " + c.Type
+	if !c.Nullable {
+		def += " NOT NULL"
+	}
+	if c.Default != "" {
+		def += " DEFAULT " + c.Default
+	}
+
+	return def
+}
+
+func (d *Dialect) CreateIndex(t *Table, i *Index) string {
+	create := "CREATE INDEX "
+	if i.Unique {
+		create = "CREATE UNIQUE INDEX "
+	}
+
+	return create + d.Quote(i.Name) + " ON " + d.Quote(t.Name) + " (" + d.QuoteAll(i.Columns) + ");\n"
+}
+
+func (d *Dialect) DropIndex(t *Table, i *Index) string {
+	if d.Name == sqlmodel.MySQL {
+		return "DROP INDEX " + d.Quote(i.Name) + " ON " + d.Quote(t.Name) + ";\n"
+	}
+
+	return "DROP INDEX " + d.Quote(i.Name) + ";\n"
+}
+
+// Quote quotes the identifier
+func (d *Dialect) Quote(name string) string {
+	return sqlmodel.Quote(d.Name, name)
+}
+
+func (d *Dialect) QuoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = d.Quote(n)
+	}
+
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+type Address struct {
+	Street string `validate:"required"`
+	Zip    string `validate:"len=5"`
+}
+
+type Contact struct {
+	Phone string
+}
+
+func (c Contact) Validate() error {
+	if c.Phone == "" {
+		return errors.New("has no phone")
+	}
+
+	return nil
+}
+
+type User struct {
+	Name     string        `validate:"required,min=3,max=8"`
+	Email    string        `validate:"omitempty,email"`
+	Age      int           `validate:"min=18,max=130"`
+	Role     string        `validate:"oneof=admin user"`
+	Level    uint8         `validate:"oneof=1 2 3"`
+	Timeout  time.Duration `validate:"min=1s"`
+	Tags     []string      `validate:"max=2"`
+	Nick     *string       `validate:"required,min=2"`
+	Home     *Address      `validate:"required"`
+	Offices  []Address
+	Contacts map[string]Contact
+	Accepted bool     `validate:"required"`
+	Ignored  *Address `validate:"-"`
+}
+
+type UnknownRule struct {
+	Name string `validate:"requird"`
+}
+
+type InvalidArgument struct {
+	Age int `validate:"min=young"`
+}
+
+type MissingArgument struct {
+	Name string `validate:"max="`
+}
+
+type RepeatedNumber struct {
+	Level int `validate:"oneof=1 01"`
+}
+
+type RepeatedString struct {
+	Role string `validate:"oneof=admin user admin"`
+}
+
+type InvalidKind struct {
+	Age int `validate:"email"`
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+	"log"
+	"reflect"
+	"text/template"
+)
+
+var (
+	ErrOutsideOfPackage = errors.New("Validate methods can be generated only into the package of the models")
+	ErrUnknownRule      = errors.New("The validation rule is unknown")
+	ErrRuleArgument     = errors.New("The argument of the validation rule is missing or invalid")
+	ErrRuleKind         = errors.New("The validation rule can't be applied to the kind of the field")
+)
+
+// TagKey is the key of the struct tag with the validation rules of the field,
+// e.g. validate:"required,min=3,max=64". Rules are required, omitempty, min,
+// max, len, email and oneof with values separated by spaces. validate:"-"
+// skips the field, including the validation of the models within it
+const TagKey = "validate"
+
+var helpersTemplate = template.Must(template.New("helpers").Parse(`
+// ValidationError is the error of the field at the path, e.g. Items[0].Name
+type ValidationError struct {
+	Path    string
+	Rule    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + " " + e.Message
+}
+
+// ValidationErrors are all errors of the validated model
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationErrors) add(path, rule, message string) {
+	*e = append(*e, &ValidationError{Path: path, Rule: rule, Message: message})
+}
+
+func validationPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+
+	return path + "." + field
+}
+
+func validationIndex(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+func validationEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+`))
+
+var validateTemplate = template.Must(template.New("validate").Parse(`
+// Validate validates the {{ .Name }} by the rules of its validate tags,
+// returning ValidationErrors of all invalid fields
+func (in *{{ .Name }}) Validate() error {
+	var errs ValidationErrors
+	in.validate("", &errs)
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (in *{{ .Name }}) validate(path string, errs *ValidationErrors) {
+{{ .Body -}}
+}
+`))
+
+type templateData struct {
+	Name string
+	Body string
+}
+
+func main() {
+	if err := mirror.RunDefaultApp("mirror-validate", ProcessModel); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ProcessModel generates the Validate method for each model. Rules are checked
+// when generating, so their typos fail the generation instead of the validation.
+// Methods are declared on the models, so they are generated into their package
+func ProcessModel(models mirror.StructSlice, out *mirror.Writer, pkg *packages.Package) error {
+	if err := models.RequireTypes(); err != nil {
+		return err
+	}
+
+	temp := out.File("validate.go")
+	temp.AddImports("net/mail", "strconv", "strings")
+	q := mirror.OutQualifier(out, pkg)
+
+	// models validate the models within them
+	generated := map[reflect.Type]bool{}
+	for _, rs := range models {
+		if rs.Type() != nil {
+			generated[rs.Type()] = true
+		}
+	}
+
+	if err := temp.AddTemplate(helpersTemplate, nil); err != nil {
+		return err
+	}
+
+	for _, rs := range models {
+		if q(rs.PkgPath(), rs.PackageName()) != "" {
+			return errors.Wrap(ErrOutsideOfPackage, rs.Name())
+		}
+
+		v := &validator{checker: &checker{Code: mirror.NewCode(rs, q)}, generated: generated}
+		if err := v.validateModel(); err != nil {
+			return errors.Wrap(err, rs.Name())
+		}
+		temp.AddImports(v.Imports...)
+
+		err := temp.AddTemplate(validateTemplate, &templateData{
+			Name: rs.Name(),
+			Body: v.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return temp.Write()
+}
+
+// validator writes the body of the validate of the model, checking the rules
+// of its fields and validating the models and validators within them
+type validator struct {
+	*checker
+
+	generated map[reflect.Type]bool
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func (v *validator) validateModel() error {
+	for _, f := range v.Model.RawFields() {
+		if f.HasTagOption(TagKey, "-") {
+			continue
+		}
+
+		rules, err := parseRules(f.Field.Tag.Get(TagKey))
+		if err != nil {
+			return errors.Wrap(err, f.Field.Name)
+		}
+
+		x := "in." + f.Field.Name
+		path := "validationPath(path, " + `"` + f.Field.Name + `"` + ")"
+
+		if err := v.checkRules(f.Typ, x, path, rules, 1); err != nil {
+			return errors.Wrap(err, f.Field.Name)
+		}
+		v.nested(f.Typ, x, path, 1)
+	}
+
+	return nil
+}
+
+// nested writes the validation of the models and validators within the value
+func (v *validator) nested(t reflect.Type, x, path string, depth int) {
+	if !v.validated(t, map[reflect.Type]bool{}) {
+		return
+	}
+
+	switch {
+	case v.generated[t]:
+		v.Line(depth, "%s.validate(%s, errs)", mirror.Paren(x), path)
+		return
+	case mirror.HasMethod(t, "Validate", nil, []reflect.Type{errorType}):
+		v.Line(depth, "if err := %s.Validate(); err != nil {", mirror.Paren(x))
+		v.Line(depth+1, "errs.add(%s, \"Validate\", err.Error())", path)
+		v.Line(depth, "}")
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		v.Line(depth, "if %s != nil {", x)
+		v.nested(t.Elem(), "(*"+x+")", path, depth+1)
+		v.Line(depth, "}")
+	case reflect.Slice, reflect.Array:
+		i := v.Var("i")
+		v.Line(depth, "for %s := range %s {", i, x)
+		v.nested(t.Elem(), x+"["+i+"]", "validationIndex("+path+", "+i+")", depth+1)
+		v.Line(depth, "}")
+	case reflect.Map:
+		k, e := v.Var("k"), v.Var("v")
+		v.Imports = append(v.Imports, "fmt")
+		v.Line(depth, "for %s, %s := range %s {", k, e, x)
+		v.nested(t.Elem(), e, path+" + \"[\" + fmt.Sprint("+k+") + \"]\"", depth+1)
+		v.Line(depth, "}")
+	}
+}
+
+// validated returns true if there are models or validators within the type
+func (v *validator) validated(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	if v.generated[t] || mirror.HasMethod(t, "Validate", nil, []reflect.Type{errorType}) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return v.validated(t.Elem(), visited)
+	}
+
+	return false
+}
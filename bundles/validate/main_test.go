@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror"
+	"github.com/petomalina/mirror/bundles/internal/bundletest"
+	"github.com/petomalina/mirror/pkg/bundle"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+const usageSource = `package user
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func valid() *User {
+	nick := "jd"
+	return &User{
+		Name:     "john",
+		Age:      30,
+		Role:     "admin",
+		Level:    2,
+		Timeout:  time.Minute,
+		Nick:     &nick,
+		Home:     &Address{Street: "Main", Zip: "12345"},
+		Offices:  []Address{{Street: "Side", Zip: "54321"}},
+		Contacts: map[string]Contact{"work": {Phone: "123"}},
+		Accepted: true,
+		Ignored:  &Address{},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := valid().Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	nick := "j"
+	u := &User{
+		Name:     "jo",
+		Email:    "not an email",
+		Age:      200,
+		Role:     "root",
+		Level:    4,
+		Timeout:  time.Millisecond,
+		Tags:     []string{"a", "b", "c"},
+		Nick:     &nick,
+		Offices:  []Address{{Street: "Side", Zip: "12345"}, {Zip: "1"}},
+		Contacts: map[string]Contact{"home": {}},
+	}
+
+	errs, ok := u.Validate().(ValidationErrors)
+	if !ok {
+		t.Fatal("Expected validation errors")
+	}
+
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Path+" "+err.Rule)
+	}
+
+	expected := []string{
+		"Name min", "Email email", "Age max", "Role oneof", "Level oneof", "Timeout min", "Tags max",
+		"Nick min", "Home required", "Offices[1].Street required", "Offices[1].Zip len",
+		"Contacts[home] Validate", "Accepted required",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Got %v, expected %v", got, expected)
+	}
+
+	if errs[0].Error() != "Name must have at least 3 characters" {
+		t.Fatal("Unexpected message:", errs[0].Error())
+	}
+}
+`
+
+type ValidateSuite struct {
+	suite.Suite
+}
+
+type ValidateCandidate struct {
+	name   string
+	models []interface{}
+	outDir string
+
+	err error
+}
+
+func (s *ValidateSuite) TearDownTest() {
+	s.NoError(bundletest.Clean())
+}
+
+func (s *ValidateSuite) TestProcessModel() {
+	s.NoError(bundletest.WriteModule("1.16"))
+	s.NoError(bundletest.WritePackage("user", "fixtures_test.go"))
+	s.NoError(bundletest.WriteFile("user", "usage_test.go", usageSource))
+
+	models := bundletest.Models("user", &User{}, &Address{})
+	s.NoError(ProcessModel(models, bundle.NewWriter(bundletest.Dir("user")), bundletest.Package("user")))
+	s.NoError(bundletest.GoTest())
+}
+
+func (s *ValidateSuite) TestProcessModelErrors() {
+	dir := bundletest.Dir("user")
+
+	candidates := []ValidateCandidate{
+		{
+			name:   "Get error for an unknown rule",
+			models: []interface{}{&UnknownRule{}},
+			outDir: dir,
+			err:    ErrUnknownRule,
+		},
+		{
+			name:   "Get error for an invalid argument",
+			models: []interface{}{&InvalidArgument{}},
+			outDir: dir,
+			err:    ErrRuleArgument,
+		},
+		{
+			name:   "Get error for a missing argument",
+			models: []interface{}{&MissingArgument{}},
+			outDir: dir,
+			err:    ErrRuleArgument,
+		},
+		{
+			name:   "Get error for a number repeated in the oneof values",
+			models: []interface{}{&RepeatedNumber{}},
+			outDir: dir,
+			err:    ErrRuleArgument,
+		},
+		{
+			name:   "Get error for a string repeated in the oneof values",
+			models: []interface{}{&RepeatedString{}},
+			outDir: dir,
+			err:    ErrRuleArgument,
+		},
+		{
+			name:   "Get error for a rule of another kind",
+			models: []interface{}{&InvalidKind{}},
+			outDir: dir,
+			err:    ErrRuleKind,
+		},
+		{
+			name:   "Get error for models outside of the out package",
+			models: []interface{}{&Address{}},
+			outDir: bundletest.Dir("out"),
+			err:    ErrOutsideOfPackage,
+		},
+		{
+			name:   "Get error for a described model",
+			models: []interface{}{&plugins.TypeDescription{Name: "Address", Kind: "struct"}},
+			outDir: dir,
+			err:    mirror.ErrDescribedModel,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		err := ProcessModel(bundletest.Models("user", c.models...), bundle.NewWriter(c.outDir), bundletest.Package("user"))
+		s.EqualValues(c.err, errors.Cause(err))
+	}
+}
+
+func TestValidateSuite(t *testing.T) {
+	suite.Run(t, &ValidateSuite{})
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"github.com/petomalina/mirror"
+	"github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// rule is a single validation rule of the tag, e.g. min=3
+type rule struct {
+	name string
+	arg  string
+}
+
+// parseRules parses the rules of the tag, checking their names and
+// whether their arguments are present
+func parseRules(tag string) ([]rule, error) {
+	var rules []rule
+	for _, r := range strings.Split(tag, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		name, arg := r, ""
+		if i := strings.Index(r, "="); i >= 0 {
+			name, arg = r[:i], r[i+1:]
+		}
+
+		switch name {
+		case "required", "omitempty", "email":
+			if arg != "" {
+				return nil, errors.Wrap(ErrRuleArgument, r)
+			}
+		case "min", "max", "len", "oneof":
+			if strings.TrimSpace(arg) == "" {
+				return nil, errors.Wrap(ErrRuleArgument, r)
+			}
+		default:
+			return nil, errors.Wrap(ErrUnknownRule, r)
+		}
+
+		rules = append(rules, rule{name: name, arg: arg})
+	}
+
+	return rules, nil
+}
+
+// checker writes the checks of the rules, adding errors to errs
+type checker struct {
+	*mirror.Code
+}
+
+// checkRules writes the checks of the rules of the value at the path. The
+// required rule of pointers checks the pointer, other rules check its value
+func (c *checker) checkRules(t reflect.Type, x, path string, rules []rule, depth int) error {
+	if t.Kind() == reflect.Ptr {
+		var rest []rule
+		for _, r := range rules {
+			if r.name == "required" {
+				c.addIf(x+" == nil", path, r, "is required", depth)
+			} else if r.name != "omitempty" {
+				rest = append(rest, r)
+			}
+		}
+		if len(rest) == 0 {
+			return nil
+		}
+
+		c.Line(depth, "if %s != nil {", x)
+		if err := c.checkRules(t.Elem(), "(*"+x+")", path, rest, depth+1); err != nil {
+			return err
+		}
+		c.Line(depth, "}")
+		return nil
+	}
+
+	// omitempty skips the rules of the zero values
+	for _, r := range rules {
+		if r.name == "omitempty" {
+			zero, err := c.zero(t, x)
+			if err != nil {
+				return errors.Wrap(err, r.name)
+			}
+
+			body := c.Capture(func() {
+				err = c.checkValue(t, x, path, rules, depth+1)
+			})
+			if err != nil || body == "" {
+				return err
+			}
+
+			c.Line(depth, "if !(%s) {", zero)
+			c.Write(body)
+			c.Line(depth, "}")
+			return nil
+		}
+	}
+
+	return c.checkValue(t, x, path, rules, depth)
+}
+
+// checkValue writes the checks of the rules of the non-pointer value
+func (c *checker) checkValue(t reflect.Type, x, path string, rules []rule, depth int) error {
+	for _, r := range rules {
+		var err error
+		switch r.name {
+		case "required":
+			var zero string
+			if zero, err = c.zero(t, x); err == nil {
+				c.addIf(zero, path, r, "is required", depth)
+			}
+		case "min":
+			err = c.compare(t, x, path, r, "<", "at least", depth)
+		case "max":
+			err = c.compare(t, x, path, r, ">", "at most", depth)
+		case "len":
+			err = c.length(t, x, path, r, depth)
+		case "email":
+			if t.Kind() != reflect.String {
+				err = ErrRuleKind
+				break
+			}
+			c.addIf("!validationEmail(string("+x+"))", path, r, "must be a valid email address", depth)
+		case "oneof":
+			err = c.oneOf(t, x, path, r, depth)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "%s for %s", r.name, t)
+		}
+	}
+
+	return nil
+}
+
+// compare writes the check of the min or max rule, which compares values
+// of numbers, counts of characters of strings and lengths of other values
+func (c *checker) compare(t reflect.Type, x, path string, r rule, op, bound string, depth int) error {
+	if isNumber(t) {
+		lit, err := c.Model.Literal(t, r.arg, c.Q)
+		if err != nil {
+			return errors.Wrap(ErrRuleArgument, err.Error())
+		}
+
+		c.Type(t)
+		c.addIf(x+" "+op+" "+lit, path, r, "must be "+bound+" "+r.arg, depth)
+		return nil
+	}
+
+	n, length, unit, err := c.lengthOf(t, x, r)
+	if err != nil {
+		return err
+	}
+
+	c.addIf(length+" "+op+" "+n, path, r, "must have "+bound+" "+n+" "+unit, depth)
+	return nil
+}
+
+// length writes the check of the len rule
+func (c *checker) length(t reflect.Type, x, path string, r rule, depth int) error {
+	n, length, unit, err := c.lengthOf(t, x, r)
+	if err != nil {
+		return err
+	}
+
+	c.addIf(length+" != "+n, path, r, "must have exactly "+n+" "+unit, depth)
+	return nil
+}
+
+// lengthOf returns the length argument of the rule together with the length
+// expression of the value and the unit of the length
+func (c *checker) lengthOf(t reflect.Type, x string, r rule) (string, string, string, error) {
+	n, err := strconv.Atoi(r.arg)
+	if err != nil || n < 0 {
+		return "", "", "", errors.Wrap(ErrRuleArgument, r.arg)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		c.Imports = append(c.Imports, "unicode/utf8")
+		return strconv.Itoa(n), "utf8.RuneCountInString(string(" + x + "))", "characters", nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return strconv.Itoa(n), "len(" + x + ")", "elements", nil
+	}
+
+	return "", "", "", ErrRuleKind
+}
+
+// oneOf writes the check of the oneof rule, its values are separated by spaces
+func (c *checker) oneOf(t reflect.Type, x, path string, r rule, depth int) error {
+	if t.Kind() != reflect.String && !isNumber(t) {
+		return ErrRuleKind
+	}
+
+	values := strings.Fields(r.arg)
+	lits := make([]string, len(values))
+	seen := map[string]bool{}
+	for i, v := range values {
+		lit := strconv.Quote(v)
+		if t.Kind() != reflect.String {
+			var err error
+			lit, err = c.Model.Literal(t, v, c.Q)
+			if err != nil {
+				return errors.Wrap(ErrRuleArgument, err.Error())
+			}
+		}
+
+		// the values are the cases of the switch, which can't be repeated
+		if seen[lit] {
+			return errors.Wrapf(ErrRuleArgument, "%s repeats the value %s", r.name, v)
+		}
+		seen[lit] = true
+		lits[i] = lit
+	}
+
+	value := x
+	if t.Kind() == reflect.String {
+		value = "string(" + x + ")"
+	} else {
+		c.Type(t)
+	}
+
+	c.Line(depth, "switch %s {", value)
+	c.Line(depth, "case %s:", strings.Join(lits, ", "))
+	c.Line(depth, "default:")
+	c.add(path, r, "must be one of "+strings.Join(values, ", "), depth+1)
+	c.Line(depth, "}")
+	return nil
+}
+
+// zero returns the condition of the value being zero
+func (c *checker) zero(t reflect.Type, x string) (string, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "!" + x, nil
+	case reflect.String, reflect.Slice, reflect.Map:
+		return "len(" + x + ") == 0", nil
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		return x + " == nil", nil
+	case reflect.Array, reflect.Struct:
+		if !t.Comparable() || !c.Accessible(t, func(reflect.StructField) bool { return true }) {
+			return "", ErrRuleKind
+		}
+		return x + " == (" + c.Type(t) + "{})", nil
+	}
+
+	if isNumber(t) {
+		return x + " == 0", nil
+	}
+
+	return "", ErrRuleKind
+}
+
+// addIf writes the error of the rule added if the condition holds
+func (c *checker) addIf(cond, path string, r rule, message string, depth int) {
+	c.Line(depth, "if %s {", cond)
+	c.add(path, r, message, depth+1)
+	c.Line(depth, "}")
+}
+
+func (c *checker) add(path string, r rule, message string, depth int) {
+	c.Line(depth, "errs.add(%s, %s, %s)", path, strconv.Quote(r.name), strconv.Quote(message))
+}
+
+func isNumber(t reflect.Type) bool {
+	return t.Kind() >= reflect.Int && t.Kind() <= reflect.Float64
+}
@@ -0,0 +1,198 @@
+package mirror
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Code writes the statements of the generated code walking the fields of
+// the Model recursively, e.g. to copy or compare them. Types written by the
+// Code are qualified by the Q and their packages are collected in Imports
+type Code struct {
+	Model *Struct
+	Q     Qualifier
+
+	Imports []string
+
+	buf *bytes.Buffer
+
+	// entered are the named types being walked, so walks of
+	// recursive types can be stopped
+	entered map[reflect.Type]bool
+
+	// vars is the number of variables named by the Var
+	vars int
+}
+
+// NewCode creates the Code for the model and the qualifier
+func NewCode(model *Struct, q Qualifier) *Code {
+	return &Code{
+		Model:   model,
+		Q:       q,
+		buf:     &bytes.Buffer{},
+		entered: map[reflect.Type]bool{},
+	}
+}
+
+// Line writes the formatted line indented by the depth
+func (c *Code) Line(depth int, format string, args ...interface{}) {
+	c.buf.WriteString(strings.Repeat("\t", depth))
+	c.buf.WriteString(fmt.Sprintf(format, args...))
+	c.buf.WriteString("\n")
+}
+
+// Capture returns the code written by the fn instead of writing it, so
+// the caller can decide whether to write it, e.g. only if it isn't empty
+func (c *Code) Capture(fn func()) string {
+	buf := c.buf
+	c.buf = &bytes.Buffer{}
+	fn()
+
+	captured := c.buf.String()
+	c.buf = buf
+	return captured
+}
+
+// Write writes the code, e.g. the captured one
+func (c *Code) Write(code string) {
+	c.buf.WriteString(code)
+}
+
+// String returns the written code
+func (c *Code) String() string {
+	return c.buf.String()
+}
+
+// Var returns a new variable name with the prefix, unique within the Code,
+// so nested blocks of the generated code don't shadow each other
+func (c *Code) Var(prefix string) string {
+	c.vars++
+	return prefix + strconv.Itoa(c.vars)
+}
+
+// Type returns the type as written in the generated code and collects its imports
+func (c *Code) Type(t reflect.Type) string {
+	for _, i := range c.Model.TypeImports(t, c.Q) {
+		if !containsString(c.Imports, i) {
+			c.Imports = append(c.Imports, i)
+		}
+	}
+
+	return c.Model.TypeString(t, c.Q)
+}
+
+// Enter marks the named type as walked and returns false if it is already
+// being walked, which happens for recursive types. Leave unmarks the type
+func (c *Code) Enter(t reflect.Type) bool {
+	if t.Name() == "" {
+		return true
+	}
+	if c.entered[t] {
+		return false
+	}
+
+	c.entered[t] = true
+	return true
+}
+
+// Leave unmarks the type marked by the Enter
+func (c *Code) Leave(t reflect.Type) {
+	delete(c.entered, t)
+}
+
+// Local returns true if the named type is declared by the package
+// of the generated code
+func (c *Code) Local(t reflect.Type) bool {
+	return t.Name() != "" && !strings.Contains(c.Model.TypeString(t, c.Q), ".")
+}
+
+// Accessible returns true if the generated code can refer to the type and
+// all fields of its structs that match the filter, which are the fields
+// the generated code walks. Unexported fields of other packages and
+// unexported types of other packages are not accessible
+func (c *Code) Accessible(t reflect.Type, filter func(reflect.StructField) bool) bool {
+	return c.accessible(t, filter, map[reflect.Type]bool{})
+}
+
+func (c *Code) accessible(t reflect.Type, filter func(reflect.StructField) bool, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return true
+	}
+	visited[t] = true
+
+	if t.Name() != "" && t.PkgPath() != "" && !isExported(t.Name()) && !c.Local(t) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return c.accessible(t.Elem(), filter, visited)
+	case reflect.Map:
+		return c.accessible(t.Key(), filter, visited) && c.accessible(t.Elem(), filter, visited)
+	case reflect.Struct:
+		local := t.Name() == "" || c.Local(t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !filter(f) {
+				continue
+			}
+			if !local && f.PkgPath != "" || !c.accessible(f.Type, filter, visited) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// HasMethod returns true if the type or the pointer to it has the method
+// with the given name, arguments and results. Receivers are not included
+func HasMethod(t reflect.Type, name string, in []reflect.Type, out []reflect.Type) bool {
+	if t.Name() == "" || t.Kind() == reflect.Interface {
+		return false
+	}
+
+	m, ok := reflect.PtrTo(t).MethodByName(name)
+	if !ok || m.Type.NumIn() != len(in)+1 || m.Type.NumOut() != len(out) {
+		return false
+	}
+
+	for i, arg := range in {
+		if m.Type.In(i+1) != arg {
+			return false
+		}
+	}
+	for i, res := range out {
+		if m.Type.Out(i) != res {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Paren parenthesizes dereferences, so methods can be called on their values
+func Paren(expr string) string {
+	if strings.HasPrefix(expr, "*") || strings.HasPrefix(expr, "&") {
+		return "(" + expr + ")"
+	}
+
+	return expr
+}
+
+func isExported(name string) bool {
+	return strings.Title(name) == name
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,143 @@
+package mirror
+
+import (
+	"github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLiteralKind  = errors.New("Literals of the kind of the type are not supported")
+	ErrLiteralValue = errors.New("The value can't be parsed as a literal of the type")
+)
+
+// PromotedFields returns the fields of the struct together with the fields
+// promoted from its embedded structs, as they are accessible on the struct.
+// Field.Index of the promoted fields is the index sequence for FieldByIndex.
+// Shadowed and ambiguous fields are skipped, as are fields promoted through
+// embedded pointers, which may be nil
+func (s *Struct) PromotedFields() []RawStructFieldType {
+	rf := []RawStructFieldType{}
+
+	raw := s.RawFields()
+	if len(raw) == 0 {
+		return rf
+	}
+
+	sValue := raw[0].Value
+	return promoteFields(sValue, sValue.Type(), nil, rf)
+}
+
+func promoteFields(sValue reflect.Value, t reflect.Type, index []int, rf []RawStructFieldType) []RawStructFieldType {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		// the field is visible only if the name resolves to it on the struct
+		visible, ok := sValue.Type().FieldByName(f.Name)
+		if !ok || !equalIndex(visible.Index, fieldIndex) {
+			continue
+		}
+
+		rf = append(rf, RawStructFieldType{
+			Value: sValue,
+			Field: visible,
+			Typ:   f.Type,
+		})
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			rf = promoteFields(sValue, f.Type, fieldIndex, rf)
+		}
+	}
+
+	return rf
+}
+
+func equalIndex(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Promoted returns true if the field is promoted from an embedded struct
+func (f *RawStructFieldType) Promoted() bool {
+	return len(f.Field.Index) > 1
+}
+
+// TagOptions returns comma separated options of the tag with the given key,
+// e.g. [required] for builder:"required". Nil is returned for missing tags
+func (f *RawStructFieldType) TagOptions(key string) []string {
+	tag, ok := f.Field.Tag.Lookup(key)
+	if !ok {
+		return nil
+	}
+
+	return strings.Split(tag, ",")
+}
+
+// HasTagOption returns true if the tag with the given key has the option
+func (f *RawStructFieldType) HasTagOption(key, option string) bool {
+	for _, o := range f.TagOptions(key) {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Literal returns the Go expression of the value parsed according to the kind
+// of the type, e.g. time.Duration(30000000000) for 30s of a time.Duration.
+// Strings, booleans, numbers and durations are supported
+func (s *Struct) Literal(t reflect.Type, value string, q Qualifier) (string, error) {
+	var lit string
+	var err error
+
+	switch {
+	case t.PkgPath() == "time" && t.Name() == "Duration":
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		lit = strconv.FormatInt(int64(d), 10)
+	case t.Kind() == reflect.String:
+		lit = strconv.Quote(value)
+	case t.Kind() == reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(value)
+		lit = strconv.FormatBool(b)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(value, 0, t.Bits())
+		lit = strconv.FormatInt(i, 10)
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uintptr:
+		var u uint64
+		u, err = strconv.ParseUint(value, 0, t.Bits())
+		lit = strconv.FormatUint(u, 10)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		var fl float64
+		fl, err = strconv.ParseFloat(value, t.Bits())
+		lit = strconv.FormatFloat(fl, 'g', -1, t.Bits())
+	default:
+		return "", errors.Wrap(ErrLiteralKind, t.String())
+	}
+
+	if err != nil {
+		return "", errors.Wrap(ErrLiteralValue, err.Error())
+	}
+
+	// named types are converted, so the literal can be assigned anywhere
+	if t.PkgPath() != "" {
+		return s.TypeString(t, q) + "(" + lit + ")", nil
+	}
+
+	return lit, nil
+}
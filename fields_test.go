@@ -0,0 +1,131 @@
+package mirror
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fieldsBase struct {
+	ID   string
+	Name string
+}
+
+type fieldsNested struct {
+	fieldsBase
+
+	Version int
+}
+
+type fieldsModel struct {
+	fieldsNested
+	*fieldsBase `json:"-"`
+
+	Name  string `builder:"required,omitempty"`
+	Email Email
+}
+
+type FieldsSuite struct {
+	suite.Suite
+}
+
+type LiteralCandidate struct {
+	name  string
+	value interface{}
+	lit   string
+
+	expected string
+	err      error
+}
+
+func (s *FieldsSuite) TestPromotedFields() {
+	names := []string{}
+	for _, f := range ReflectStruct(&fieldsModel{}).PromotedFields() {
+		names = append(names, fmt.Sprint(f.Field.Name, f.Field.Index))
+	}
+
+	// ID is ambiguous between the nested and the pointer base and
+	// Name is shadowed by the field of the model
+	s.EqualValues([]string{"fieldsNested[0]", "Version[0 1]", "fieldsBase[1]", "Name[2]", "Email[3]"}, names)
+}
+
+func (s *FieldsSuite) TestTagOptions() {
+	fields := ReflectStruct(&fieldsModel{}).RawFields()
+
+	s.EqualValues([]string{"required", "omitempty"}, fields[2].TagOptions("builder"))
+	s.True(fields[2].HasTagOption("builder", "required"))
+	s.False(fields[2].HasTagOption("builder", "-"))
+	s.Nil(fields[3].TagOptions("builder"))
+}
+
+func (s *FieldsSuite) TestLiteral() {
+	candidates := []LiteralCandidate{
+		{
+			name:     "Quote strings",
+			value:    "",
+			lit:      `say "hi"`,
+			expected: `"say \"hi\""`,
+		},
+		{
+			name:     "Convert named types",
+			value:    Email(""),
+			lit:      "peter@x.io",
+			expected: `user.Email("peter@x.io")`,
+		},
+		{
+			name:     "Parse durations",
+			value:    time.Duration(0),
+			lit:      "30s",
+			expected: "time.Duration(30000000000)",
+		},
+		{
+			name:     "Parse numbers",
+			value:    uint8(0),
+			lit:      "0x10",
+			expected: "16",
+		},
+		{
+			name:     "Parse floats",
+			value:    float64(0),
+			lit:      "0.5",
+			expected: "0.5",
+		},
+		{
+			name:     "Parse booleans",
+			value:    false,
+			lit:      "true",
+			expected: "true",
+		},
+		{
+			name:  "Get error for overflowing numbers",
+			value: int8(0),
+			lit:   "300",
+			err:   ErrLiteralValue,
+		},
+		{
+			name:  "Get error for unsupported kinds",
+			value: []string{},
+			lit:   "a,b",
+			err:   ErrLiteralKind,
+		},
+	}
+
+	ref := ReflectStruct(&fieldsModel{})
+	ref.OriginalPackage = "example.com/user"
+	ref.OriginalPackageName = "user"
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		lit, err := ref.Literal(reflect.TypeOf(c.value), c.lit, QualifyFor("example.com/out"))
+		s.EqualValues(c.err, errors.Cause(err))
+		s.EqualValues(c.expected, lit)
+	}
+}
+
+func TestFieldsSuite(t *testing.T) {
+	suite.Run(t, &FieldsSuite{})
+}
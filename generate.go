@@ -0,0 +1,87 @@
+package mirror
+
+import (
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	ErrNoModelAfterDirective = errors.New("No type is declared immediately after the go:generate directive")
+)
+
+// GoGenerate is the environment set by go generate for the directive
+// that invoked the bundle. Go generate runs the bundle within the directory
+// of the file, which the unset --pkg and --out default to
+type GoGenerate struct {
+	// File is the base name of the file with the directive (GOFILE)
+	File string
+
+	// Package is the name of the package of the file (GOPACKAGE)
+	Package string
+
+	// Line is the line number of the directive within the file (GOLINE)
+	Line int
+}
+
+// LookupGoGenerate returns the go generate environment if the bundle
+// was invoked by a go:generate directive
+func LookupGoGenerate() (*GoGenerate, bool) {
+	file, pkg, line := os.Getenv("GOFILE"), os.Getenv("GOPACKAGE"), os.Getenv("GOLINE")
+	if file == "" || pkg == "" || line == "" {
+		return nil, false
+	}
+
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return nil, false
+	}
+
+	return &GoGenerate{
+		File:    file,
+		Package: pkg,
+		Line:    n,
+	}, true
+}
+
+// Dir returns the absolute directory of the file with the directive, which
+// go generate runs the bundle in. It is the default --pkg and --out
+func (g *GoGenerate) Dir() (string, error) {
+	return filepath.Abs(filepath.Dir(g.File))
+}
+
+// ModelsAfterDirective returns names of the types declared immediately after
+// the directive, e.g. User for a directive placed above type User struct.
+// All types of a grouped declaration are returned
+func (g *GoGenerate) ModelsAfterDirective() ([]string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, g.File, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, decl := range f.Decls {
+		if fset.Position(decl.Pos()).Line <= g.Line {
+			continue
+		}
+
+		// only the first declaration after the directive is considered
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			break
+		}
+
+		names := []string{}
+		for _, spec := range genDecl.Specs {
+			names = append(names, spec.(*ast.TypeSpec).Name.Name)
+		}
+
+		return names, nil
+	}
+
+	return nil, errors.Wrapf(ErrNoModelAfterDirective, "%s:%d", g.File, g.Line)
+}
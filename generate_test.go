@@ -0,0 +1,210 @@
+package mirror
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const GenerateTestDir = ".testgenerate"
+
+type GoGenerateSuite struct {
+	suite.Suite
+}
+
+type GoGenerateCandidate struct {
+	name string
+	src  string
+	line int
+
+	models []string
+	err    error
+}
+
+func (s *GoGenerateSuite) SetupTest() {
+	s.NoError(os.MkdirAll(GenerateTestDir, os.ModePerm))
+}
+
+func (s *GoGenerateSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(GenerateTestDir))
+	s.NoError(os.RemoveAll(plugins.DefaultCache))
+
+	for _, env := range []string{"GOFILE", "GOPACKAGE", "GOLINE"} {
+		s.NoError(os.Unsetenv(env))
+	}
+}
+
+func (s *GoGenerateSuite) TestModelsAfterDirective() {
+	candidates := []GoGenerateCandidate{
+		{
+			name: "Infer the type right after the directive",
+			src: `package user
+
+//go:generate mirror-functional
+type User struct{}
+`,
+			line:   3,
+			models: []string{"User"},
+		},
+		{
+			name: "Infer the type documented after the directive",
+			src: `package user
+
+//go:generate mirror-functional
+
+// User is documented
+type User struct{}
+`,
+			line:   3,
+			models: []string{"User"},
+		},
+		{
+			name: "Infer all types of a grouped declaration",
+			src: `package user
+
+//go:generate mirror-functional
+type (
+	User  struct{}
+	Email string
+)
+`,
+			line:   3,
+			models: []string{"User", "Email"},
+		},
+		{
+			name: "Skip types declared before the directive",
+			src: `package user
+
+type Admin struct{}
+
+//go:generate mirror-functional
+type User struct{}
+`,
+			line:   5,
+			models: []string{"User"},
+		},
+		{
+			name: "Get error when a function follows the directive",
+			src: `package user
+
+//go:generate mirror-functional
+func main() {}
+
+type User struct{}
+`,
+			line: 3,
+			err:  ErrNoModelAfterDirective,
+		},
+		{
+			name: "Get error when nothing follows the directive",
+			src: `package user
+
+type User struct{}
+
+//go:generate mirror-functional
+`,
+			line: 5,
+			err:  ErrNoModelAfterDirective,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		file := filepath.Join(GenerateTestDir, "model.go")
+		s.NoError(ioutil.WriteFile(file, []byte(c.src), 0644))
+
+		models, err := (&GoGenerate{File: file, Package: "user", Line: c.line}).ModelsAfterDirective()
+		s.EqualValues(c.err, errors.Cause(err))
+		s.EqualValues(c.models, models)
+	}
+}
+
+func (s *GoGenerateSuite) TestLookupGoGenerate() {
+	_, ok := LookupGoGenerate()
+	s.False(ok)
+
+	s.NoError(os.Setenv("GOFILE", "model.go"))
+	s.NoError(os.Setenv("GOPACKAGE", "user"))
+	s.NoError(os.Setenv("GOLINE", "3"))
+
+	gg, ok := LookupGoGenerate()
+	s.True(ok)
+	s.EqualValues(&GoGenerate{File: "model.go", Package: "user", Line: 3}, gg)
+}
+
+func (s *GoGenerateSuite) TestDefaultApp() {
+	src := `package user
+
+//go:generate mirror-test -x
+type User struct {
+	Name string
+}
+`
+	s.NoError(ioutil.WriteFile(filepath.Join(GenerateTestDir, "model.go"), []byte(src), 0644))
+
+	s.NoError(os.Setenv("GOFILE", filepath.Join(GenerateTestDir, "model.go")))
+	s.NoError(os.Setenv("GOPACKAGE", "user"))
+	s.NoError(os.Setenv("GOLINE", "3"))
+
+	names, outs, pkgs := []string{}, []string{}, []string{}
+	app := CreateDefaultApp("mirror-test", func(models StructSlice, out *Writer, pkg *packages.Package) error {
+		models.Each(func(st *Struct) {
+			names = append(names, st.Name())
+		})
+		outs = append(outs, out.Dir())
+		pkgs = append(pkgs, pkg.Name)
+		return nil
+	})
+
+	// the package and the out dir default to the directory of the file
+	dir, err := filepath.Abs(GenerateTestDir)
+	s.NoError(err)
+
+	s.NoError(app.Run([]string{"mirror-test", "-x"}))
+	s.EqualValues([]string{"User"}, names)
+	s.EqualValues([]string{dir}, outs)
+	s.EqualValues([]string{"user"}, pkgs)
+}
+
+func (s *GoGenerateSuite) TestDefaultAppNoModelAfterDirective() {
+	src := `package user
+
+//go:generate mirror-test -x -m User
+func init() {}
+
+type User struct {
+	Name string
+}
+`
+	s.NoError(ioutil.WriteFile(filepath.Join(GenerateTestDir, "model.go"), []byte(src), 0644))
+
+	s.NoError(os.Setenv("GOFILE", filepath.Join(GenerateTestDir, "model.go")))
+	s.NoError(os.Setenv("GOPACKAGE", "user"))
+	s.NoError(os.Setenv("GOLINE", "3"))
+
+	names := []string{}
+	app := CreateDefaultApp("mirror-test", func(models StructSlice, _ *Writer, _ *packages.Package) error {
+		models.Each(func(st *Struct) {
+			names = append(names, st.Name())
+		})
+		return nil
+	})
+
+	err := app.Run([]string{"mirror-test", "-x"})
+	s.EqualValues(ErrNoModelAfterDirective, errors.Cause(err))
+
+	// models set by the directive don't need to follow it
+	s.NoError(app.Run([]string{"mirror-test", "-x", "-m", "User"}))
+	s.EqualValues([]string{"User"}, names)
+}
+
+func TestGoGenerateSuite(t *testing.T) {
+	suite.Run(t, &GoGenerateSuite{})
+}
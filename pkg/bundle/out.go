@@ -7,13 +7,39 @@ import (
 	"os"
 	"path/filepath"
 	"text/template"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+const (
+	FileCreated   = "created"
+	FileUpdated   = "updated"
+	FileUnchanged = "unchanged"
+	FileDeleted   = "deleted"
 )
 
+// logFileEvent logs the event of the generated file as structured fields
+func logFileEvent(path, event string) {
+	entry := L.Method("Writer", "Write").WithFields(Fields{
+		"File":  path,
+		"Event": event,
+	})
+
+	if event == FileUnchanged {
+		entry.Debugln("Generated file ", event)
+		return
+	}
+	entry.Infoln("Generated file ", event)
+}
+
 // Writer is an encapsulation of methods used to write to the output directory
 // which must represent the package
 type Writer struct {
 	pkgPath string
 	Files   map[string]*File
+
+	// kept are paths of the existing files generated by previous runs
+	kept []string
 }
 
 // NewWriter creates a new Writer wrapper
@@ -25,6 +51,26 @@ func NewWriter(pkgPath string) *Writer {
 	}
 }
 
+// Remove deletes the previously generated file at the path, e.g. when its
+// model is gone. Files that don't exist are skipped
+func Remove(path string) error {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logFileEvent(path, FileDeleted)
+	return nil
+}
+
+// Dir returns the directory the files are written to
+func (o *Writer) Dir() string {
+	return o.pkgPath
+}
+
 // File returns an existing file reference or creates a new one which can be manipulated
 func (o *Writer) File(name string) *File {
 	if f, ok := o.Files[name]; ok {
@@ -41,13 +87,55 @@ func (o *Writer) File(name string) *File {
 	return f
 }
 
+// Keep marks the existing file as generated without rewriting it, so it's not
+// removed as stale, e.g. migrations that are generated only once
+func (o *Writer) Keep(name string) {
+	o.kept = append(o.kept, filepath.Join(o.pkgPath, name))
+}
+
+// Paths returns the paths of the files of the writer together with the kept files
+func (o *Writer) Paths() []string {
+	paths := append([]string{}, o.kept...)
+	for _, f := range o.Files {
+		paths = append(paths, f.Path())
+	}
+
+	return paths
+}
+
+// RawFile returns a file written as is, without the package clause and
+// imports, e.g. for SQL. Directories of the name are created when written
+func (o *Writer) RawFile(name string) *File {
+	f := o.File(name)
+	f.raw = true
+
+	return f
+}
+
 type File struct {
 	path string
 	buf  *bytes.Buffer
 
+	// raw files are written without the package clause and imports
+	raw bool
+
 	Imports []string
 }
 
+// Path returns the path the file is written to
+func (f *File) Path() string {
+	return f.path
+}
+
+// AddImports adds the import paths to the file, skipping the ones already imported
+func (f *File) AddImports(paths ...string) {
+	for _, p := range paths {
+		if !containsPath(f.Imports, p) {
+			f.Imports = append(f.Imports, p)
+		}
+	}
+}
+
 func (f *File) AddStringTemplate(str string, data interface{}) error {
 	return template.Must(template.New(f.path).Parse(str)).Execute(f.buf, data)
 }
@@ -56,12 +144,52 @@ func (f *File) AddTemplate(t *template.Template, data interface{}) error {
 	return t.Execute(f.buf, data)
 }
 
+// AddString adds the string to the file as is
+func (f *File) AddString(str string) {
+	f.buf.WriteString(str)
+}
+
 func (f *File) Write() error {
-	pkgName, err := DeterminePackage(filepath.Dir(f.path))
+	content := f.buf.Bytes()
+	if !f.raw {
+		header, err := f.header()
+		if err != nil {
+			return err
+		}
+		content = append(header, content...)
+	}
+
+	// unchanged files are not rewritten, so watchers don't see any change
+	event := FileCreated
+	existing, err := ioutil.ReadFile(f.path)
+	if err == nil {
+		event = FileUpdated
+		if bytes.Equal(existing, content) {
+			logFileEvent(f.path, FileUnchanged)
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(f.path, content, os.ModePerm)
 	if err != nil {
 		return err
 	}
 
+	logFileEvent(f.path, event)
+	return nil
+}
+
+// header returns the package clause and the imports of the file
+func (f *File) header() ([]byte, error) {
+	pkgName, err := DeterminePackage(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+
 	headerBuf := &bytes.Buffer{}
 	headerBuf.Write([]byte("package " + pkgName + "\n\n"))
 
@@ -73,7 +201,7 @@ func (f *File) Write() error {
 		headerBuf.WriteString(")\n\n")
 	}
 
-	return ioutil.WriteFile(f.path, append(headerBuf.Bytes(), f.buf.Bytes()...), os.ModePerm)
+	return headerBuf.Bytes(), nil
 }
 
 // DeterminePackage returns a package name for the given directory
@@ -95,3 +223,13 @@ func DeterminePackage(pkgPath string) (string, error) {
 
 	return pkgs[0].Name, nil
 }
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package bundle
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+const TestOutDir = ".testout"
+
+type WriterSuite struct {
+	suite.Suite
+
+	log string
+}
+
+func (s *WriterSuite) SetupTest() {
+	s.NoError(os.MkdirAll(TestOutDir, os.ModePerm))
+	s.log = filepath.Join(TestOutDir, "mirror.log")
+
+	s.NoError(L.Configure(Options{Format: FormatJSON, Output: s.log, Level: "debug"}))
+}
+
+func (s *WriterSuite) TearDownTest() {
+	s.NoError(L.Configure(Options{}))
+	s.NoError(os.RemoveAll(TestOutDir))
+}
+
+// events returns the file events logged by the writer
+func (s *WriterSuite) events() []string {
+	bb, err := ioutil.ReadFile(s.log)
+	s.NoError(err)
+
+	events := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(bb)), "\n") {
+		entry := map[string]interface{}{}
+		s.NoError(json.Unmarshal([]byte(line), &entry))
+
+		if event, ok := entry["Event"].(string); ok {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// write writes the file with the given content using a new writer
+func (s *WriterSuite) write(content string) {
+	f := NewWriter(TestOutDir).File("model.go")
+	s.NoError(f.AddStringTemplate(content, nil))
+	s.NoError(f.Write())
+}
+
+func (s *WriterSuite) TestFileEvents() {
+	s.write("type A struct{}\n")
+	s.write("type A struct{}\n")
+	s.write("type B struct{}\n")
+	s.NoError(Remove(filepath.Join(TestOutDir, "model.go")))
+
+	// removing a missing file is not an event
+	s.NoError(Remove(filepath.Join(TestOutDir, "model.go")))
+
+	s.EqualValues([]string{FileCreated, FileUnchanged, FileUpdated, FileDeleted}, s.events())
+
+	_, err := os.Stat(filepath.Join(TestOutDir, "model.go"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *WriterSuite) TestRawFile() {
+	f := NewWriter(TestOutDir).RawFile(filepath.Join("migrations", "0001.sql"))
+	f.AddString("CREATE TABLE a;\n")
+	s.NoError(f.Write())
+
+	bb, err := ioutil.ReadFile(filepath.Join(TestOutDir, "migrations", "0001.sql"))
+	s.NoError(err)
+	s.EqualValues("CREATE TABLE a;\n", string(bb))
+}
+
+func (s *WriterSuite) TestPaths() {
+	w := NewWriter(TestOutDir)
+	w.File("model.go")
+	w.Keep(filepath.Join("migrations", "0001.sql"))
+
+	s.ElementsMatch([]string{
+		filepath.Join(TestOutDir, "model.go"),
+		filepath.Join(TestOutDir, "migrations", "0001.sql"),
+	}, w.Paths())
+}
+
+func TestWriterSuite(t *testing.T) {
+	suite.Run(t, &WriterSuite{})
+}
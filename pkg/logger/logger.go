@@ -1,49 +1,336 @@
 package logger
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"io"
 	"os"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Logger is an alias to the logrus logger that provides additional
 // methods for bundle manipulation and reflection
 type Logger struct {
 	*logrus.Logger
+
+	// mu guards the subsystem loggers and the output file
+	mu         sync.RWMutex
+	subsystems map[string]*logrus.Logger
+	file       *os.File
 }
 
 // Fields type-aliases the logrus.Fields so the package can be skipped within
 // the mirror package
 type Fields = logrus.Fields
 
+const (
+	// FormatText formats logs for humans
+	FormatText = "text"
+
+	// FormatJSON formats logs as one JSON object per line
+	FormatJSON = "json"
+)
+
+const (
+	SubsystemLoader  = "loader"
+	SubsystemWatcher = "watcher"
+	SubsystemWriter  = "writer"
+	SubsystemServer  = "server"
+)
+
+// subsystemObjects maps objects of the log entries to subsystems,
+// Object.Method keys take precedence over Object keys
+var subsystemObjects = map[string]string{
+	"Loader":             SubsystemLoader,
+	"Internal/cache":     SubsystemLoader,
+	"Internal/module":    SubsystemLoader,
+	"Internal/plugin":    SubsystemLoader,
+	"Internal/workspace": SubsystemLoader,
+	"Loader.Watch":       SubsystemWatcher,
+	"Internal/watch":     SubsystemWatcher,
+	"Bundle.runWatch":    SubsystemWatcher,
+	"Writer":             SubsystemWriter,
+	"Server":             SubsystemServer,
+}
+
+// Options configure the format, output and levels of the logger
+type Options struct {
+	// Format is either FormatText or FormatJSON, FormatText if not set
+	Format string
+
+	// Output is stdout, stderr or a path of a file the logs are appended to,
+	// stdout if not set
+	Output string
+
+	// Level is the level of all subsystems without their own level, info if not set
+	Level string
+
+	// Levels override levels of the subsystems, e.g. loader: debug
+	Levels map[string]string
+}
+
 // init instruments third party libraries to work in default
 // settings when running mirror code or its bundling extension
 func init() {
+	_, loggerFile, _, _ = runtime.Caller(0)
+
 	L.SetLevel(logrus.InfoLevel)
 	L.SetOutput(os.Stdout)
 	L.SetFormatter(&logrus.TextFormatter{})
 }
 
+// Configure applies the options to the logger
+func (l *Logger) Configure(o Options) error {
+	var formatter logrus.Formatter
+	switch o.Format {
+	case "", FormatText:
+		formatter = &logrus.TextFormatter{}
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %s, use %s or %s", o.Format, FormatText, FormatJSON)
+	}
+
+	level := logrus.InfoLevel
+	if o.Level != "" {
+		var err error
+		level, err = logrus.ParseLevel(o.Level)
+		if err != nil {
+			return err
+		}
+	}
+
+	subsystems := map[string]*logrus.Logger{}
+	for name, lvl := range o.Levels {
+		if !isSubsystem(name) {
+			return fmt.Errorf("unknown log subsystem %s, use one of %s", name, strings.Join(Subsystems(), ", "))
+		}
+
+		subLevel, err := logrus.ParseLevel(lvl)
+		if err != nil {
+			return err
+		}
+
+		sub := logrus.New()
+		sub.SetLevel(subLevel)
+		subsystems[name] = sub
+	}
+
+	var out io.Writer
+	var file *os.File
+	switch o.Output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		var err error
+		file, err = os.OpenFile(o.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		out = file
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// subsystem loggers share the output and the format of the logger
+	for _, sub := range subsystems {
+		sub.SetOutput(out)
+		sub.SetFormatter(formatter)
+		sub.Hooks = l.Hooks
+	}
+
+	l.SetOutput(out)
+	l.SetFormatter(formatter)
+	l.SetLevel(level)
+	l.subsystems = subsystems
+
+	// close the file of the previous configuration
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+
+	return nil
+}
+
 // Method creates a log entry with predefined fields for the
 // caller Object and Method name. Additionaly, it will save the
-// caller's method file and it's line if Trace is enabled
+// file and line of the code that logged if Trace is enabled.
+// Entries of subsystems are logged with the level of the subsystem
 func (l *Logger) Method(obj, method string) *logrus.Entry {
 	ff := Fields{
 		"Object": obj,
 		"Method": method,
 	}
 
-	if l.Level == logrus.TraceLevel {
-		_, callerFile, callerLine, _ := runtime.Caller(0)
-		ff["Caller"] = fmt.Sprintf("%s:%d", callerFile, callerLine)
+	logger := l.Logger
+	if sub := SubsystemOf(obj, method); sub != "" {
+		ff["Subsystem"] = sub
+
+		l.mu.RLock()
+		if subLogger, ok := l.subsystems[sub]; ok {
+			logger = subLogger
+		}
+		l.mu.RUnlock()
+	}
+
+	if logger.Level == logrus.TraceLevel {
+		ff["Caller"] = caller()
+	}
+
+	return logger.WithFields(ff)
+}
+
+// MethodContext is the Method with the run of the context, see ContextWithRun
+func (l *Logger) MethodContext(ctx context.Context, obj, method string) *logrus.Entry {
+	entry := l.Method(obj, method)
+	if run := RunFromContext(ctx); run != "" {
+		entry = entry.WithField("Run", run)
+	}
+
+	return entry
+}
+
+// Span measures the duration of a single phase, e.g. a build
+type Span struct {
+	entry   *logrus.Entry
+	phase   string
+	started time.Time
+}
+
+// Start starts a span of the phase of the object, the span is
+// logged with the run of the context once it ends
+func (l *Logger) Start(ctx context.Context, obj, phase string) *Span {
+	return &Span{
+		entry:   l.MethodContext(ctx, obj, phase).WithField("Span", phase),
+		phase:   phase,
+		started: time.Now(),
+	}
+}
+
+// WithField adds the field to the logged span
+func (s *Span) WithField(key string, value interface{}) *Span {
+	s.entry = s.entry.WithField(key, value)
+	return s
+}
+
+// End logs the duration of the span and returns it
+func (s *Span) End() time.Duration {
+	d := time.Since(s.started)
+	s.entry.WithField("Duration", d).Debugln("Finished ", s.phase)
+
+	return d
+}
+
+// runKey is the context key of the run
+type runKey struct{}
+
+// NewRunID returns a random ID correlating the logs of a single generation run
+func NewRunID() string {
+	bb := make([]byte, 8)
+	if _, err := rand.Read(bb); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(bb)
+}
+
+// ContextWithRun returns the context of the run with the given ID
+func ContextWithRun(ctx context.Context, run string) context.Context {
+	return context.WithValue(ctx, runKey{}, run)
+}
+
+// RunFromContext returns the ID of the run of the context, if any
+func RunFromContext(ctx context.Context) string {
+	run, _ := ctx.Value(runKey{}).(string)
+	return run
+}
+
+// loggerFile is the file of the logger, its frames are skipped in the Caller
+var loggerFile string
+
+// caller returns the file and line of the first frame outside of the logger
+func caller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if frame.File != loggerFile {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// SubsystemOf returns the subsystem the object and its method belong to,
+// or an empty string if they don't belong to any
+func SubsystemOf(obj, method string) string {
+	if sub, ok := subsystemObjects[obj+"."+method]; ok {
+		return sub
+	}
+
+	return subsystemObjects[obj]
+}
+
+// Subsystems returns sorted names of all subsystems
+func Subsystems() []string {
+	names := []string{}
+	for _, sub := range subsystemObjects {
+		if !contains(names, sub) {
+			names = append(names, sub)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseLevels parses subsystem=level pairs into the Levels option
+func ParseLevels(pairs []string) (map[string]string, error) {
+	levels := map[string]string{}
+
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid log level %s, use subsystem=level", pair)
+		}
+
+		levels[kv[0]] = kv[1]
+	}
+
+	return levels, nil
+}
+
+func isSubsystem(name string) bool {
+	return contains(Subsystems(), name)
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
 	}
 
-	return l.WithFields(ff)
+	return false
 }
 
 var (
 	// L is a global logger that can be reconfigured by third parties
 	// to customize logging
-	L = &Logger{logrus.New()}
+	L = &Logger{Logger: logrus.New()}
 )
@@ -0,0 +1,168 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const TestLogDir = ".testlogs"
+
+type LoggerSuite struct {
+	suite.Suite
+
+	file string
+}
+
+type ConfigureCandidate struct {
+	name    string
+	options Options
+
+	err bool
+}
+
+func (s *LoggerSuite) SetupTest() {
+	s.NoError(os.MkdirAll(TestLogDir, os.ModePerm))
+	s.file = filepath.Join(TestLogDir, "mirror.log")
+}
+
+func (s *LoggerSuite) TearDownTest() {
+	s.NoError(L.Configure(Options{}))
+	s.NoError(os.RemoveAll(TestLogDir))
+}
+
+// entries returns the JSON entries logged into the file
+func (s *LoggerSuite) entries() []map[string]interface{} {
+	bb, err := ioutil.ReadFile(s.file)
+	s.NoError(err)
+
+	entries := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(string(bb)), "\n") {
+		if line == "" {
+			continue
+		}
+
+		entry := map[string]interface{}{}
+		s.NoError(json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func (s *LoggerSuite) TestConfigure() {
+	candidates := []ConfigureCandidate{
+		{
+			name:    "Configure defaults",
+			options: Options{},
+		},
+		{
+			name:    "Configure json to stderr",
+			options: Options{Format: FormatJSON, Output: "stderr", Level: "debug"},
+		},
+		{
+			name:    "Get error for unknown format",
+			options: Options{Format: "xml"},
+			err:     true,
+		},
+		{
+			name:    "Get error for unknown level",
+			options: Options{Level: "loud"},
+			err:     true,
+		},
+		{
+			name:    "Get error for unknown subsystem",
+			options: Options{Levels: map[string]string{"compiler": "debug"}},
+			err:     true,
+		},
+		{
+			name:    "Get error for unwritable output",
+			options: Options{Output: filepath.Join(TestLogDir, "missing", "mirror.log")},
+			err:     true,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		err := L.Configure(c.options)
+		s.EqualValues(c.err, err != nil)
+	}
+}
+
+func (s *LoggerSuite) TestSubsystemLevels() {
+	s.NoError(L.Configure(Options{
+		Format: FormatJSON,
+		Output: s.file,
+		Level:  "info",
+		Levels: map[string]string{SubsystemLoader: "debug", SubsystemWriter: "warning"},
+	}))
+
+	L.Method("Loader", "loadPackage").Debugln("loader debug")
+	L.Method("Loader", "Watch").Debugln("watcher debug")
+	L.Method("Writer", "Write").Infoln("writer info")
+	L.Method("Bundle", "Run").Infoln("bundle info")
+
+	entries := s.entries()
+	s.Len(entries, 2)
+
+	s.EqualValues("loader debug", entries[0]["msg"])
+	s.EqualValues(SubsystemLoader, entries[0]["Subsystem"])
+	s.EqualValues("bundle info", entries[1]["msg"])
+	s.NotContains(entries[1], "Subsystem")
+}
+
+func (s *LoggerSuite) TestCaller() {
+	s.NoError(L.Configure(Options{Format: FormatJSON, Output: s.file, Level: "trace"}))
+
+	_, file, line, _ := runtime.Caller(0)
+	L.Method("Bundle", "Run").Infoln("traced")
+
+	entries := s.entries()
+	s.Len(entries, 1)
+	s.EqualValues(fmt.Sprintf("%s:%d", file, line+1), entries[0]["Caller"])
+}
+
+func (s *LoggerSuite) TestSpan() {
+	s.NoError(L.Configure(Options{Format: FormatJSON, Output: s.file, Level: "debug"}))
+
+	ctx := ContextWithRun(context.Background(), "run-1")
+	s.EqualValues("run-1", RunFromContext(ctx))
+	s.EqualValues("", RunFromContext(context.Background()))
+
+	span := L.Start(ctx, "Loader", "build").WithField("Package", "user")
+	s.True(span.End() > 0)
+
+	entries := s.entries()
+	s.Len(entries, 1)
+	s.EqualValues("build", entries[0]["Span"])
+	s.EqualValues("run-1", entries[0]["Run"])
+	s.EqualValues("user", entries[0]["Package"])
+	s.EqualValues(SubsystemLoader, entries[0]["Subsystem"])
+	s.Contains(entries[0], "Duration")
+}
+
+func (s *LoggerSuite) TestNewRunID() {
+	s.Len(NewRunID(), 16)
+	s.NotEqual(NewRunID(), NewRunID())
+}
+
+func (s *LoggerSuite) TestParseLevels() {
+	levels, err := ParseLevels([]string{"loader=debug", "watcher=trace"})
+	s.NoError(err)
+	s.EqualValues(map[string]string{"loader": "debug", "watcher": "trace"}, levels)
+
+	_, err = ParseLevels([]string{"loader"})
+	s.Error(err)
+}
+
+func TestLoggerSuite(t *testing.T) {
+	suite.Run(t, &LoggerSuite{})
+}
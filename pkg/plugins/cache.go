@@ -0,0 +1,300 @@
+package plugins
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/tools/go/packages"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+// modulePath is the path of the mirror module
+const modulePath = "github.com/petomalina/mirror"
+
+const (
+	// DefaultCacheMaxSize is the default size limit of the build cache in bytes
+	DefaultCacheMaxSize = 512 * 1024 * 1024
+
+	// DefaultCacheMaxAge is the default time after which unused plugins are pruned
+	DefaultCacheMaxAge = 7 * 24 * time.Hour
+)
+
+var (
+	version     string
+	versionOnce sync.Once
+)
+
+// pipelineVersion returns the version of the mirror plugin pipeline. It's a part
+// of every build cache key, so plugins are rebuilt whenever the pipeline changes.
+// The version is the released mirror module the binary is built with, binaries
+// built from other sources, e.g. within the mirror module, use their hash instead
+func pipelineVersion() string {
+	versionOnce.Do(func() {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, m := range append([]*debug.Module{&info.Main}, info.Deps...) {
+				if m.Path == modulePath && m.Replace == nil && m.Sum != "" {
+					version = m.Version + " " + m.Sum
+					return
+				}
+			}
+		}
+
+		sum, err := executableHash()
+		if err != nil {
+			// plugins of binaries that can't be identified are never reused by others
+			L.Method("Internal/cache", "pipelineVersion").Warnln("Failed to hash the executable: ", err.Error())
+			sum = fmt.Sprintf("unknown %d", time.Now().UnixNano())
+		}
+		version = sum
+	})
+
+	return version
+}
+
+// executableHash returns the hash of the running binary
+func executableHash() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BuildCache is a persistent content-addressed store of built plugins.
+// Each plugin is stored under the key of its sources and build settings, so
+// unchanged packages are never rebuilt. Plugins are never replaced under
+// the same path, as the runtime refuses to open a changed plugin that was
+// already loaded from there
+type BuildCache struct {
+	// Dir is the directory the plugins are stored in
+	Dir string
+
+	// MaxSize is the size limit of the cache in bytes, DefaultCacheMaxSize if not set
+	MaxSize int64
+
+	// MaxAge is the duration after which unused plugins are pruned,
+	// DefaultCacheMaxAge if not set
+	MaxAge time.Duration
+}
+
+// Get returns the path of the cached plugin for the given key, marking
+// it as recently used
+func (c *BuildCache) Get(key string) (string, bool) {
+	return c.GetFile(key + ".so")
+}
+
+// GetFile returns the path of the cached file with the given name,
+// marking it as recently used
+func (c *BuildCache) GetFile(name string) (string, bool) {
+	cached := filepath.Join(c.Dir, name)
+
+	if _, err := os.Stat(cached); err != nil {
+		return "", false
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(cached, now, now); err != nil {
+		L.Method("Internal/cache", "GetFile").Warnln("Failed to mark the file as used: ", err.Error())
+	}
+
+	return cached, true
+}
+
+// Put moves the built plugin into the cache under the given key and
+// returns its new path
+func (c *BuildCache) Put(key, so string) (string, error) {
+	return c.PutFile(key+".so", so)
+}
+
+// PutFile moves the file into the cache under the given name and
+// returns its new path
+func (c *BuildCache) PutFile(name, file string) (string, error) {
+	err := os.MkdirAll(c.Dir, os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	cached := filepath.Join(c.Dir, name)
+	return cached, os.Rename(file, cached)
+}
+
+// Prune removes files that were not used for longer than MaxAge and the
+// least recently used files until the cache fits into MaxSize. Files stored
+// under the keep key are never removed
+func (c *BuildCache) Prune(keep string) error {
+	maxSize := c.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultCacheMaxSize
+	}
+
+	maxAge := c.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultCacheMaxAge
+	}
+
+	ff, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	// the most recently used files go first
+	sort.Slice(ff, func(i, j int) bool {
+		return ff[i].ModTime().After(ff[j].ModTime())
+	})
+
+	size := int64(0)
+	for _, f := range ff {
+		size += f.Size()
+		if strings.HasPrefix(f.Name(), keep+".") {
+			continue
+		}
+
+		if time.Since(f.ModTime()) > maxAge || size > maxSize {
+			L.Method("Internal/cache", "Prune").Trace("Pruning file: ", f.Name())
+
+			err := os.Remove(filepath.Join(c.Dir, f.Name()))
+			if err != nil {
+				return err
+			}
+			size -= f.Size()
+		}
+	}
+
+	return nil
+}
+
+// CacheKey returns the build cache key for the given package. The key covers
+// sources of the package and its dependencies within the local modules,
+// the main module requirements, the go version and environment, the build
+// configuration and the version of mirror. Extra values, like the symbols
+// being generated, can be passed to distinguish builds of the same package
+func (c *BuildConfig) CacheKey(pkg *packages.Package, extra ...string) (string, error) {
+	h := sha256.New()
+
+	fmt.Fprintln(h, "mirror", pipelineVersion())
+	fmt.Fprintln(h, "flags", c.BuildFlags())
+	fmt.Fprintln(h, "env", c.Env)
+	fmt.Fprintln(h, "extra", extra)
+
+	goEnv, err := c.goEnv("GOVERSION", "GOOS", "GOARCH", "GOFLAGS", "CGO_ENABLED")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(h, "goenv", goEnv)
+
+	// the package itself
+	files := append(append([]string{}, pkg.GoFiles...), pkg.OtherFiles...)
+	err = hashFiles(h, files)
+	if err != nil {
+		return "", err
+	}
+
+	// dependencies that are not versioned by the module cache
+	deps, err := c.LocalDeps(pkg)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dep := range deps {
+		err = hashFiles(h, dep.Files)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// requirements of the main module determine versions of all other dependencies
+	mod, err := c.FindModule()
+	if err != nil {
+		return "", err
+	}
+	if mod != nil {
+		err = hashFiles(h, []string{mod.GoMod, filepath.Join(mod.Dir, "go.sum")})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LocalDep is a dependency of a package that is not versioned by the module cache
+type LocalDep struct {
+	// Dir is the directory of the dependency
+	Dir string
+
+	// Files are absolute paths of the go sources of the dependency
+	Files []string
+}
+
+// LocalDeps returns the package and all its non-standard dependencies
+// located outside of the module cache, e.g. packages of the main module
+func (c *BuildConfig) LocalDeps(pkg *packages.Package) ([]*LocalDep, error) {
+	modCache, err := c.goEnv("GOMODCACHE")
+	if err != nil {
+		return nil, err
+	}
+	modCache = strings.TrimSpace(modCache)
+
+	args := append([]string{"list", "-deps", "-f", "{{ if not .Standard }}{{ .Dir }}{{ range .GoFiles }}\t{{ . }}{{ end }}{{ range .CgoFiles }}\t{{ . }}{{ end }}{{ end }}"}, c.BuildFlags()...)
+	out, err := c.output(append(args, pkg.PkgPath)...)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := []*LocalDep{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if fields[0] == "" || isWithin(fields[0], modCache) {
+			continue
+		}
+
+		dep := &LocalDep{Dir: fields[0]}
+		for _, f := range fields[1:] {
+			dep.Files = append(dep.Files, filepath.Join(dep.Dir, f))
+		}
+		deps = append(deps, dep)
+	}
+
+	return deps, nil
+}
+
+// hashFiles writes names and contents of the given files into the hash,
+// files that don't exist are skipped
+func hashFiles(h io.Writer, files []string) error {
+	for _, f := range files {
+		bb, err := ioutil.ReadFile(f)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(h, "file", f, len(bb))
+		h.Write(bb)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package plugins
+
+import (
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type BuildCacheSuite struct {
+	suite.Suite
+
+	cache *BuildCache
+}
+
+func (s *BuildCacheSuite) SetupTest() {
+	s.cache = &BuildCache{
+		Dir: filepath.Join(TestCacheDir, "plugins"),
+	}
+	s.NoError(os.MkdirAll(s.cache.Dir, os.ModePerm))
+}
+
+func (s *BuildCacheSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(TestCacheDir))
+}
+
+// put creates a plugin of the given size in the cache, last used the given time ago
+func (s *BuildCacheSuite) put(key string, size int, age time.Duration) {
+	so := filepath.Join(TestCacheDir, key+".so")
+	s.NoError(ioutil.WriteFile(so, make([]byte, size), os.ModePerm))
+
+	cached, err := s.cache.Put(key, so)
+	s.NoError(err)
+
+	usedAt := time.Now().Add(-age)
+	s.NoError(os.Chtimes(cached, usedAt, usedAt))
+}
+
+func (s *BuildCacheSuite) TestGetPut() {
+	_, ok := s.cache.Get("missing")
+	s.False(ok)
+
+	s.put("key", 1, time.Hour)
+
+	so, ok := s.cache.Get("key")
+	s.True(ok)
+	s.EqualValues(filepath.Join(s.cache.Dir, "key.so"), so)
+
+	// the plugin is marked as used
+	info, err := os.Stat(so)
+	s.NoError(err)
+	s.WithinDuration(time.Now(), info.ModTime(), time.Minute)
+}
+
+func (s *BuildCacheSuite) TestPruneAge() {
+	s.cache.MaxAge = time.Hour
+
+	s.put("old", 1, 2*time.Hour)
+	s.put("new", 1, time.Minute)
+	s.put("kept", 1, 3*time.Hour)
+
+	s.NoError(s.cache.Prune("kept"))
+
+	_, ok := s.cache.Get("old")
+	s.False(ok)
+	_, ok = s.cache.Get("new")
+	s.True(ok)
+	_, ok = s.cache.Get("kept")
+	s.True(ok)
+}
+
+func (s *BuildCacheSuite) TestPruneSize() {
+	s.cache.MaxSize = 25
+
+	s.put("oldest", 10, 3*time.Minute)
+	s.put("older", 10, 2*time.Minute)
+	s.put("newest", 10, time.Minute)
+
+	s.NoError(s.cache.Prune("newest"))
+
+	_, ok := s.cache.Get("oldest")
+	s.False(ok)
+	_, ok = s.cache.Get("older")
+	s.True(ok)
+	_, ok = s.cache.Get("newest")
+	s.True(ok)
+}
+
+func (s *BuildCacheSuite) TestPipelineVersion() {
+	// the tests are built within the mirror module, so the binary is hashed
+	s.Len(pipelineVersion(), 64)
+	s.EqualValues(pipelineVersion(), pipelineVersion())
+}
+
+func (s *BuildCacheSuite) TestGoEnvMemoized() {
+	c := &BuildConfig{}
+	goos, err := c.goEnv("GOOS")
+	s.NoError(err)
+	s.NotEmpty(goos)
+
+	// the go tool isn't invoked again for the same variables
+	c.GoBinary = filepath.Join(TestCacheDir, "nonexisting-go")
+	memoized, err := c.goEnv("GOOS")
+	s.NoError(err)
+	s.EqualValues(goos, memoized)
+
+	_, err = c.goEnv("GOARCH")
+	s.Error(err)
+}
+
+func TestBuildCacheSuite(t *testing.T) {
+	suite.Run(t, &BuildCacheSuite{})
+}
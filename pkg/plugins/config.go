@@ -0,0 +1,107 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// BuildConfig controls the go tool invocations used both to discover
+// the packages and to build the plugins, so both see the same files
+type BuildConfig struct {
+	// Tags are build tags applied to the package discovery and the build
+	Tags []string
+
+	// Flags are additional flags passed to the go tool, e.g. -mod=vendor
+	Flags []string
+
+	// Env contains KEY=VALUE pairs overriding the current environment,
+	// e.g. CGO_ENABLED=1 or GOFLAGS=-mod=mod
+	Env []string
+
+	// GoBinary is a path to the go binary, defaults to the go found in PATH
+	GoBinary string
+
+	// goEnvs are the memoized outputs of go env by the variable names
+	goEnvs sync.Map
+}
+
+// BuildFlags returns the flags that should be passed to every go tool
+// invocation that loads or builds packages
+func (c *BuildConfig) BuildFlags() []string {
+	flags := []string{}
+
+	if len(c.Tags) != 0 {
+		flags = append(flags, "-tags="+strings.Join(c.Tags, ","))
+	}
+
+	return append(flags, c.Flags...)
+}
+
+// Environ returns the environment for the go tool invocations. When a custom
+// go binary is used, its directory is prepended to PATH so even tools that
+// invoke `go` on their own (e.g. the package loader) use the same binary
+func (c *BuildConfig) Environ() []string {
+	env := append(os.Environ(), c.Env...)
+
+	if c.GoBinary != "" && filepath.Base(c.GoBinary) != c.GoBinary {
+		env = append(env, "PATH="+filepath.Dir(c.GoBinary)+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+
+	return env
+}
+
+// Command creates a go tool command with the configured binary and environment
+func (c *BuildConfig) Command(args ...string) *exec.Cmd {
+	return c.CommandContext(context.Background(), args...)
+}
+
+// CommandContext creates a go tool command which is killed when the context is done
+func (c *BuildConfig) CommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	goBinary := "go"
+	if c.GoBinary != "" {
+		goBinary = c.GoBinary
+	}
+
+	cmd := exec.CommandContext(ctx, goBinary, args...)
+	cmd.Env = c.Environ()
+
+	return cmd
+}
+
+// goEnv returns the output of go env for the given variables. The output
+// is memoized, as the environment doesn't change while the config is used
+func (c *BuildConfig) goEnv(names ...string) (string, error) {
+	key := strings.Join(names, " ")
+	if out, ok := c.goEnvs.Load(key); ok {
+		return out.(string), nil
+	}
+
+	out, err := c.output(append([]string{"env"}, names...)...)
+	if err != nil {
+		return "", err
+	}
+
+	c.goEnvs.Store(key, out)
+	return out, nil
+}
+
+// output runs the go tool with the given arguments and returns its output
+func (c *BuildConfig) output(args ...string) (string, error) {
+	stderr := &bytes.Buffer{}
+
+	cmd := c.Command(args...)
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrap(err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
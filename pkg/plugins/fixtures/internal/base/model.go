@@ -0,0 +1,5 @@
+package base
+
+type Model struct {
+	ID int
+}
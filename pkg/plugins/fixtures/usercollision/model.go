@@ -0,0 +1,9 @@
+package user
+
+type User struct {
+	Email string
+	Name  string
+}
+
+// XMirror_User collides with the symbol mirror would generate for User
+var XMirror_User = "taken"
@@ -0,0 +1,18 @@
+package user
+
+import (
+	"github.com/petomalina/mirror/pkg/plugins/fixtures/internal/base"
+	"time"
+)
+
+type User struct {
+	base.Model
+
+	Email     string
+	CreatedAt time.Time
+}
+
+// GENERATOR ONLY, DON'T USE
+var (
+	XUser = &User{}
+)
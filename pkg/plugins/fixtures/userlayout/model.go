@@ -0,0 +1,26 @@
+// Package user has a layout that can't be converted by rewriting lines
+package user // import "github.com/petomalina/mirror/pkg/plugins/fixtures/userlayout"
+
+import (
+	"os"
+)
+
+// template must stay untouched when the package is converted
+const template = `
+package user
+`
+
+type User struct {
+	Email string
+	Name  string
+}
+
+// init has side effects that must not run within the plugin
+func init() {
+	os.Exit(1)
+}
+
+// GENERATOR ONLY, DON'T USE
+var (
+	XUser = &User{}
+)
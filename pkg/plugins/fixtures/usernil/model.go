@@ -0,0 +1,11 @@
+// Package user declares a model variable holding a nil interface
+package user
+
+type Model interface {
+	Validate() error
+}
+
+// GENERATOR ONLY, DON'T USE
+var (
+	XModel Model
+)
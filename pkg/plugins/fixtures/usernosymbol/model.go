@@ -1,9 +1,15 @@
 package user
 
 type User struct {
-	Email string
+	Email Email
 	Name  string
 
 	// unexported password
 	password string
 }
+
+type Email string
+
+type Notifier interface {
+	Notify(u *User) error
+}
@@ -0,0 +1,2 @@
+// Package user declares its models only when built with the mirror tag
+package user
@@ -0,0 +1,14 @@
+//go:build mirror
+// +build mirror
+
+package user
+
+type User struct {
+	Email string
+	Name  string
+}
+
+// GENERATOR ONLY, DON'T USE
+var (
+	XUser = &User{}
+)
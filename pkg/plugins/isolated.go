@@ -0,0 +1,329 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go/ast"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+// TypeDescription is a serialized description of a model type, produced
+// by the isolated loader instead of a live symbol
+type TypeDescription struct {
+	// Name of the type without the package qualifier
+	Name string
+
+	// PkgPath is the import path of the package declaring the type
+	PkgPath string
+
+	// Kind is the reflect.Kind of the type, e.g. struct
+	Kind string
+
+	// Fields of the type, only structs have fields
+	Fields []FieldDescription
+}
+
+// FieldDescription is a serialized description of a single struct field
+type FieldDescription struct {
+	Name      string
+	Type      string
+	Kind      string
+	PkgPath   string
+	Tag       string
+	Offset    uintptr
+	Anonymous bool
+	Exported  bool
+}
+
+// helperTemplate is a program that describes the requested types of the
+// imported model package and prints the descriptions to the stdout
+var helperTemplate = template.Must(template.New("helper").Parse(`// DO NOT EDIT: THIS FILE IS AUTOGENERATED BY MIRROR
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+
+	model "{{ .PkgPath }}"
+)
+
+type fieldDescription struct {
+	Name      string
+	Type      string
+	Kind      string
+	PkgPath   string
+	Tag       string
+	Offset    uintptr
+	Anonymous bool
+	Exported  bool
+}
+
+type typeDescription struct {
+	Name    string
+	PkgPath string
+	Kind    string
+	Fields  []fieldDescription
+}
+
+func describe(name string, t reflect.Type) typeDescription {
+	// nil interfaces have no dynamic type to describe
+	if t == nil {
+		fmt.Fprintln(os.Stderr, name, "is a nil interface and has no type to describe")
+		os.Exit(1)
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	desc := typeDescription{
+		Name:    t.Name(),
+		PkgPath: t.PkgPath(),
+		Kind:    t.Kind().String(),
+		Fields:  []fieldDescription{},
+	}
+
+	if t.Kind() != reflect.Struct {
+		return desc
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		desc.Fields = append(desc.Fields, fieldDescription{
+			Name:      f.Name,
+			Type:      f.Type.String(),
+			Kind:      f.Type.Kind().String(),
+			PkgPath:   f.Type.PkgPath(),
+			Tag:       string(f.Tag),
+			Offset:    f.Offset,
+			Anonymous: f.Anonymous,
+			Exported:  f.PkgPath == "",
+		})
+	}
+
+	return desc
+}
+
+func main() {
+	descs := []typeDescription{
+{{- range .Exprs }}
+		describe({{ printf "%q" .Name }}, reflect.TypeOf({{ .Expr }})),
+{{- end }}
+	}
+
+	err := json.NewEncoder(os.Stdout).Encode(descs)
+	if err != nil {
+		panic(err)
+	}
+}
+`))
+
+type helperTemplateData struct {
+	PkgPath string
+
+	// Exprs are expressions of the described types or variables
+	Exprs []helperExpr
+}
+
+type helperExpr struct {
+	Name string
+	Expr string
+}
+
+// helperFile is the name of the helper program within the workspace
+const helperFile = "mirror_helper.go"
+
+// loadIsolated describes the given symbols using a helper executable importing
+// the package instead of opening it as a plugin. The executable is built with
+// its own copy of all dependencies, so it never conflicts with the host process
+func (l *Loader) loadIsolated(ctx context.Context, pkg *packages.Package, symbolNames []string, cacheDir string, buildCache *BuildCache) ([]interface{}, error) {
+	data, err := helperData(pkg, symbolNames)
+	if err != nil {
+		return nil, errors.Wrap(ErrSymbolGenerationFailed, err.Error())
+	}
+
+	var key string
+	if !l.DisableBuildCache {
+		key, err = l.CacheKey(pkg, append([]string{"isolated"}, symbolNames...)...)
+		if err != nil {
+			return nil, errors.Wrap(ErrBuildCacheFailed, err.Error())
+		}
+
+		if cached, ok := buildCache.GetFile(key + ".json"); ok {
+			L.MethodContext(ctx, "Loader", "loadIsolated").Debugln("Reusing cached descriptions for ", pkg.PkgPath)
+			return readDescriptions(cached)
+		}
+	}
+
+	ws, err := NewEmptyWorkspace(pkg, cacheDir)
+	if err != nil {
+		return nil, errors.Wrap(ErrCopyingToCacheFailed, err.Error())
+	}
+
+	buf := &bytes.Buffer{}
+	err = helperTemplate.Execute(buf, data)
+	if err != nil {
+		return nil, errors.Wrap(ErrSymbolGenerationFailed, err.Error())
+	}
+
+	err = ws.WriteFile(helperFile, buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(ErrSymbolGenerationFailed, err.Error())
+	}
+
+	target, err := l.ResolveBuildTarget(pkg)
+	if err != nil {
+		return nil, errors.Wrap(ErrModuleResolveFailed, err.Error())
+	}
+
+	span := L.Start(ctx, "Loader", "build").WithField("Package", pkg.PkgPath)
+	descsFile, err := l.RunHelper(ctx, ws, target)
+	span.End()
+	if err != nil {
+		return nil, errors.Wrap(ErrBuildFailed, err.Error())
+	}
+
+	if !l.DisableBuildCache {
+		descsFile, err = buildCache.PutFile(key+".json", descsFile)
+		if err != nil {
+			return nil, errors.Wrap(ErrBuildCacheFailed, err.Error())
+		}
+
+		err = buildCache.Prune(key)
+		if err != nil {
+			return nil, errors.Wrap(ErrBuildCacheFailed, err.Error())
+		}
+	}
+
+	descs, err := readDescriptions(descsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// don't do cleanup if we want to preserve the cache, just return
+	if l.PreserveCache {
+		return descs, nil
+	}
+
+	return descs, ws.Cleanup()
+}
+
+// RunHelper builds the helper program within the workspace as an executable
+// mounted to the build target, runs it and returns the path to its output.
+// Both the build and the helper are stopped when the context is done
+func (c *BuildConfig) RunHelper(ctx context.Context, ws *Workspace, target *BuildTarget) (string, error) {
+	overlay, err := WriteOverlay(ws.Dir, target)
+	if err != nil {
+		return "", err
+	}
+
+	helperPath := filepath.Join(ws.Dir, "helper")
+	args := append([]string{"build", "-overlay=" + overlay, "-o=" + helperPath}, c.BuildFlags()...)
+	cmd := c.CommandContext(ctx, append(args, target.ImportPath)...)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+
+	err = cmd.Run()
+	if err != nil {
+		return "", err
+	}
+
+	stderr := &bytes.Buffer{}
+	helper := exec.CommandContext(ctx, helperPath)
+	helper.Env = c.Environ()
+	helper.Stderr = stderr
+
+	out, err := helper.Output()
+	if err != nil {
+		return "", errors.Wrap(err, strings.TrimSpace(stderr.String()))
+	}
+
+	descsFile := filepath.Join(ws.Dir, "descriptions.json")
+	return descsFile, ioutil.WriteFile(descsFile, out, 0644)
+}
+
+// helperData sorts the requested symbols into types and variables of the
+// package. 'all' requests all exported variables
+func helperData(pkg *packages.Package, symbolNames []string) (*helperTemplateData, error) {
+	if pkg.Name == "main" {
+		return nil, errors.Errorf("package %s is a program and can't be imported", pkg.PkgPath)
+	}
+
+	decls, err := parseDeclarations(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &helperTemplateData{
+		PkgPath: pkg.PkgPath,
+	}
+
+	if len(symbolNames) == 1 && symbolNames[0] == "all" {
+		symbolNames = []string{}
+		for name := range decls.vars {
+			if ast.IsExported(name) {
+				symbolNames = append(symbolNames, name)
+			}
+		}
+		sort.Strings(symbolNames)
+	}
+
+	for _, name := range symbolNames {
+		if !ast.IsExported(name) {
+			return nil, errors.Errorf("%s is not exported and can't be described", name)
+		}
+
+		if spec, ok := decls.types[name]; ok {
+			if spec.TypeParams != nil && len(spec.TypeParams.List) != 0 {
+				return nil, errors.Wrapf(ErrUnsupportedModel, "%s is a generic type", name)
+			}
+
+			data.Exprs = append(data.Exprs, helperExpr{Name: name, Expr: "(*model." + name + ")(nil)"})
+			continue
+		}
+
+		if decls.vars[name] {
+			data.Exprs = append(data.Exprs, helperExpr{Name: name, Expr: "model." + name})
+			continue
+		}
+
+		return nil, errors.Wrapf(ErrUnknownModel, "%s not found in %s", name, pkg.PkgPath)
+	}
+
+	return data, nil
+}
+
+// readDescriptions reads the descriptions printed by the helper program
+func readDescriptions(file string) ([]interface{}, error) {
+	bb, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(ErrSymbolLoadFailed, err.Error())
+	}
+
+	descs := []*TypeDescription{}
+	err = json.Unmarshal(bb, &descs)
+	if err != nil {
+		return nil, errors.Wrap(ErrSymbolLoadFailed, err.Error())
+	}
+
+	syms := []interface{}{}
+	for _, d := range descs {
+		syms = append(syms, d)
+	}
+
+	return syms, nil
+}
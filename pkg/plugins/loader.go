@@ -1,15 +1,24 @@
 package plugins
 
 import (
+	"context"
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
-	"os"
+	"golang.org/x/tools/go/packages"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
 	"time"
+
+	. "github.com/petomalina/mirror/pkg/logger"
 )
 
 var (
 	ErrFindPackageFailed      = errors.New("An error occurred when loading plugin")
 	ErrCopyingToCacheFailed   = errors.New("Failed to copy package to the cache")
+	ErrModuleResolveFailed    = errors.New("Failed to resolve the module of the package")
+	ErrBuildCacheFailed       = errors.New("Failed to access the build cache")
 	ErrSymbolGenerationFailed = errors.New("Failed to generate symbols")
 	ErrBuildFailed            = errors.New("Failed to build the plugin")
 	ErrSymbolLoadFailed       = errors.New("Failed to load symbols from the plugin")
@@ -17,13 +26,20 @@ var (
 
 // Loader encapsulates full lifecycle of a plugin
 type Loader struct {
-	// TargetPath is a relative path to the plugin that should be built
+	// TargetPath is a relative path to the plugin that should be built.
+	// Package patterns such as ./models/... are accepted as well, in which
+	// case every matching package is built into its own plugin
 	TargetPath string
 
 	// PreserveCache determines if the copied cached files should be preserved
 	// at the end of the lifecycle
 	PreserveCache bool
 
+	// Isolated loads descriptions of the models using a helper executable
+	// instead of a plugin. This avoids plugin version mismatches of shared
+	// dependencies at the cost of live symbols, see TypeDescription
+	Isolated bool
+
 	// GenerateSymbols automatically generates symbols for desired types,
 	// e.g. type User struct {} will have his var XUser User generated
 	// in case it is passed into symbolNames for Load function
@@ -32,41 +48,213 @@ type Loader struct {
 	// CacheDir can be used to override the default setting of the cache directory
 	// if not set, this will default to the DefaultCache
 	CacheDir string
+
+	// DisableBuildCache disables reusing of plugins built from unchanged sources
+	DisableBuildCache bool
+
+	// CacheMaxSize limits the size of the build cache in bytes,
+	// DefaultCacheMaxSize is used if not set
+	CacheMaxSize int64
+
+	// CacheMaxAge is the duration after which unused plugins are pruned
+	// from the build cache, DefaultCacheMaxAge is used if not set
+	CacheMaxAge time.Duration
+
+	// WatchIgnore are glob patterns of paths ignored by the Watch,
+	// DefaultWatchIgnore is used if not set. The cache dir is always ignored
+	WatchIgnore []string
+
+	// WatchIgnoreFiles are files ignored by the Watch in addition to the
+	// WatchIgnore, the caller replaces them while watching, e.g. by the
+	// files it generated. Only the patterns are used if not set
+	WatchIgnoreFiles *IgnoredFiles
+
+	// WatchOps are the file operations triggering a rebuild within the Watch,
+	// DefaultWatchOps is used if not set
+	WatchOps fsnotify.Op
+
+	// WatchDebounce is the quiet period after the last change before the Watch
+	// rebuilds, DefaultWatchDebounce is used if not set
+	WatchDebounce time.Duration
+
+	// WatchMaxWait is the longest the Watch holds back a rebuild while changes
+	// keep coming, DefaultWatchMaxWait is used if not set
+	WatchMaxWait time.Duration
+
+	// BuildConfig holds build tags, flags, environment and the go binary
+	// used consistently for the package discovery and the plugin build
+	BuildConfig
+
+	// loading serializes the loads, e.g. of the Watch and of its caller,
+	// so the same cache entry is never built concurrently
+	loading sync.Mutex
 }
 
+// PackageSymbols groups the symbols loaded from a single package
+type PackageSymbols struct {
+	Package *packages.Package
+	Symbols []interface{}
+}
+
+// Load loads the given symbols from all packages matched by the TargetPath
+// and returns them in a single slice
 func (l *Loader) Load(symbolNames []string) ([]interface{}, error) {
-	pkg, err := FindPackage(l.TargetPath)
+	pkgSyms, err := l.LoadPackages(symbolNames)
+	if err != nil {
+		return nil, err
+	}
+
+	syms := []interface{}{}
+	for _, ps := range pkgSyms {
+		syms = append(syms, ps.Symbols...)
+	}
+
+	return syms, nil
+}
+
+// LoadPackages loads the given symbols from all packages matched by the
+// TargetPath, grouping them by the package they were found in.
+// When the TargetPath matches more than one package, each package is only
+// asked for the symbols it declares and packages without any are skipped
+func (l *Loader) LoadPackages(symbolNames []string) ([]*PackageSymbols, error) {
+	return l.LoadPackagesContext(context.Background(), symbolNames)
+}
+
+// LoadPackagesContext is the LoadPackages which stops building
+// the remaining plugins when the context is done
+func (l *Loader) LoadPackagesContext(ctx context.Context, symbolNames []string) ([]*PackageSymbols, error) {
+	l.loading.Lock()
+	defer l.loading.Unlock()
+
+	// correlate logs of the whole run
+	if RunFromContext(ctx) == "" {
+		ctx = ContextWithRun(ctx, NewRunID())
+	}
+
+	pkgs, err := l.FindPackages(l.TargetPath)
 	if err != nil {
 		return nil, errors.Wrap(ErrFindPackageFailed, err.Error())
 	}
 
-	// copy everything into the cache so we can manipulate it further and avoid caching
-	cacheDir := DefaultCache
-	if l.CacheDir != "" {
-		cacheDir = l.CacheDir
+	pkgSyms := []*PackageSymbols{}
+	for _, pkg := range pkgs {
+		names := symbolNames
+		if len(pkgs) > 1 {
+			names, err = filterDeclaredNames(pkg, symbolNames)
+			if err != nil {
+				return nil, errors.Wrap(ErrFindPackageFailed, err.Error())
+			}
+
+			if len(names) == 0 {
+				continue
+			}
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		span := L.Start(ctx, "Loader", "package").WithField("Package", pkg.PkgPath)
+		syms, err := l.loadPackage(ctx, pkg, names)
+		span.End()
+		if err != nil {
+			return nil, err
+		}
+
+		pkgSyms = append(pkgSyms, &PackageSymbols{
+			Package: pkg,
+			Symbols: syms,
+		})
+	}
+
+	return pkgSyms, nil
+}
+
+// loadPackage runs the full plugin lifecycle for a single package
+func (l *Loader) loadPackage(ctx context.Context, pkg *packages.Package, symbolNames []string) ([]interface{}, error) {
+	cacheDir := l.cacheDir()
+	buildCache := &BuildCache{
+		Dir:     filepath.Join(cacheDir, "plugins"),
+		MaxSize: l.CacheMaxSize,
+		MaxAge:  l.CacheMaxAge,
+	}
+
+	if l.Isolated {
+		return l.loadIsolated(ctx, pkg, symbolNames, cacheDir, buildCache)
+	}
+
+	// resolve names of the symbols that will be generated for the models
+	var symbols map[string]string
+	if l.GenerateSymbols {
+		var err error
+		symbols, err = ResolveModelSymbols(pkg, symbolNames)
+		if err != nil {
+			return nil, errors.Wrap(ErrSymbolGenerationFailed, err.Error())
+		}
+	}
+
+	// reuse the plugin built from the same sources if there is one
+	var key string
+	if !l.DisableBuildCache {
+		var err error
+		span := L.Start(ctx, "Loader", "cache").WithField("Package", pkg.PkgPath)
+		key, err = l.CacheKey(pkg, append([]string{strconv.FormatBool(l.GenerateSymbols)}, symbolNames...)...)
+		span.End()
+		if err != nil {
+			return nil, errors.Wrap(ErrBuildCacheFailed, err.Error())
+		}
+
+		if so, ok := buildCache.Get(key); ok {
+			L.MethodContext(ctx, "Loader", "loadPackage").Debugln("Reusing cached plugin for ", pkg.PkgPath)
+			return l.loadSymbols(ctx, so, symbolNames, symbols)
+		}
 	}
 
-	cacheTargetPath, err := CopyPackageToCache(pkg, cacheDir)
+	// copy everything into the cache so we can manipulate it further and avoid caching
+	span := L.Start(ctx, "Loader", "copy").WithField("Package", pkg.PkgPath)
+	ws, err := NewWorkspace(pkg, cacheDir)
+	span.End()
 	if err != nil {
 		return nil, errors.Wrap(ErrCopyingToCacheFailed, err.Error())
 	}
 
-	// generate symbols and accept new symbol names
+	// generate symbols into the copied package
 	if l.GenerateSymbols {
-		symbolNames, err = GenerateSymbolsForModels(symbolNames, cacheTargetPath)
+		span = L.Start(ctx, "Loader", "generate").WithField("Package", pkg.PkgPath)
+		_, err = GenerateSymbolsForModels(symbolNames, ws)
+		span.End()
 		if err != nil {
 			return nil, errors.Wrap(ErrSymbolGenerationFailed, err.Error())
 		}
 	}
 
-	so, err := Build(cacheTargetPath, cacheTargetPath)
+	target, err := l.ResolveBuildTarget(pkg)
+	if err != nil {
+		return nil, errors.Wrap(ErrModuleResolveFailed, err.Error())
+	}
+
+	span = L.Start(ctx, "Loader", "build").WithField("Package", pkg.PkgPath)
+	so, err := l.BuildContext(ctx, ws, target)
+	span.End()
 	if err != nil {
 		return nil, errors.Wrap(ErrBuildFailed, err.Error())
 	}
 
-	syms, err := LoadSymbols(so, symbolNames)
+	if !l.DisableBuildCache {
+		so, err = buildCache.Put(key, so)
+		if err != nil {
+			return nil, errors.Wrap(ErrBuildCacheFailed, err.Error())
+		}
+
+		err = buildCache.Prune(key)
+		if err != nil {
+			return nil, errors.Wrap(ErrBuildCacheFailed, err.Error())
+		}
+	}
+
+	syms, err := l.loadSymbols(ctx, so, symbolNames, symbols)
 	if err != nil {
-		return nil, errors.Wrap(ErrSymbolLoadFailed, err.Error())
+		return nil, err
 	}
 
 	// don't do cleanup if we want to preserve the cache, just return
@@ -74,115 +262,66 @@ func (l *Loader) Load(symbolNames []string) ([]interface{}, error) {
 		return syms, nil
 	}
 
-	return syms, os.RemoveAll(cacheTargetPath)
+	return syms, ws.Cleanup()
 }
 
-// Watch watches for changes in the given plugin and emits new symbols
-// on changes
-func (l *Loader) Watch(symbolNames []string, done <-chan bool) (<-chan []interface{}, <-chan error) {
-	out := make(chan []interface{})
-	errOut := make(chan error)
+// cacheDir returns the cache directory of the loader
+func (l *Loader) cacheDir() string {
+	if l.CacheDir != "" {
+		return l.CacheDir
+	}
+
+	return DefaultCache
+}
 
-	// initialize the watcher with the plugin path
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		errOut <- err
-		return out, errOut
+// loadSymbols loads the symbols from the built plugin, translating model
+// names to generated symbol names when symbols are generated
+func (l *Loader) loadSymbols(ctx context.Context, so string, symbolNames []string, generated map[string]string) ([]interface{}, error) {
+	span := L.Start(ctx, "Loader", "symbols").WithField("Plugin", so)
+	defer span.End()
+
+	if l.GenerateSymbols {
+		names := []string{}
+		for _, model := range symbolNames {
+			names = append(names, generated[model])
+		}
+		symbolNames = names
 	}
-	err = watcher.Add(l.TargetPath)
+
+	syms, err := LoadSymbols(so, symbolNames)
 	if err != nil {
-		errOut <- err
-		return out, errOut
-	}
-
-	go func(watcher *fsnotify.Watcher, symbolNames []string, out chan []interface{}, done <-chan bool, errs chan error) {
-		defer func() {
-			close(out)
-			close(errs)
-		}()
-
-		// create a debounce channel so we will only triggerChange once for multiple changes
-		// this is closed automatically by the debouncer when new value is returned, so it must be
-		// renewed when new value should be accepted
-		events := eventDebounce(time.Millisecond*300, watcher.Events)
-
-	eventLoop:
-		for {
-			select {
-			// look for events on the filesystem
-			case _, ok := <-events:
-				// this will break only when we renew the debouncer and the watcher is closed
-				if !ok {
-					break eventLoop
-				}
-
-				// renew the debouncer for the new value
-				events = eventDebounce(time.Millisecond*300, watcher.Events)
-
-				syms, err := l.Load(symbolNames)
-				if err != nil {
-					errs <- err
-					break
-				}
-
-				// distribute the symbols loaded from the plugin
-				out <- syms
-
-				// errors can be handled gracefully and should be proxied to the
-				// caller, they can then use `done` channel to stop the execution
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					break eventLoop
-				}
-				if err != nil {
-					errs <- err
-				}
-
-			case <-done:
-				err = watcher.Close()
-				if err != nil {
-					errs <- err
-				}
-				break eventLoop
+		return nil, errors.Wrap(ErrSymbolLoadFailed, err.Error())
+	}
 
-			}
+	// generated symbols hold pointers to models, so they are dereferenced
+	// to be returned as pointers to models as well
+	if l.GenerateSymbols {
+		for i, sym := range syms {
+			syms[i] = reflect.ValueOf(sym).Elem().Interface()
 		}
-	}(watcher, symbolNames, out, done, errOut)
+	}
 
-	return out, errOut
+	return syms, nil
 }
 
-// eventDebounce creates a new debouncer that will be closed once the value is returned
-func eventDebounce(interval time.Duration, input <-chan fsnotify.Event) <-chan fsnotify.Event {
-	out := make(chan fsnotify.Event)
+// filterDeclaredNames returns only those symbol names which are declared
+// within the given package, 'all' is passed through untouched
+func filterDeclaredNames(pkg *packages.Package, symbolNames []string) ([]string, error) {
+	if len(symbolNames) == 1 && symbolNames[0] == "all" {
+		return symbolNames, nil
+	}
 
-	go func(interval time.Duration, in <-chan fsnotify.Event, out chan fsnotify.Event) {
-		var ev fsnotify.Event
-		defer func() {
-			close(out)
-		}()
+	declared, err := DeclaredNames(pkg)
+	if err != nil {
+		return nil, err
+	}
 
-		// first iteration out of the after interval, so we will not loop in the time.After without value
-		item, ok := <-input
-		if !ok {
-			return
+	names := []string{}
+	for _, name := range symbolNames {
+		if declared[name] {
+			names = append(names, name)
 		}
-		ev = item
-
-		for {
-			select {
-			case item, ok := <-input:
-				// if we close the input, we'll just close the output as well
-				if !ok {
-					return
-				}
-				ev = item
-			case <-time.After(interval):
-				out <- ev
-				return
-			}
-		}
-	}(interval, input, out)
+	}
 
-	return out
+	return names, nil
 }
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
@@ -8,7 +9,11 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	. "github.com/petomalina/mirror/pkg/logger"
 )
 
 type LoaderSuite struct {
@@ -33,11 +38,17 @@ type WatchCandidate struct {
 	errs             []error
 	loadedSymbolsLen int
 	triggerChange    bool
+
+	// trigger is the file rewritten to trigger the change, model.go of the target by default
+	trigger string
 }
 
 const (
 	TestCacheDir     = ".testmirror"
 	ReadonlyCacheDir = ".testmirror-readonly"
+
+	// WatchTestTimeout fails the watch instead of waiting for the changes forever
+	WatchTestTimeout = time.Minute
 )
 
 func (s *LoaderSuite) SetupTest() {
@@ -49,7 +60,24 @@ func (s *LoaderSuite) TearDownTest() {
 
 	// clean the readonly cache after the test as we won't
 	// shouldn't be able to copy anything to that folder anyway
-	s.NoError(os.Remove(ReadonlyCacheDir))
+	s.NoError(os.RemoveAll(ReadonlyCacheDir))
+}
+
+// skipReadonly reports whether the candidate using the readonly cache should
+// be skipped, as its copying can't fail when the dir is writable anyway, e.g. by root
+func (s *LoaderSuite) skipReadonly(loader *Loader) bool {
+	if loader.CacheDir != ReadonlyCacheDir {
+		return false
+	}
+
+	probe := filepath.Join(ReadonlyCacheDir, "probe")
+	if err := ioutil.WriteFile(probe, nil, 0644); err != nil {
+		return false
+	}
+
+	s.NoError(os.Remove(probe))
+	fmt.Println("Skipping test case with the writable readonly cache")
+	return true
 }
 
 func (s *LoaderSuite) CleanupCacheDirs() {
@@ -85,6 +113,42 @@ func (s *LoaderSuite) TestLoad() {
 			symbols: []string{"User"},
 			len:     1,
 		},
+		{
+			name: "Generate symbols for non-struct models in ./fixtures/usernosymbol",
+			loader: &Loader{
+				TargetPath:      "./fixtures/usernosymbol",
+				GenerateSymbols: true,
+			},
+			symbols: []string{"User", "Email", "Notifier"},
+			len:     3,
+		},
+		{
+			name: "Generate symbols colliding with declarations in ./fixtures/usercollision",
+			loader: &Loader{
+				TargetPath:      "./fixtures/usercollision",
+				GenerateSymbols: true,
+			},
+			symbols: []string{"User"},
+			len:     1,
+		},
+		{
+			name: "Generate symbols for all packages declaring the model in ./fixtures/...",
+			loader: &Loader{
+				TargetPath:      "./fixtures/...",
+				GenerateSymbols: true,
+			},
+			symbols: []string{"User"},
+			len:     5,
+		},
+		{
+			name: "Get symbol generation error for unknown models in ./fixtures/usernosymbol",
+			loader: &Loader{
+				TargetPath:      "./fixtures/usernosymbol",
+				GenerateSymbols: true,
+			},
+			symbols: []string{"Admin"},
+			err:     ErrSymbolGenerationFailed,
+		},
 		{
 			name: "Preserve cache for ./fixtures/user",
 			loader: &Loader{
@@ -106,6 +170,93 @@ func (s *LoaderSuite) TestLoad() {
 			len:            1,
 			preservedCache: true,
 		},
+		{
+			name: "Load symbols importing internal and standard packages from ./fixtures/userimports",
+			loader: &Loader{
+				TargetPath: "./fixtures/userimports",
+			},
+			symbols: []string{"XUser"},
+			len:     1,
+		},
+		{
+			name: "Load symbols from a package with a complex layout in ./fixtures/userlayout",
+			loader: &Loader{
+				TargetPath: "./fixtures/userlayout",
+			},
+			symbols: []string{"XUser"},
+			len:     1,
+		},
+		{
+			name: "Load symbols guarded by build tags from ./fixtures/usertagged",
+			loader: &Loader{
+				TargetPath: "./fixtures/usertagged",
+				BuildConfig: BuildConfig{
+					Tags: []string{"mirror"},
+				},
+			},
+			symbols: []string{"XUser"},
+			len:     1,
+		},
+		{
+			name: "Get symbol load fail without build tags in ./fixtures/usertagged",
+			loader: &Loader{
+				TargetPath: "./fixtures/usertagged",
+			},
+			symbols: []string{"XUser"},
+			err:     ErrSymbolLoadFailed,
+		},
+		{
+			name: "Load symbols only from packages declaring them in ./fixtures/...",
+			loader: &Loader{
+				TargetPath: "./fixtures/...",
+			},
+			symbols: []string{"XUser"},
+			len:     3,
+		},
+		{
+			name: "Load symbols using 'all' from all packages in ./fixtures/...",
+			loader: &Loader{
+				TargetPath: "./fixtures/...",
+			},
+			symbols: []string{"all"},
+			len:     5,
+		},
+		{
+			name: "Describe models in isolation from ./fixtures/userimports",
+			loader: &Loader{
+				TargetPath: "./fixtures/userimports",
+				Isolated:   true,
+			},
+			symbols: []string{"User"},
+			len:     1,
+		},
+		{
+			name: "Describe symbols using 'all' in isolation from ./fixtures/user",
+			loader: &Loader{
+				TargetPath: "./fixtures/user",
+				Isolated:   true,
+			},
+			symbols: []string{"all"},
+			len:     1,
+		},
+		{
+			name: "Get symbol generation error for unknown model in isolation from ./fixtures/user",
+			loader: &Loader{
+				TargetPath: "./fixtures/user",
+				Isolated:   true,
+			},
+			symbols: []string{"Unknown"},
+			err:     ErrSymbolGenerationFailed,
+		},
+		{
+			name: "Get build error for a nil interface model in isolation from ./fixtures/usernil",
+			loader: &Loader{
+				TargetPath: "./fixtures/usernil",
+				Isolated:   true,
+			},
+			symbols: []string{"XModel"},
+			err:     ErrBuildFailed,
+		},
 		{
 			name: "Get error when copying to readonly folder from ./fixtures/usernosymbol",
 			loader: &Loader{
@@ -133,6 +284,9 @@ func (s *LoaderSuite) TestLoad() {
 
 	for _, c := range candidates {
 		fmt.Println("Running test case:", c.name)
+		if s.skipReadonly(c.loader) {
+			continue
+		}
 
 		model, err := c.loader.Load(c.symbols)
 
@@ -154,6 +308,92 @@ func (s *LoaderSuite) TestLoad() {
 	}
 }
 
+func (s *LoaderSuite) TestLoadPackages() {
+	pkgSyms, err := (&Loader{TargetPath: "./fixtures/..."}).LoadPackages([]string{"XUser"})
+	s.NoError(err)
+
+	s.Len(pkgSyms, 3)
+	s.EqualValues("github.com/petomalina/mirror/pkg/plugins/fixtures/user", pkgSyms[0].Package.PkgPath)
+	s.Len(pkgSyms[0].Symbols, 1)
+	s.EqualValues("github.com/petomalina/mirror/pkg/plugins/fixtures/userimports", pkgSyms[1].Package.PkgPath)
+	s.Len(pkgSyms[1].Symbols, 1)
+	s.EqualValues("github.com/petomalina/mirror/pkg/plugins/fixtures/userlayout", pkgSyms[2].Package.PkgPath)
+	s.Len(pkgSyms[2].Symbols, 1)
+}
+
+func (s *LoaderSuite) TestLoadBuildCache() {
+	loader := &Loader{
+		TargetPath:      "./fixtures/usernosymbol",
+		GenerateSymbols: true,
+	}
+
+	for i := 0; i < 2; i++ {
+		syms, err := loader.Load([]string{"User"})
+		s.NoError(err)
+		s.Len(syms, 1)
+	}
+
+	// the second load reuses the plugin built by the first one
+	ff, err := ioutil.ReadDir(filepath.Join(DefaultCache, "plugins"))
+	s.NoError(err)
+	s.Len(ff, 1)
+}
+
+func (s *LoaderSuite) TestLoadSpans() {
+	logFile := filepath.Join(TestCacheDir, "mirror.log")
+	s.NoError(os.MkdirAll(TestCacheDir, os.ModePerm))
+	s.NoError(L.Configure(Options{Format: FormatJSON, Output: logFile, Level: "debug"}))
+	defer func() {
+		s.NoError(L.Configure(Options{}))
+	}()
+
+	loader := &Loader{
+		TargetPath:        "./fixtures/usernosymbol",
+		GenerateSymbols:   true,
+		DisableBuildCache: true,
+	}
+	_, err := loader.Load([]string{"User"})
+	s.NoError(err)
+
+	bb, err := ioutil.ReadFile(logFile)
+	s.NoError(err)
+
+	// every phase is logged once within the same run
+	spans := []string{}
+	runs := map[interface{}]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(bb)), "\n") {
+		entry := map[string]interface{}{}
+		s.NoError(json.Unmarshal([]byte(line), &entry))
+
+		if span, ok := entry["Span"].(string); ok {
+			spans = append(spans, span)
+			runs[entry["Run"]] = true
+		}
+	}
+
+	s.EqualValues([]string{"copy", "generate", "build", "symbols", "package"}, spans)
+	s.Len(runs, 1)
+}
+
+func (s *LoaderSuite) TestLoadIsolated() {
+	syms, err := (&Loader{TargetPath: "./fixtures/usernosymbol", Isolated: true}).Load([]string{"User"})
+	s.NoError(err)
+	s.Len(syms, 1)
+
+	desc, ok := syms[0].(*TypeDescription)
+	s.True(ok)
+	s.EqualValues("User", desc.Name)
+	s.EqualValues("github.com/petomalina/mirror/pkg/plugins/fixtures/usernosymbol", desc.PkgPath)
+	s.EqualValues("struct", desc.Kind)
+	s.NotEmpty(desc.Fields)
+}
+
+func (s *LoaderSuite) TestLoadIsolatedNilInterface() {
+	_, err := (&Loader{TargetPath: "./fixtures/usernil", Isolated: true}).Load([]string{"XModel"})
+	s.EqualValues(ErrBuildFailed, errors.Cause(err))
+	s.Contains(err.Error(), "XModel is a nil interface")
+}
+
 func (s *LoaderSuite) TestWatch() {
 	candidates := []WatchCandidate{
 		{
@@ -172,6 +412,16 @@ func (s *LoaderSuite) TestWatch() {
 			loadedSymbolsLen: 1,
 			triggerChange:    true,
 		},
+		{
+			name: "Watch local dependencies of ./fixtures/userimports (triggered)",
+			loader: &Loader{
+				TargetPath: "./fixtures/userimports",
+			},
+			symbols:          []string{"XUser"},
+			loadedSymbolsLen: 1,
+			triggerChange:    true,
+			trigger:          "./fixtures/internal/base/model.go",
+		},
 		{
 			name: "Get errors within ./fixtures/usernosymbol without generating (triggered)",
 			loader: &Loader{
@@ -194,6 +444,9 @@ func (s *LoaderSuite) TestWatch() {
 
 	for _, c := range candidates {
 		fmt.Println("Running test case:", c.name)
+		if s.skipReadonly(c.loader) {
+			continue
+		}
 
 		done := make(chan bool)
 		modelsChan, errChan := c.loader.Watch(c.symbols, done)
@@ -201,11 +454,22 @@ func (s *LoaderSuite) TestWatch() {
 		s.NotNil(modelsChan)
 		s.NotNil(errChan)
 
-		// create and remove a file in the folder to triggerChange a random change
+		trigger := c.trigger
+		if trigger == "" {
+			trigger = filepath.Join(c.loader.TargetPath, "model.go")
+		}
+		trigger, err := filepath.Abs(trigger)
+		s.NoError(err)
+
+		// create and remove an ignored file and rewrite the trigger to triggerChange a change
 		if c.triggerChange {
 			fName := filepath.Join(c.loader.TargetPath, fmt.Sprintf("%d.txt", rand.Int()))
 			s.NoError(ioutil.WriteFile(fName, []byte("hello world"), os.ModePerm))
 			s.NoError(os.Remove(fName))
+
+			bb, err := ioutil.ReadFile(trigger)
+			s.NoError(err)
+			s.NoError(ioutil.WriteFile(trigger, bb, 0644))
 		}
 
 		// setup helper for expected number of triggers so we can break the channels
@@ -230,16 +494,27 @@ func (s *LoaderSuite) TestWatch() {
 					break
 				}
 
+				// failed rebuilds don't stop the watch
+				s.IsType(&WatchError{}, err)
 				s.EqualValues(c.errs[errTriggerCounter], errors.Cause(err))
 				errTriggerCounter++
-			case syms, ok := <-modelsChan:
+			case batch, ok := <-modelsChan:
 				if !ok {
 					s.EqualValues(expectedModelTriggersCount, modelTriggerCounter)
 					break
 				}
 
-				s.EqualValues(c.loadedSymbolsLen, len(syms))
+				// only the rewritten go file is changed, the ignored one is left out
+				s.EqualValues([]string{trigger}, batch.ChangedFiles)
+
+				loadedSymbolsLen := 0
+				for _, ps := range batch.Packages {
+					loadedSymbolsLen += len(ps.Symbols)
+				}
+				s.EqualValues(c.loadedSymbolsLen, loadedSymbolsLen)
 				modelTriggerCounter++
+			case <-time.After(WatchTestTimeout):
+				s.FailNow("Timed out waiting for the watch", c.name)
 			}
 		}
 
@@ -247,6 +522,20 @@ func (s *LoaderSuite) TestWatch() {
 	}
 }
 
+func (s *LoaderSuite) TestWatchStartFailure() {
+	modelsChan, errChan := (&Loader{TargetPath: "./fixtures/nonexisting"}).Watch([]string{"XUser"}, make(chan bool))
+
+	err, ok := <-errChan
+	s.True(ok)
+	s.EqualValues(ErrWatcherFailed, errors.Cause(err))
+
+	// the watch is stopped without being signaled
+	_, ok = <-errChan
+	s.False(ok)
+	_, ok = <-modelsChan
+	s.False(ok)
+}
+
 func TestLoaderSuite(t *testing.T) {
 	suite.Run(t, &LoaderSuite{})
 }
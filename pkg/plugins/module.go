@@ -0,0 +1,171 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+// Module describes the main module the packages are resolved in
+type Module struct {
+	Path  string
+	Dir   string
+	GoMod string
+}
+
+// FindModule returns the main module for the current working directory.
+// Nil module is returned when running outside of the module mode
+func FindModule() (*Module, error) {
+	return (&BuildConfig{}).FindModule()
+}
+
+// FindModule returns the main module using the build configuration,
+// see the FindModule function for details
+func (c *BuildConfig) FindModule() (*Module, error) {
+	out, err := c.goEnv("GOMOD")
+	if err != nil {
+		return nil, err
+	}
+
+	// GOMOD is empty in GOPATH mode and os.DevNull when outside of any module
+	goMod := strings.TrimSpace(out)
+	if goMod == "" || goMod == os.DevNull {
+		return nil, nil
+	}
+
+	out, err = c.output("list", "-m", "-json")
+	if err != nil {
+		return nil, err
+	}
+
+	mod := &Module{}
+	err = json.Unmarshal([]byte(out), mod)
+	if err != nil {
+		return nil, err
+	}
+
+	return mod, nil
+}
+
+// BuildTarget describes the virtual location the cached copy of a package
+// is mounted to when it's being built. Mounting the copy into the module
+// graph lets the go tool resolve its imports (go.mod, replace directives,
+// vendor directory, internal packages) the same way as for the original
+type BuildTarget struct {
+	// ImportPath is the import path the cached copy is built under
+	ImportPath string
+
+	// Dir is the virtual directory the cached files are mounted to
+	Dir string
+}
+
+// ResolveBuildTarget returns a unique build target for the given package.
+// The copy is mounted as a subpackage of the original package when possible,
+// so it keeps access to internal packages of its module. Packages that can't
+// be overlaid by the go tool (module cache, vendor directory) are mounted into
+// the root of the main module instead
+func ResolveBuildTarget(pkg *packages.Package) (*BuildTarget, error) {
+	return (&BuildConfig{}).ResolveBuildTarget(pkg)
+}
+
+// ResolveBuildTarget returns a unique build target for the given package
+// using the build configuration, see the ResolveBuildTarget function for details
+func (c *BuildConfig) ResolveBuildTarget(pkg *packages.Package) (*BuildTarget, error) {
+	name := fmt.Sprintf("mirror_%d", rand.Int())
+
+	pkgDir, err := filepath.Abs(PackageDir(pkg))
+	if err != nil {
+		return nil, err
+	}
+
+	mod, err := c.FindModule()
+	if err != nil {
+		return nil, err
+	}
+
+	// GOPATH mode has no restrictions on the overlay
+	if mod == nil {
+		return &BuildTarget{
+			ImportPath: pkg.PkgPath + "/" + name,
+			Dir:        filepath.Join(pkgDir, name),
+		}, nil
+	}
+
+	modCache, err := c.goEnv("GOMODCACHE")
+	if err != nil {
+		return nil, err
+	}
+
+	if isWithin(pkgDir, strings.TrimSpace(modCache)) || isWithin(pkgDir, filepath.Join(mod.Dir, "vendor")) {
+		L.Method("Internal/module", "ResolveBuildTarget").Trace("Mounting ", pkg.PkgPath, " into the main module ", mod.Path)
+
+		return &BuildTarget{
+			ImportPath: mod.Path + "/" + name,
+			Dir:        filepath.Join(mod.Dir, name),
+		}, nil
+	}
+
+	return &BuildTarget{
+		ImportPath: pkg.PkgPath + "/" + name,
+		Dir:        filepath.Join(pkgDir, name),
+	}, nil
+}
+
+// overlayConfig is the format of the file passed to the go tool -overlay flag
+type overlayConfig struct {
+	Replace map[string]string
+}
+
+// overlayFile is the name of the overlay configuration within the cached package
+const overlayFile = "overlay.json"
+
+// WriteOverlay maps all source files of the cached package into the build target
+// directory and writes the overlay configuration into the cached package,
+// returning the path to it
+func WriteOverlay(cacheTargetPath string, target *BuildTarget) (string, error) {
+	ff, err := ioutil.ReadDir(cacheTargetPath)
+	if err != nil {
+		return "", err
+	}
+
+	overlay := overlayConfig{
+		Replace: map[string]string{},
+	}
+	for _, f := range ff {
+		// skip build artifacts of previous builds
+		if f.IsDir() || f.Name() == overlayFile || filepath.Ext(f.Name()) == ".so" {
+			continue
+		}
+
+		overlay.Replace[filepath.Join(target.Dir, f.Name())] = filepath.Join(cacheTargetPath, f.Name())
+	}
+
+	bb, err := json.Marshal(overlay)
+	if err != nil {
+		return "", err
+	}
+
+	overlayPath := filepath.Join(cacheTargetPath, overlayFile)
+	return overlayPath, ioutil.WriteFile(overlayPath, bb, os.ModePerm)
+}
+
+// isWithin returns true if the path is located within the given dir
+func isWithin(path, dir string) bool {
+	if dir == "" {
+		return false
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -1,44 +1,65 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"github.com/petomalina/mirror/pkg/cp"
+	"github.com/pkg/errors"
 	"golang.org/x/tools/go/packages"
-	"io/ioutil"
 	"math/rand"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"plugin"
 	"reflect"
-	"regexp"
+	"strings"
 	"unsafe"
 
 	. "github.com/petomalina/mirror/pkg/logger"
 )
 
-var (
-	pkgRegex = regexp.MustCompile(`(?m:^package (?P<pkg>\w+$))`)
-)
+// Build builds the package copied into the workspace into plugin and saves
+// it in the workspace under a random name .so, returning the name to the caller.
+// The workspace is mounted to the build target, so its imports are resolved
+// within the module graph of the original package
+func Build(ws *Workspace, target *BuildTarget) (string, error) {
+	return (&BuildConfig{}).Build(ws, target)
+}
+
+// Build builds the package copied into the workspace into plugin using
+// the build configuration, see the Build function for details
+func (c *BuildConfig) Build(ws *Workspace, target *BuildTarget) (string, error) {
+	return c.BuildContext(context.Background(), ws, target)
+}
 
-// Build builds the given package into plugin and saves it in
-// current path under a random name .so, returning the name to the caller
-func Build(pkg string, out string) (string, error) {
-	L.Method("Internal/plugin", "Build").Trace("Invoked with pkg: ", pkg)
+// BuildContext is the Build which is stopped when the context is done
+func (c *BuildConfig) BuildContext(ctx context.Context, ws *Workspace, target *BuildTarget) (string, error) {
+	L.Method("Internal/plugin", "Build").Trace("Invoked with workspace: ", ws.Dir)
 	// random file name so we'll get unique plugins each time
 	uniq := rand.Int()
 
-	objPath := filepath.Join(out, fmt.Sprintf("%d.so", uniq))
+	objPath := filepath.Join(ws.Dir, fmt.Sprintf("%d.so", uniq))
 	L.Method("Bundle", "Run").Trace("Object path: ", objPath)
 
-	// create the plugin from the passed package
-	err := ChangePackage(pkg, "main")
+	// create the plugin from the passed package, the names of its imports
+	// are needed to strip the imports of its main funcs
+	importNames, err := c.ImportNames(ws.Package)
+	if err != nil {
+		return objPath, err
+	}
+	ws.ImportNames = importNames
+
+	err = ws.ChangePackage("main")
+	if err != nil {
+		return objPath, err
+	}
+
+	overlay, err := WriteOverlay(ws.Dir, target)
 	if err != nil {
 		return objPath, err
 	}
 
 	// create the command to execute the build
-	cmd := exec.Command("go", "build", "-buildmode=plugin", "-o="+objPath, pkg)
+	args := append([]string{"build", "-buildmode=plugin", "-overlay=" + overlay, "-o=" + objPath}, c.BuildFlags()...)
+	cmd := c.CommandContext(ctx, append(args, target.ImportPath)...)
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 
@@ -87,103 +108,90 @@ func LoadSymbols(pluginPath string, symbols []string) ([]interface{}, error) {
 	return models, nil
 }
 
-// ChangePackage changes the `package X` line of each file in the
-// targeted package, changing its name to the desiredPkgName, running the
-// `run` function and changing it back to the default
-func ChangePackage(pkgName, desiredPkgName string) error {
-	L.Method("Internal/package", "ChangePackage").Trace("Invoked on pkgName: ", pkgName)
-	pkg, err := FindPackage(pkgName)
+// FindPackage returns names of go files in the targeted package
+func FindPackage(pkg string) (*packages.Package, error) {
+	pkgs, err := FindPackages(pkg)
 	if err != nil {
-		return err
-	}
-
-	// replace all package directives to the desired package names
-	for _, f := range pkg.GoFiles {
-		// read the go file first
-		bb, err := ioutil.ReadFile(f)
-		if err != nil {
-			return err
-		}
-
-		// write it back with the replaced package (into the out dir)
-		err = ioutil.WriteFile(
-			f,
-			[]byte(pkgRegex.ReplaceAll(bb, []byte("package "+desiredPkgName))),
-			0,
-		)
-
-		if err != nil {
-			return err
-		}
+		return nil, err
 	}
 
-	return nil
+	return pkgs[0], nil
 }
 
-// GenerateSymbolsForModels generates symbols for all models, mutates
-// the input symbols to be compatible with newly created symbols and
-// writes a new file with these generated symbols
-func GenerateSymbolsForModels(symbolNames []string, out string) ([]string, error) {
-	symbolsFile := filepath.Join(out, fmt.Sprintf("/%d.go", rand.Int()))
-
-	tmpl := `// DO NOT EDIT: THIS BLOCK IS AUTOGENERATED BY MIRROR BUNDLE
-package main
+// FindPackages returns all packages matching the given patterns, e.g.
+// ./models/... will return every package found under the models directory
+func FindPackages(patterns ...string) ([]*packages.Package, error) {
+	return (&BuildConfig{}).FindPackages(patterns...)
+}
 
-var (
-`
+// FindPackages returns all packages matching the given patterns
+// using the build configuration, see the FindPackages function for details
+func (c *BuildConfig) FindPackages(patterns ...string) ([]*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode:       packages.LoadFiles,
+		Tests:      false,
+		BuildFlags: c.BuildFlags(),
+		Env:        c.Environ(),
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, m := range symbolNames {
-		tmpl += "\tX" + m + "  = " + m + "{}\n"
+	if len(pkgs) == 0 {
+		return nil, errors.Errorf("no packages found for %v", patterns)
 	}
 
-	tmpl += ")\n"
+	// the loader reports missing or broken packages only through their errors
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) != 0 {
+			return nil, errors.Errorf("package %s: %v", pkg.ID, pkg.Errors[0])
+		}
 
-	// mutate to match the symbol prefix
-	for i := range symbolNames {
-		symbolNames[i] = "X" + symbolNames[i]
+		if len(pkg.GoFiles) == 0 {
+			return nil, errors.Errorf("package %s: no go files found", pkg.ID)
+		}
 	}
 
-	return symbolNames, ioutil.WriteFile(symbolsFile, []byte(tmpl), os.ModePerm)
+	return pkgs, nil
 }
 
-const DefaultCache = ".mirror"
+// ImportNames returns the package names of the imports of the package by
+// their import paths, which may differ from the last element of the path,
+// e.g. yaml for gopkg.in/yaml.v2
+func (c *BuildConfig) ImportNames(pkg *packages.Package) (map[string]string, error) {
+	names := map[string]string{}
 
-// CopyPackageToCache copies a given package into a given cache dir
-// returning the cache dir subdirectory into which the package was copied
-func CopyPackageToCache(pkg *packages.Package, cacheDir string) (string, error) {
-	// Copy the directory so the plugin can be build outside
-	pkgCacheDir, err := filepath.Abs(filepath.Join(cacheDir, fmt.Sprintf("%d", rand.Int())))
-	if err != nil {
-		return "", err
+	// imports are only known to packages loaded together with their imports
+	if len(pkg.Imports) != 0 {
+		for impPath, imp := range pkg.Imports {
+			names[impPath] = imp.Name
+		}
+
+		return names, nil
 	}
 
-	L.Method("Bundle", "Run").Trace("Making cache dir: ", pkgCacheDir)
-	err = os.MkdirAll(pkgCacheDir, os.ModePerm)
+	args := append([]string{"list", "-deps", "-f", "{{ .ImportPath }}\t{{ .Name }}"}, c.BuildFlags()...)
+	out, err := c.output(append(args, pkg.PkgPath)...)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	L.Method("Bundle", "Run").Trace("Copying ", pkg, "->", pkgCacheDir)
-	for _, f := range pkg.GoFiles {
-		err := cp.File(f, filepath.Join(pkgCacheDir, filepath.Base(f)))
-		if err != nil {
-			return pkgCacheDir, err
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 2 {
+			names[fields[0]] = fields[1]
 		}
 	}
 
-	return pkgCacheDir, nil
+	return names, nil
 }
 
-// FindPackage returns names of go files in the targeted package
-func FindPackage(pkg string) (*packages.Package, error) {
-	cfg := &packages.Config{
-		Mode:  packages.LoadFiles,
-		Tests: false,
-	}
-	pkgs, err := packages.Load(cfg, pkg)
-	if err != nil {
-		return nil, err
+// PackageDir returns the directory the given package is located in
+func PackageDir(pkg *packages.Package) string {
+	if len(pkg.GoFiles) == 0 {
+		return ""
 	}
 
-	return pkgs[0], nil
+	return filepath.Dir(pkg.GoFiles[0])
 }
@@ -0,0 +1,136 @@
+package plugins
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"golang.org/x/tools/go/ast/astutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrPackageConversionFailed = errors.New("Failed to convert the package")
+)
+
+// majorVersion matches the major version suffix of module paths, e.g. v2
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// RewritePackage parses the given go source and returns it with the package
+// clause changed to desiredPkgName. Only the package clause itself is changed,
+// comments, build constraints and string literals are kept as they were.
+// The importNames are package names of the imports by their paths, used to
+// find imports of the stripped main funcs, see ImportNames
+func RewritePackage(filename string, src []byte, desiredPkgName string, importNames map[string]string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	file.Name.Name = desiredPkgName
+
+	if desiredPkgName == "main" {
+		stripMainFuncs(fset, file, importNames)
+	}
+
+	buf := &bytes.Buffer{}
+	cfg := &printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	err = cfg.Fprint(buf, fset, file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't print %s", filename)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// stripMainFuncs removes `main` and `init` functions from the file together
+// with their comments and imports that were used only by them
+func stripMainFuncs(fset *token.FileSet, file *ast.File, importNames map[string]string) {
+	usedBefore := selectorNames(file)
+
+	decls := []ast.Decl{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || (fn.Name.Name != "main" && fn.Name.Name != "init") {
+			decls = append(decls, decl)
+			continue
+		}
+
+		// drop the comments of the stripped function, the printer would
+		// place them elsewhere otherwise
+		comments := []*ast.CommentGroup{}
+		for _, c := range file.Comments {
+			if c.Pos() >= fn.Pos() && c.End() <= fn.End() || c == fn.Doc {
+				continue
+			}
+			comments = append(comments, c)
+		}
+		file.Comments = comments
+	}
+	file.Decls = decls
+
+	usedAfter := selectorNames(file)
+	for _, imp := range append([]*ast.ImportSpec{}, file.Imports...) {
+		impPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		name, ok := importNames[impPath]
+		if !ok {
+			name = assumedName(impPath)
+		}
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+
+		if usedBefore[name] && !usedAfter[name] {
+			if imp.Name != nil {
+				astutil.DeleteNamedImport(fset, file, imp.Name.Name, impPath)
+			} else {
+				astutil.DeleteImport(fset, file, impPath)
+			}
+		}
+	}
+}
+
+// assumedName returns the package name assumed by the go tools for imports
+// that are not resolved, e.g. yaml for gopkg.in/yaml.v2 or chi for
+// github.com/go-chi/chi/v5
+func assumedName(impPath string) string {
+	base := path.Base(impPath)
+	if majorVersion.MatchString(base) && path.Dir(impPath) != "." {
+		base = path.Base(path.Dir(impPath))
+	}
+
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexAny(base, ".-"); i >= 0 {
+		base = base[:i]
+	}
+
+	return base
+}
+
+// selectorNames returns all identifiers used as a qualifier in the file,
+// e.g. `fmt` for `fmt.Println`
+func selectorNames(file *ast.File) map[string]bool {
+	names := map[string]bool{}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				names[ident.Name] = true
+			}
+		}
+
+		return true
+	})
+
+	return names
+}
@@ -0,0 +1,170 @@
+package plugins
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type RewriteSuite struct {
+	suite.Suite
+}
+
+type RewriteCandidate struct {
+	name        string
+	src         string
+	importNames map[string]string
+
+	contains    []string
+	notContains []string
+	err         bool
+}
+
+func (s *RewriteSuite) TestRewritePackage() {
+	candidates := []RewriteCandidate{
+		{
+			name: "Rewrite a plain package clause",
+			src:  "package user\n\ntype User struct{}\n",
+
+			contains:    []string{"package main\n"},
+			notContains: []string{"package user"},
+		},
+		{
+			name: "Rewrite package clause after comments and build constraints",
+			src:  "// +build !windows\n\n// Package user contains models\npackage user\n",
+
+			contains: []string{"// +build !windows\n", "// Package user contains models\npackage main\n"},
+		},
+		{
+			name: "Rewrite package clause with an import comment",
+			src:  "package user // import \"example.com/user\"\n",
+
+			contains: []string{"package main // import \"example.com/user\"\n"},
+		},
+		{
+			name: "Keep package clauses within raw string literals",
+			src:  "package user\n\nconst tmpl = `\npackage user\n`\n",
+
+			contains: []string{"package main\n", "`\npackage user\n`"},
+		},
+		{
+			name: "Strip main and init functions together with their imports",
+			src: `package user
+
+import (
+	"fmt"
+	"log"
+)
+
+// init registers the user
+func init() {
+	log.Println("registered")
+}
+
+func main() {}
+
+type User struct{}
+
+func (u *User) init() {
+	fmt.Println("kept")
+}
+`,
+
+			contains:    []string{"package main\n", "\"fmt\"", "func (u *User) init()"},
+			notContains: []string{"\"log\"", "registered", "func main()", "func init()"},
+		},
+		{
+			name: "Strip imports whose package names differ from their paths",
+			src: `package user
+
+import (
+	"example.com/mirror/v2"
+	"example.com/weird"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	yaml.Marshal(nil)
+	mirror.Run()
+	other.Do()
+}
+
+type User struct{}
+`,
+			importNames: map[string]string{"example.com/weird": "other"},
+
+			contains:    []string{"package main\n", "type User struct{}"},
+			notContains: []string{"import", "yaml", "mirror", "weird"},
+		},
+		{
+			name: "Keep imports resolved to names used outside of main funcs",
+			src: `package user
+
+import (
+	"example.com/weird"
+	"fmt"
+)
+
+func main() {
+	fmt.Println("stripped")
+}
+
+var x = other.Do
+`,
+			importNames: map[string]string{"example.com/weird": "other"},
+
+			contains:    []string{"\"example.com/weird\"", "other.Do"},
+			notContains: []string{"\"fmt\"", "stripped"},
+		},
+		{
+			name: "Get error for unparsable files",
+			src:  "user struct {}",
+			err:  true,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		bb, err := RewritePackage("model.go", []byte(c.src), "main", c.importNames)
+		if c.err {
+			s.Error(err)
+			continue
+		}
+		s.NoError(err)
+
+		for _, str := range c.contains {
+			s.Contains(string(bb), str)
+		}
+		for _, str := range c.notContains {
+			s.False(strings.Contains(string(bb), str), "%s should not contain %s", bb, str)
+		}
+	}
+}
+
+func (s *RewriteSuite) TestAssumedName() {
+	for impPath, expected := range map[string]string{
+		"fmt":                         "fmt",
+		"net/http":                    "http",
+		"gopkg.in/yaml.v2":            "yaml",
+		"github.com/go-chi/chi/v5":    "chi",
+		"github.com/mattn/go-sqlite3": "sqlite3",
+	} {
+		s.EqualValues(expected, assumedName(impPath))
+	}
+}
+
+func (s *RewriteSuite) TestImportNames() {
+	pkg, err := FindPackage("./fixtures/userimports")
+	s.NoError(err)
+
+	names, err := (&BuildConfig{}).ImportNames(pkg)
+	s.NoError(err)
+	s.EqualValues("base", names["github.com/petomalina/mirror/pkg/plugins/fixtures/internal/base"])
+	s.EqualValues("time", names["time"])
+}
+
+func TestRewriteSuite(t *testing.T) {
+	suite.Run(t, &RewriteSuite{})
+}
@@ -0,0 +1,176 @@
+package plugins
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/packages"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownModel        = errors.New("Model is not declared in the package")
+	ErrUnsupportedModel    = errors.New("Model can't be instantiated by a symbol")
+	ErrSymbolNameCollision = errors.New("Can't find a free name for the symbol")
+)
+
+// SymbolPrefix is reserved for symbols generated by mirror, e.g. the symbol
+// generated for the User model is named XMirror_User
+const SymbolPrefix = "XMirror_"
+
+// SymbolsFile is the name of the file the symbols are generated into
+const SymbolsFile = "mirror_symbols.go"
+
+// declarations holds top-level declarations of a package
+type declarations struct {
+	// names of all declared types, variables and constants
+	names map[string]bool
+
+	// types declared in the package
+	types map[string]*ast.TypeSpec
+
+	// names of variables declared in the package
+	vars map[string]bool
+}
+
+// parseDeclarations parses all go files of the package and collects
+// their top-level declarations
+func parseDeclarations(pkg *packages.Package) (*declarations, error) {
+	decls := &declarations{
+		names: map[string]bool{},
+		types: map[string]*ast.TypeSpec{},
+		vars:  map[string]bool{},
+	}
+
+	fset := token.NewFileSet()
+	for _, f := range pkg.GoFiles {
+		file, err := parser.ParseFile(fset, f, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					decls.names[spec.Name.Name] = true
+					decls.types[spec.Name.Name] = spec
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						decls.names[name.Name] = true
+						if genDecl.Tok == token.VAR {
+							decls.vars[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return decls, nil
+}
+
+// DeclaredNames returns names of all top-level types, variables and constants
+// declared within the given package
+func DeclaredNames(pkg *packages.Package) (map[string]bool, error) {
+	decls, err := parseDeclarations(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	return decls.names, nil
+}
+
+// ResolveModelSymbols returns a mapping from model names to names of the
+// symbols generated for them. Symbols use the SymbolPrefix and never collide
+// with identifiers already declared in the package. Models that are not
+// declared in the package or can't be instantiated result in an error
+func ResolveModelSymbols(pkg *packages.Package, modelNames []string) (map[string]string, error) {
+	decls, err := parseDeclarations(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := []string{}
+	symbols := map[string]string{}
+	for _, model := range modelNames {
+		spec, ok := decls.types[model]
+		if !ok {
+			unknown = append(unknown, model)
+			continue
+		}
+
+		if spec.TypeParams != nil && len(spec.TypeParams.List) != 0 {
+			return nil, errors.Wrapf(ErrUnsupportedModel, "%s is a generic type", model)
+		}
+
+		symbol := SymbolPrefix + model
+		for i := 1; decls.names[symbol]; i++ {
+			if i > 100 {
+				return nil, errors.Wrap(ErrSymbolNameCollision, model)
+			}
+			symbol = fmt.Sprintf("%s%s_%d", SymbolPrefix, model, i)
+		}
+
+		decls.names[symbol] = true
+		symbols[model] = symbol
+	}
+
+	if len(unknown) != 0 {
+		available := []string{}
+		for name := range decls.types {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+
+		return nil, errors.Wrapf(
+			ErrUnknownModel,
+			"%s not found in %s, available types: %s",
+			strings.Join(unknown, ", "),
+			pkg.PkgPath,
+			strings.Join(available, ", "),
+		)
+	}
+
+	return symbols, nil
+}
+
+// GenerateSymbolsForModels generates a symbol for each model, writing them
+// into a new file in the workspace. Each symbol holds a pointer to the zero
+// value of its model, e.g. `XMirror_User = new(User)`. The mapping from
+// model names to the generated symbol names is returned
+func GenerateSymbolsForModels(modelNames []string, ws *Workspace) (map[string]string, error) {
+	symbols, err := ResolveModelSymbols(ws.Package, modelNames)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("// DO NOT EDIT: THIS BLOCK IS AUTOGENERATED BY MIRROR BUNDLE\npackage main\n\nvar (\n")
+	for _, model := range modelNames {
+		fmt.Fprintf(buf, "\t%s = new(%s)\n", symbols[model], model)
+	}
+	buf.WriteString(")\n")
+
+	// don't overwrite any file copied from the package
+	name := SymbolsFile
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(ws.Dir, name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s_%d.go", strings.TrimSuffix(SymbolsFile, ".go"), i)
+	}
+
+	return symbols, ws.WriteFile(name, buf.Bytes())
+}
@@ -0,0 +1,106 @@
+package plugins
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type SymbolsSuite struct {
+	suite.Suite
+}
+
+type SymbolsCandidate struct {
+	name   string
+	pkg    *packages.Package
+	models []string
+
+	symbols map[string]string
+	err     error
+	errMsg  string
+}
+
+func (s *SymbolsSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(TestCacheDir))
+}
+
+// packageFromSource creates a package with a single file of the given source
+func (s *SymbolsSuite) packageFromSource(src string) *packages.Package {
+	s.NoError(os.MkdirAll(TestCacheDir, os.ModePerm))
+
+	f := filepath.Join(TestCacheDir, "model.go")
+	s.NoError(ioutil.WriteFile(f, []byte(src), os.ModePerm))
+
+	return &packages.Package{
+		PkgPath: "example.com/model",
+		GoFiles: []string{f},
+	}
+}
+
+func (s *SymbolsSuite) findPackage(path string) *packages.Package {
+	pkg, err := FindPackage(path)
+	s.NoError(err)
+
+	return pkg
+}
+
+func (s *SymbolsSuite) TestResolveModelSymbols() {
+	candidates := []SymbolsCandidate{
+		{
+			name:   "Resolve symbols for structs, named basic types and interfaces",
+			pkg:    s.findPackage("./fixtures/usernosymbol"),
+			models: []string{"User", "Email", "Notifier"},
+			symbols: map[string]string{
+				"User":     "XMirror_User",
+				"Email":    "XMirror_Email",
+				"Notifier": "XMirror_Notifier",
+			},
+		},
+		{
+			name:   "Resolve symbols colliding with existing declarations",
+			pkg:    s.findPackage("./fixtures/usercollision"),
+			models: []string{"User"},
+			symbols: map[string]string{
+				"User": "XMirror_User_1",
+			},
+		},
+		{
+			name:   "Get error listing available types for unknown models",
+			pkg:    s.findPackage("./fixtures/usernosymbol"),
+			models: []string{"User", "Admin"},
+			err:    ErrUnknownModel,
+			errMsg: "Admin not found in github.com/petomalina/mirror/pkg/plugins/fixtures/usernosymbol, available types: Email, Notifier, User",
+		},
+		{
+			name:   "Get error for generic types",
+			pkg:    s.packageFromSource("package model\n\ntype Pair[T any] struct {\n\tA, B T\n}\n"),
+			models: []string{"Pair"},
+			err:    ErrUnsupportedModel,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		models := append([]string{}, c.models...)
+		symbols, err := ResolveModelSymbols(c.pkg, models)
+
+		s.EqualValues(c.err, errors.Cause(err))
+		s.EqualValues(c.symbols, symbols)
+		if c.errMsg != "" {
+			s.Contains(err.Error(), c.errMsg)
+		}
+
+		// the models are never changed
+		s.EqualValues(c.models, models)
+	}
+}
+
+func TestSymbolsSuite(t *testing.T) {
+	suite.Run(t, &SymbolsSuite{})
+}
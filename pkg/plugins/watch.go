@@ -0,0 +1,636 @@
+package plugins
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+var (
+	ErrWatcherFailed = errors.New("The file watcher failed")
+)
+
+var (
+	// DefaultWatchIgnore ignores version control files and everything but
+	// go sources and module files. Patterns prefixed with ! list the only
+	// files that are watched, all other patterns list ignored files and
+	// directories. Patterns without a leading slash match the trailing
+	// components of paths, e.g. .git matches every .git directory
+	DefaultWatchIgnore = []string{".git", "!*.go", "!go.mod", "!go.sum"}
+
+	// DefaultWatchDebounce is the quiet period after the last change
+	// before the watch starts a build
+	DefaultWatchDebounce = 300 * time.Millisecond
+
+	// DefaultWatchMaxWait is the longest the watch holds back a build
+	// while changes keep coming
+	DefaultWatchMaxWait = 3 * time.Second
+
+	// DefaultWatchOps are the file operations that trigger a rebuild by default,
+	// chmod is left out as it doesn't change the sources
+	DefaultWatchOps = fsnotify.Create | fsnotify.Write | fsnotify.Remove | fsnotify.Rename
+)
+
+// IgnoredFiles are files ignored by the Watch in addition to the ignore
+// patterns, e.g. the generated files. They can be replaced while watching
+type IgnoredFiles struct {
+	mu    sync.RWMutex
+	files map[string]bool
+}
+
+// Set replaces the ignored files by the paths
+func (f *IgnoredFiles) Set(paths []string) error {
+	files := map[string]bool{}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		files[abs] = true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.files = files
+	return nil
+}
+
+// Contains returns true if the absolute path is ignored
+func (f *IgnoredFiles) Contains(path string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.files[path]
+}
+
+// WatchBatch holds the symbols loaded after a change together with the
+// files that triggered the rebuild
+type WatchBatch struct {
+	Packages []*PackageSymbols
+
+	// ChangedFiles are sorted absolute paths of the changed files
+	ChangedFiles []string
+
+	// Duration is the time it took to load the packages
+	Duration time.Duration
+}
+
+// WatchError is a recoverable error of a single rebuild within the Watch,
+// the Watch keeps running and rebuilds on the next change
+type WatchError struct {
+	Err error
+
+	// ChangedFiles are sorted absolute paths of the changed files
+	ChangedFiles []string
+
+	// Duration is the time it took until the rebuild failed
+	Duration time.Duration
+}
+
+func (e *WatchError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the underlying error, so errors.Cause can be used on WatchError
+func (e *WatchError) Cause() error {
+	return e.Err
+}
+
+// Watch watches for changes in the matched packages and their local
+// dependencies, including their subdirectories, and emits new symbols on changes.
+// Failed rebuilds are emitted as *WatchError, all other errors are fatal and
+// wrap the ErrWatcherFailed. The watch stops when the done is signaled or
+// closed, or after a failed start. Both channels are closed once it stops
+func (l *Loader) Watch(symbolNames []string, done <-chan bool) (<-chan *WatchBatch, <-chan error) {
+	out := make(chan *WatchBatch)
+	// the buffer lets the watch report a failure without waiting for the caller
+	errOut := make(chan error, 1)
+
+	// fail closes the channels after reporting the error, so the caller
+	// doesn't have to signal the done
+	fail := func(err error) (<-chan *WatchBatch, <-chan error) {
+		errOut <- errors.Wrap(ErrWatcherFailed, err.Error())
+		close(out)
+		close(errOut)
+		return out, errOut
+	}
+
+	// initialize the watcher with the plugin path
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fail(err)
+	}
+
+	filter, err := l.watchFilter()
+	if err != nil {
+		watcher.Close()
+		return fail(err)
+	}
+
+	dirs := &dirWatcher{
+		watcher: watcher,
+		filter:  filter,
+		dirs:    map[string]bool{},
+	}
+
+	// watch directories of all packages matched by the target path
+	err = l.watchPackages(dirs)
+	if err != nil {
+		watcher.Close()
+		return fail(err)
+	}
+
+	ops := l.WatchOps
+	if ops == 0 {
+		ops = DefaultWatchOps
+	}
+
+	go func(watcher *fsnotify.Watcher, symbolNames []string, out chan *WatchBatch, done <-chan bool, errs chan error) {
+		stop := make(chan bool)
+		finished := make(chan bool)
+		defer func() {
+			// the scheduler must stop sending before the channels are closed
+			<-finished
+			close(out)
+			close(errs)
+		}()
+
+		scheduler := &watchScheduler{
+			Debounce: l.WatchDebounce,
+			MaxWait:  l.WatchMaxWait,
+			Build: func(ctx context.Context, changed []string) {
+				L.Method("Loader", "Watch").Debugln("Rebuilding after changes in: ", changed)
+				started := time.Now()
+				syms, err := l.LoadPackagesContext(ctx, symbolNames)
+
+				// outdated builds are dropped, the scheduler builds again with the newer changes
+				if ctx.Err() != nil {
+					return
+				}
+
+				// new imports may have brought new local dependencies
+				if err == nil {
+					err = l.watchPackages(dirs)
+				}
+
+				if err != nil {
+					select {
+					case errs <- &WatchError{Err: err, ChangedFiles: changed, Duration: time.Since(started)}:
+					case <-stop:
+					}
+					return
+				}
+
+				// distribute the symbols loaded from the plugin
+				select {
+				case out <- &WatchBatch{Packages: syms, ChangedFiles: changed, Duration: time.Since(started)}:
+				case <-stop:
+				}
+			},
+		}
+
+		go func() {
+			scheduler.Run(dirs.Changes(ops, stop), stop)
+			close(finished)
+		}()
+
+	eventLoop:
+		for {
+			select {
+			// errors of the watcher are proxied to the caller, they can
+			// then use `done` channel to stop the execution
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					break eventLoop
+				}
+				if err != nil {
+					select {
+					case errs <- errors.Wrap(ErrWatcherFailed, err.Error()):
+					case <-done:
+						close(stop)
+						watcher.Close()
+						break eventLoop
+					}
+				}
+
+			case <-done:
+				close(stop)
+				err = watcher.Close()
+				if err != nil {
+					// the caller may not be listening anymore
+					select {
+					case errs <- errors.Wrap(ErrWatcherFailed, err.Error()):
+					default:
+					}
+				}
+				break eventLoop
+
+			}
+		}
+	}(watcher, symbolNames, out, done, errOut)
+
+	return out, errOut
+}
+
+// watchFilter creates the filter from the ignore patterns of the loader
+func (l *Loader) watchFilter() (*watchFilter, error) {
+	patterns := l.WatchIgnore
+	if patterns == nil {
+		patterns = DefaultWatchIgnore
+	}
+
+	cacheDir, err := filepath.Abs(l.cacheDir())
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := newWatchFilter(append([]string{cacheDir}, patterns...))
+	if err != nil {
+		return nil, err
+	}
+	filter.files = l.WatchIgnoreFiles
+
+	return filter, nil
+}
+
+// watchPackages adds directories of the matched packages and their local
+// dependencies to the watcher
+func (l *Loader) watchPackages(dirs *dirWatcher) error {
+	pkgs, err := l.FindPackages(l.TargetPath)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		err = dirs.Add(PackageDir(pkg))
+		if err != nil {
+			return err
+		}
+
+		deps, err := l.LocalDeps(pkg)
+		if err != nil {
+			return err
+		}
+
+		for _, dep := range deps {
+			err = dirs.Add(dep.Dir)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// dirWatcher adds directories to the watcher recursively, skipping the
+// ignored ones, and keeps track of the watched directories
+type dirWatcher struct {
+	watcher *fsnotify.Watcher
+	filter  *watchFilter
+
+	mu   sync.Mutex
+	dirs map[string]bool
+}
+
+// Add watches the directory and all its subdirectories which are not ignored
+func (w *dirWatcher) Add(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if w.filter.Ignored(path, true) {
+			return filepath.SkipDir
+		}
+
+		if w.dirs[path] {
+			return nil
+		}
+
+		L.Method("Internal/watch", "Add").Trace("Watching directory: ", path)
+		w.dirs[path] = true
+		return w.watcher.Add(path)
+	})
+}
+
+// isDir returns true if the path is a directory or was a watched directory
+func (w *dirWatcher) isDir(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.dirs[path] {
+		return true
+	}
+
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// forget removes the directory and its subdirectories from the watched ones
+func (w *dirWatcher) forget(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for d := range w.dirs {
+		if isWithin(d, dir) {
+			delete(w.dirs, d)
+		}
+	}
+}
+
+// Changes returns events of the given operations on files that are not
+// ignored. New directories are watched as they are created. The changes
+// are closed once the stop is signaled or the events of the watcher end
+func (w *dirWatcher) Changes(ops fsnotify.Op, stop <-chan bool) <-chan fsnotify.Event {
+	out := make(chan fsnotify.Event)
+
+	go func() {
+		defer close(out)
+
+		for ev := range w.watcher.Events {
+			isDir := w.isDir(ev.Name)
+			if w.filter.Ignored(ev.Name, isDir) {
+				continue
+			}
+
+			if isDir && ev.Op&fsnotify.Create != 0 {
+				err := w.Add(ev.Name)
+				if err != nil {
+					L.Method("Internal/watch", "Changes").Warnln("Failed to watch a new directory: ", err.Error())
+				}
+			}
+
+			// removed directories are no longer watched, so they are watched again when recreated
+			if isDir && ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				w.forget(ev.Name)
+			}
+
+			if ev.Op&ops == 0 {
+				continue
+			}
+
+			// nobody reads the changes once the watch stops
+			select {
+			case out <- ev:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// watchFilter decides which paths are ignored by the Watch
+type watchFilter struct {
+	// ignore are patterns of ignored files and directories
+	ignore []string
+
+	// only are patterns of the only files that are not ignored
+	only []string
+
+	// files are ignored files in addition to the patterns, if set
+	files *IgnoredFiles
+}
+
+// newWatchFilter creates a filter from the patterns, see DefaultWatchIgnore
+func newWatchFilter(patterns []string) (*watchFilter, error) {
+	f := &watchFilter{}
+
+	for _, p := range patterns {
+		only := strings.HasPrefix(p, "!")
+		p = filepath.Clean(strings.TrimPrefix(p, "!"))
+
+		// validate the pattern beforehand, as matching errors are dropped later
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, err
+		}
+
+		if only {
+			f.only = append(f.only, p)
+		} else {
+			f.ignore = append(f.ignore, p)
+		}
+	}
+
+	return f, nil
+}
+
+// Ignored returns true if the path or any of its parents is ignored
+func (f *watchFilter) Ignored(path string, isDir bool) bool {
+	if !isDir && len(f.only) > 0 && !matchAnyPattern(f.only, path) {
+		return true
+	}
+
+	if !isDir && f.files != nil && f.files.Contains(path) {
+		return true
+	}
+
+	for p := path; ; p = filepath.Dir(p) {
+		if matchAnyPattern(f.ignore, p) {
+			return true
+		}
+
+		if filepath.Dir(p) == p {
+			return false
+		}
+	}
+}
+
+// matchAnyPattern returns true if the path matches any of the patterns.
+// Absolute patterns are matched against the whole path, relative patterns
+// against the same number of trailing path components
+func matchAnyPattern(patterns []string, path string) bool {
+	parts := strings.Split(path, string(filepath.Separator))
+
+	for _, p := range patterns {
+		name := path
+		if !filepath.IsAbs(p) {
+			n := len(strings.Split(p, string(filepath.Separator)))
+			if n > len(parts) {
+				continue
+			}
+
+			name = strings.Join(parts[len(parts)-n:], string(filepath.Separator))
+		}
+
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchScheduler coalesces file changes into builds. A build is started
+// once no changes arrive for the Debounce period, or after MaxWait since the
+// first pending change. Changes arriving during a build cancel it as outdated
+// and are built together with its changes by exactly one follow-up build
+type watchScheduler struct {
+	// Debounce is the quiet period before a build, DefaultWatchDebounce if not set
+	Debounce time.Duration
+
+	// MaxWait limits how long changes can be held back by new ones,
+	// DefaultWatchMaxWait if not set
+	MaxWait time.Duration
+
+	// Build runs the build for the changed files, the context is cancelled
+	// once the build is outdated
+	Build func(ctx context.Context, changed []string)
+}
+
+// Run schedules builds for the changes until the changes are closed
+// or the stop is signaled, the running build is cancelled at the end
+func (s *watchScheduler) Run(changes <-chan fsnotify.Event, stop <-chan bool) {
+	debounce := s.Debounce
+	if debounce == 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	maxWait := s.MaxWait
+	if maxWait == 0 {
+		maxWait = DefaultWatchMaxWait
+	}
+
+	pending := map[string]bool{}
+	var quiet, deadline <-chan time.Time
+
+	// ready is set when pending changes wait only for the running build
+	ready := false
+
+	var building []string
+	var cancel context.CancelFunc
+	var started time.Time
+	finished := make(chan bool, 1)
+	stats := &buildStats{}
+
+	start := func() {
+		building = []string{}
+		for name := range pending {
+			building = append(building, name)
+		}
+		sort.Strings(building)
+
+		pending = map[string]bool{}
+		quiet, deadline, ready = nil, nil, false
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		started = time.Now()
+
+		go func(ctx context.Context, changed []string) {
+			s.Build(ctx, changed)
+			finished <- ctx.Err() == nil
+		}(ctx, building)
+	}
+
+	// flush starts the build of pending changes unless a build is running
+	flush := func() {
+		if cancel != nil {
+			quiet, deadline, ready = nil, nil, true
+			return
+		}
+		start()
+	}
+
+	defer func() {
+		if cancel != nil {
+			cancel()
+			<-finished
+		}
+	}()
+
+	for {
+		select {
+		case ev, ok := <-changes:
+			if !ok {
+				return
+			}
+
+			pending[ev.Name] = true
+			quiet = time.After(debounce)
+			if deadline == nil {
+				deadline = time.After(maxWait)
+			}
+
+			// the running build doesn't contain this change anymore
+			if cancel != nil {
+				cancel()
+			}
+
+		case <-quiet:
+			flush()
+
+		case <-deadline:
+			flush()
+
+		case completed := <-finished:
+			stats.Add(time.Since(started), completed)
+			cancel = nil
+
+			if !completed {
+				// changes of the cancelled build are built by the follow-up build
+				for _, name := range building {
+					pending[name] = true
+				}
+			}
+
+			if ready {
+				start()
+			}
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+// buildStats collects durations of the builds run by the watch
+type buildStats struct {
+	builds    int
+	cancelled int
+	total     time.Duration
+}
+
+// Add records the build and reports the durations through the logger
+func (s *buildStats) Add(d time.Duration, completed bool) {
+	if !completed {
+		s.cancelled++
+		L.Method("Internal/watch", "Build").WithFields(Fields{
+			"Duration":  d,
+			"Cancelled": s.cancelled,
+		}).Debugln("Outdated build cancelled")
+		return
+	}
+
+	s.builds++
+	s.total += d
+	L.Method("Internal/watch", "Build").WithFields(Fields{
+		"Duration":  d,
+		"Builds":    s.builds,
+		"Cancelled": s.cancelled,
+		"Average":   s.total / time.Duration(s.builds),
+	}).Infoln("Build finished")
+}
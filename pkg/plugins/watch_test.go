@@ -0,0 +1,258 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type WatchFilterSuite struct {
+	suite.Suite
+}
+
+type WatchFilterCandidate struct {
+	name     string
+	patterns []string
+	path     string
+	isDir    bool
+
+	ignored bool
+}
+
+func (s *WatchFilterSuite) TestIgnored() {
+	candidates := []WatchFilterCandidate{
+		{
+			name:     "Watch go files by default",
+			patterns: DefaultWatchIgnore,
+			path:     "/src/models/model.go",
+		},
+		{
+			name:     "Watch module files by default",
+			patterns: DefaultWatchIgnore,
+			path:     "/src/go.mod",
+		},
+		{
+			name:     "Ignore non-go files by default",
+			patterns: DefaultWatchIgnore,
+			path:     "/src/models/notes.txt",
+			ignored:  true,
+		},
+		{
+			name:     "Watch directories regardless of the watched files",
+			patterns: DefaultWatchIgnore,
+			path:     "/src/models",
+			isDir:    true,
+		},
+		{
+			name:     "Ignore .git directories by default",
+			patterns: DefaultWatchIgnore,
+			path:     "/src/.git",
+			isDir:    true,
+			ignored:  true,
+		},
+		{
+			name:     "Ignore files within ignored directories",
+			patterns: []string{"/src/.mirror"},
+			path:     "/src/.mirror/123/model.go",
+			ignored:  true,
+		},
+		{
+			name:     "Don't ignore directories with the same prefix",
+			patterns: []string{"/src/.mirror"},
+			path:     "/src/.mirror-other/model.go",
+		},
+		{
+			name:     "Ignore relative directories within any package",
+			patterns: []string{"gen/models"},
+			path:     "/src/users/gen/models/users.go",
+			ignored:  true,
+		},
+		{
+			name:     "Don't ignore partial matches of relative directories",
+			patterns: []string{"gen/models"},
+			path:     "/src/users/models/users.go",
+		},
+		{
+			name:     "Ignore files by glob",
+			patterns: []string{"*_gen.go"},
+			path:     "/src/users/users_gen.go",
+			ignored:  true,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		f, err := newWatchFilter(c.patterns)
+		s.NoError(err)
+		s.EqualValues(c.ignored, f.Ignored(c.path, c.isDir))
+	}
+}
+
+func (s *WatchFilterSuite) TestIgnoredFiles() {
+	f, err := newWatchFilter(DefaultWatchIgnore)
+	s.NoError(err)
+	f.files = &IgnoredFiles{}
+
+	s.NoError(f.files.Set([]string{"/src/models/models_gen.go"}))
+	s.True(f.Ignored("/src/models/models_gen.go", false))
+
+	// models next to the generated files are still watched
+	s.False(f.Ignored("/src/models/model.go", false))
+	s.False(f.Ignored("/src/models", true))
+
+	// files are replaced by the next generation
+	s.NoError(f.files.Set([]string{"/src/models/other_gen.go"}))
+	s.False(f.Ignored("/src/models/models_gen.go", false))
+	s.True(f.Ignored("/src/models/other_gen.go", false))
+}
+
+func (s *WatchFilterSuite) TestInvalidPattern() {
+	_, err := newWatchFilter([]string{"[.go"})
+	s.Error(err)
+}
+
+func TestWatchFilterSuite(t *testing.T) {
+	suite.Run(t, &WatchFilterSuite{})
+}
+
+const WatchTestDir = ".testwatch"
+
+type DirWatcherSuite struct {
+	suite.Suite
+}
+
+func (s *DirWatcherSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(WatchTestDir))
+}
+
+func (s *DirWatcherSuite) TestChangesStop() {
+	s.NoError(os.MkdirAll(WatchTestDir, os.ModePerm))
+
+	watcher, err := fsnotify.NewWatcher()
+	s.NoError(err)
+	defer watcher.Close()
+
+	filter, err := newWatchFilter(DefaultWatchIgnore)
+	s.NoError(err)
+
+	dirs := &dirWatcher{watcher: watcher, filter: filter, dirs: map[string]bool{}}
+	s.NoError(dirs.Add(WatchTestDir))
+
+	stop := make(chan bool)
+	changes := dirs.Changes(DefaultWatchOps, stop)
+
+	// the change is pending while nobody reads the changes
+	s.NoError(ioutil.WriteFile(filepath.Join(WatchTestDir, "model.go"), []byte("package model\n"), 0644))
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+
+		case <-timeout:
+			s.Fail("The changes were not closed after the stop")
+			return
+		}
+	}
+}
+
+func TestDirWatcherSuite(t *testing.T) {
+	suite.Run(t, &DirWatcherSuite{})
+}
+
+type WatchSchedulerSuite struct {
+	suite.Suite
+}
+
+func (s *WatchSchedulerSuite) TestCoalesceDuringBuild() {
+	started := make(chan []string, 10)
+	completed := make(chan []string, 10)
+	running := int32(0)
+
+	scheduler := &watchScheduler{
+		Debounce: 20 * time.Millisecond,
+		MaxWait:  time.Second,
+		Build: func(ctx context.Context, changed []string) {
+			s.EqualValues(1, atomic.AddInt32(&running, 1), "builds must not overlap")
+			defer atomic.AddInt32(&running, -1)
+
+			started <- changed
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+				completed <- changed
+			}
+		},
+	}
+
+	changes := make(chan fsnotify.Event)
+	stop := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		scheduler.Run(changes, stop)
+		close(finished)
+	}()
+
+	changes <- fsnotify.Event{Name: "a.go"}
+	s.EqualValues([]string{"a.go"}, <-started)
+
+	// changes during the build cancel it and are built together with its changes
+	changes <- fsnotify.Event{Name: "b.go"}
+	changes <- fsnotify.Event{Name: "c.go"}
+	changes <- fsnotify.Event{Name: "b.go"}
+
+	s.EqualValues([]string{"a.go", "b.go", "c.go"}, <-started)
+	s.EqualValues([]string{"a.go", "b.go", "c.go"}, <-completed)
+
+	close(stop)
+	<-finished
+	s.Len(started, 0)
+	s.Len(completed, 0)
+}
+
+func (s *WatchSchedulerSuite) TestMaxWait() {
+	started := make(chan []string, 10)
+
+	scheduler := &watchScheduler{
+		Debounce: 100 * time.Millisecond,
+		MaxWait:  150 * time.Millisecond,
+		Build: func(ctx context.Context, changed []string) {
+			started <- changed
+		},
+	}
+
+	changes := make(chan fsnotify.Event)
+	stop := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		scheduler.Run(changes, stop)
+		close(finished)
+	}()
+
+	// changes keep coming faster than the debounce, so only the max wait triggers builds
+	for i := 0; i < 20; i++ {
+		changes <- fsnotify.Event{Name: "a.go"}
+		time.Sleep(20 * time.Millisecond)
+	}
+	s.NotEqual(0, len(started))
+
+	close(stop)
+	<-finished
+}
+
+func TestWatchSchedulerSuite(t *testing.T) {
+	suite.Run(t, &WatchSchedulerSuite{})
+}
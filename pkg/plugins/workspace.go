@@ -0,0 +1,204 @@
+package plugins
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror/pkg/cp"
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+var (
+	ErrWorkspaceOutsideCache = errors.New("Workspace is not located within the cache directory")
+)
+
+const DefaultCache = ".mirror"
+
+// Workspace is an isolated copy of a package located in the cache directory.
+// It owns creation, mutation and cleanup of the copy, and every mutation
+// is checked to happen within the cache, so the original sources are never
+// touched by the plugin pipeline
+type Workspace struct {
+	// Dir is the absolute path to the copy of the package
+	Dir string
+
+	// CacheDir is the absolute path to the cache directory the copy is located in
+	CacheDir string
+
+	// Package is the original package the workspace was copied from
+	Package *packages.Package
+
+	// ImportNames are the package names of the imports of the package by
+	// their paths, resolved by the build before changing the package
+	ImportNames map[string]string
+}
+
+// NewWorkspace copies the given package into a new subdirectory of the cache dir
+func NewWorkspace(pkg *packages.Package, cacheDir string) (*Workspace, error) {
+	ws, err := NewEmptyWorkspace(pkg, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	L.Method("Internal/workspace", "NewWorkspace").Trace("Copying ", pkg, "->", ws.Dir)
+	// other files (assembly, cgo sources) are needed when building the package as well
+	files := append(append([]string{}, pkg.GoFiles...), pkg.OtherFiles...)
+	for _, f := range files {
+		err := cp.File(f, filepath.Join(ws.Dir, filepath.Base(f)))
+		if err != nil {
+			return ws, err
+		}
+	}
+
+	return ws, nil
+}
+
+// NewEmptyWorkspace creates a new subdirectory of the cache dir for the given
+// package without copying it, e.g. for programs importing the package
+func NewEmptyWorkspace(pkg *packages.Package, cacheDir string) (*Workspace, error) {
+	absCacheDir, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &Workspace{
+		Dir:      filepath.Join(absCacheDir, fmt.Sprintf("%d", rand.Int())),
+		CacheDir: absCacheDir,
+		Package:  pkg,
+	}
+
+	// never copy into the package itself, e.g. when cache dir is set to the package dir
+	err = ws.verify()
+	if err != nil {
+		return nil, err
+	}
+
+	L.Method("Internal/workspace", "NewEmptyWorkspace").Trace("Making cache dir: ", ws.Dir)
+	return ws, os.MkdirAll(ws.Dir, os.ModePerm)
+}
+
+// ChangePackage changes the package clause of each go file within the
+// workspace, see RewritePackage for details. File modes are preserved
+func (w *Workspace) ChangePackage(desiredPkgName string) error {
+	L.Method("Internal/workspace", "ChangePackage").Trace("Invoked on workspace: ", w.Dir)
+	err := w.verify()
+	if err != nil {
+		return err
+	}
+
+	// the workspace may contain files of multiple packages at this point
+	// (e.g. generated symbols), so the files are listed directly
+	files, err := filepath.Glob(filepath.Join(w.Dir, "*.go"))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		// tests are not a part of the built package
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+
+		bb, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+
+		bb, err = RewritePackage(f, bb, desiredPkgName, w.ImportNames)
+		if err != nil {
+			return errors.Wrap(ErrPackageConversionFailed, err.Error())
+		}
+
+		err = ioutil.WriteFile(f, bb, info.Mode())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteFile writes a new file with the given name into the workspace
+func (w *Workspace) WriteFile(name string, data []byte) error {
+	err := w.verify()
+	if err != nil {
+		return err
+	}
+
+	if filepath.Base(name) != name {
+		return errors.Errorf("file %s must be written directly into the workspace", name)
+	}
+
+	return ioutil.WriteFile(filepath.Join(w.Dir, name), data, 0644)
+}
+
+// Cleanup removes the workspace with all its files
+func (w *Workspace) Cleanup() error {
+	err := w.verify()
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(w.Dir)
+}
+
+// verify checks that the workspace is located within the cache directory
+// and is not a directory of the original package
+func (w *Workspace) verify() error {
+	dir, err := evalSymlinks(w.Dir)
+	if err != nil {
+		return err
+	}
+
+	cacheDir, err := evalSymlinks(w.CacheDir)
+	if err != nil {
+		return err
+	}
+
+	if dir == cacheDir || !isWithin(dir, cacheDir) {
+		return errors.Wrap(ErrWorkspaceOutsideCache, w.Dir)
+	}
+
+	pkgDir, err := evalSymlinks(PackageDir(w.Package))
+	if err != nil {
+		return err
+	}
+
+	if dir == pkgDir {
+		return errors.Wrap(ErrWorkspaceOutsideCache, w.Dir)
+	}
+
+	return nil
+}
+
+// evalSymlinks returns the absolute path with symlinks resolved. Paths that
+// don't exist yet are resolved up to their closest existing parent
+func evalSymlinks(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		parent, err := evalSymlinks(filepath.Dir(path))
+		if err != nil || filepath.Dir(path) == path {
+			return path, err
+		}
+
+		return filepath.Join(parent, filepath.Base(path)), nil
+	}
+
+	return resolved, err
+}
@@ -0,0 +1,82 @@
+package plugins
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type WorkspaceSuite struct {
+	suite.Suite
+}
+
+func (s *WorkspaceSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(TestCacheDir))
+}
+
+func (s *WorkspaceSuite) TestLifecycle() {
+	pkg, err := FindPackage("./fixtures/user")
+	s.NoError(err)
+
+	ws, err := NewWorkspace(pkg, TestCacheDir)
+	s.NoError(err)
+
+	// the copy is made within the cache dir
+	absCacheDir, err := filepath.Abs(TestCacheDir)
+	s.NoError(err)
+	s.EqualValues(absCacheDir, filepath.Dir(ws.Dir))
+
+	s.NoError(os.Chmod(filepath.Join(ws.Dir, "model.go"), 0600))
+	s.NoError(ws.ChangePackage("main"))
+
+	// only the copy is changed and its mode is preserved
+	info, err := os.Stat(filepath.Join(ws.Dir, "model.go"))
+	s.NoError(err)
+	s.EqualValues(os.FileMode(0600), info.Mode())
+
+	bb, err := ioutil.ReadFile(filepath.Join(ws.Dir, "model.go"))
+	s.NoError(err)
+	s.Contains(string(bb), "package main")
+
+	bb, err = ioutil.ReadFile("./fixtures/user/model.go")
+	s.NoError(err)
+	s.Contains(string(bb), "package user")
+
+	s.NoError(ws.WriteFile("symbols.go", []byte("package main\n")))
+	s.Error(ws.WriteFile("../symbols.go", []byte("package main\n")))
+
+	s.NoError(ws.Cleanup())
+	_, err = os.Stat(ws.Dir)
+	s.True(os.IsNotExist(err))
+}
+
+func (s *WorkspaceSuite) TestOutsideCache() {
+	pkg, err := FindPackage("./fixtures/user")
+	s.NoError(err)
+
+	// workspace pointing to the original sources must never be changed
+	ws := &Workspace{
+		Dir:      PackageDir(pkg),
+		CacheDir: TestCacheDir,
+		Package:  pkg,
+	}
+
+	s.EqualValues(ErrWorkspaceOutsideCache, errors.Cause(ws.ChangePackage("main")))
+	s.EqualValues(ErrWorkspaceOutsideCache, errors.Cause(ws.WriteFile("symbols.go", []byte{})))
+	s.EqualValues(ErrWorkspaceOutsideCache, errors.Cause(ws.Cleanup()))
+
+	// even when the package itself is located within the cache dir
+	ws.CacheDir = filepath.Dir(PackageDir(pkg))
+	s.EqualValues(ErrWorkspaceOutsideCache, errors.Cause(ws.ChangePackage("main")))
+
+	bb, err := ioutil.ReadFile("./fixtures/user/model.go")
+	s.NoError(err)
+	s.Contains(string(bb), "package user")
+}
+
+func TestWorkspaceSuite(t *testing.T) {
+	suite.Run(t, &WorkspaceSuite{})
+}
@@ -1,10 +1,16 @@
 package mirror
 
 import (
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
 	"reflect"
 	"strings"
 )
 
+var (
+	ErrDescribedModel = errors.New("The model is only described by the isolated loader and has no runtime type, load it without --isolated")
+)
+
 // Struct is a wrapper for the runtime symbol Ref
 type Struct struct {
 	Ref interface{}
@@ -13,11 +19,25 @@ type Struct struct {
 	// if the package has changed due to movement of the Ref
 	// This is mainly used by the CreateDefaultApp when it's copying the package over to the cache
 	OriginalPackage string
+
+	// OriginalPackageName is the name of the OriginalPackage, which is main
+	// for the models loaded through plugins
+	OriginalPackageName string
+
+	// Description is set instead of the Ref for models loaded by the isolated
+	// loader, which only describes the models instead of loading them
+	Description *plugins.TypeDescription
 }
 
 // ReflectStruct creates a mirror Struct that enables users
 // to use mirror-enhanced reflections
 func ReflectStruct(s interface{}) *Struct {
+	if d, ok := s.(*plugins.TypeDescription); ok {
+		return &Struct{
+			Description: d,
+		}
+	}
+
 	return &Struct{
 		Ref:             s,
 		OriginalPackage: "",
@@ -28,6 +48,10 @@ func ReflectStruct(s interface{}) *Struct {
 // Note that this does not return pointer type asterixes nor
 // package names
 func (s *Struct) Name() string {
+	if s.Description != nil {
+		return s.Description.Name
+	}
+
 	name := reflect.TypeOf(s.Ref).Elem().String()
 
 	// strip the package prefix, as we don't want it explicitly in the name
@@ -45,6 +69,10 @@ func (s *Struct) PkgPath() string {
 		return s.OriginalPackage
 	}
 
+	if s.Description != nil {
+		return s.Description.PkgPath
+	}
+
 	return reflect.TypeOf(s.Ref).Elem().PkgPath()
 }
 
@@ -53,6 +81,14 @@ func (s *Struct) PkgPath() string {
 func (s *Struct) Fields() map[string]string {
 	ff := map[string]string{}
 
+	if s.Description != nil {
+		for _, f := range s.Description.Fields {
+			ff[f.Name] = f.Type
+		}
+
+		return ff
+	}
+
 	for _, f := range s.RawFields() {
 		ff[f.Field.Name] = f.Typ.String()
 	}
@@ -74,12 +110,23 @@ func (f *RawStructFieldType) Exported() bool {
 	return strings.Title(f.Field.Name) == f.Field.Name
 }
 
-// RawFields returns all fields of a given reflection type
+// RawFields returns all fields of a given reflection type. Described
+// structs have no runtime values, so no raw fields are returned for them,
+// see the StructSlice.RequireTypes
 func (s *Struct) RawFields() []RawStructFieldType {
 	rf := []RawStructFieldType{}
 
+	if s.Description != nil {
+		return rf
+	}
+
 	sValue := reflect.ValueOf(s.Ref).Elem()
 
+	// only structs have fields, other kinds of models are valid as well
+	if sValue.Kind() != reflect.Struct {
+		return rf
+	}
+
 	num := sValue.NumField()
 	for i := 0; i < num; i++ {
 		v := sValue.Field(i)
@@ -108,6 +155,19 @@ func ReflectStructs(ss ...interface{}) StructSlice {
 	return rss
 }
 
+// RequireTypes returns ErrDescribedModel for the first described model.
+// Bundles walking the fields of the models call it before generating,
+// so the described models fail the generation instead of having no fields
+func (s StructSlice) RequireTypes() error {
+	for _, st := range s {
+		if st.Type() == nil {
+			return errors.Wrap(ErrDescribedModel, st.Name())
+		}
+	}
+
+	return nil
+}
+
 // StructSliceEachFunc is a type for Each method above StructSlice
 type StructSliceEachFunc func(s *Struct)
 
@@ -121,6 +181,17 @@ func (s StructSlice) Each(cb StructSliceEachFunc) StructSlice {
 	return s
 }
 
+// GroupByPkgPath groups the structs by the import path of their package
+func (s StructSlice) GroupByPkgPath() map[string]StructSlice {
+	groups := map[string]StructSlice{}
+
+	for _, st := range s {
+		groups[st.PkgPath()] = append(groups[st.PkgPath()], st)
+	}
+
+	return groups
+}
+
 // PkgPath returns the import path for the current reflection
 func (s StructSlice) PkgPaths() []string {
 	paths := []string{}
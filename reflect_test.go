@@ -1,8 +1,12 @@
 package mirror
 
 import (
+	"fmt"
+	"github.com/petomalina/mirror/pkg/plugins"
 	userFixture "github.com/petomalina/mirror/pkg/plugins/fixtures/user"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
+	"sort"
 	"testing"
 	"time"
 )
@@ -70,6 +74,102 @@ func (s *StructSuite) TestRawFieldExported() {
 	s.False(fields[2].Exported())
 }
 
+func (s *StructSuite) TestReflectDescription() {
+	ref := ReflectStruct(&plugins.TypeDescription{
+		Name:    "User",
+		PkgPath: "github.com/petomalina/mirror/pkg/plugins/fixtures/user",
+		Kind:    "struct",
+		Fields: []plugins.FieldDescription{
+			{Name: "Email", Type: "string"},
+			{Name: "password", Type: "string"},
+		},
+	})
+
+	AssertReflectedStruct(
+		&s.Suite,
+		expectedReflection{
+			name: "User",
+			pkg:  "github.com/petomalina/mirror/pkg/plugins/fixtures/user",
+		},
+		ref,
+	)
+	s.EqualValues(map[string]string{"Email": "string", "password": "string"}, ref.Fields())
+	s.Empty(ref.RawFields())
+}
+
+func (s *StructSuite) TestRequireTypes() {
+	s.NoError(ReflectStructs(userFixture.XUser, &time.Time{}).RequireTypes())
+
+	err := ReflectStructs(userFixture.XUser, &plugins.TypeDescription{Name: "User", Kind: "struct"}).RequireTypes()
+	s.EqualValues(ErrDescribedModel, errors.Cause(err))
+}
+
+func (s *StructSuite) TestGroupByPkgPath() {
+	groups := ReflectStructs(userFixture.XUser, &time.Time{}, &time.Location{}).GroupByPkgPath()
+
+	s.Len(groups, 2)
+	s.Len(groups["github.com/petomalina/mirror/pkg/plugins/fixtures/user"], 1)
+	s.Len(groups["time"], 2)
+}
+
+type typeStringModel struct {
+	Email    Email
+	Emails   map[string][]*Email
+	At       time.Time
+	Location <-chan *time.Location
+	Name     string
+}
+
+type Email string
+
+type TypeStringCandidate struct {
+	name string
+	q    Qualifier
+
+	types []string
+
+	// imports of all fields, sorted
+	imports []string
+}
+
+func (s *StructSuite) TestTypeString() {
+	candidates := []TypeStringCandidate{
+		{
+			name:    "Don't qualify types generated into the model package",
+			q:       QualifyFor("example.com/user"),
+			types:   []string{"Email", "map[string][]*Email", "time.Time", "<-chan *time.Location", "string"},
+			imports: []string{"time", "time"},
+		},
+		{
+			name:    "Qualify types generated outside of the model package",
+			q:       QualifyFor("example.com/out"),
+			types:   []string{"user.Email", "map[string][]*user.Email", "time.Time", "<-chan *time.Location", "string"},
+			imports: []string{"example.com/user", "example.com/user", "time", "time"},
+		},
+	}
+
+	ref := ReflectStruct(&typeStringModel{})
+	ref.OriginalPackage = "example.com/user"
+	ref.OriginalPackageName = "user"
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		types, imports := []string{}, []string{}
+		for _, f := range ref.RawFields() {
+			types = append(types, ref.TypeString(f.Typ, c.q))
+			imports = append(imports, ref.TypeImports(f.Typ, c.q)...)
+		}
+		sort.Strings(imports)
+
+		s.EqualValues(c.types, types)
+		s.EqualValues(c.imports, imports)
+	}
+
+	s.EqualValues("user.typeStringModel", ref.QualifiedName(QualifyFor("example.com/out")))
+	s.EqualValues("typeStringModel", ref.QualifiedName(QualifyFor("example.com/user")))
+}
+
 func TestStructSuite(t *testing.T) {
 	suite.Run(t, &StructSuite{})
 }
@@ -0,0 +1,405 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	. "github.com/petomalina/mirror/pkg/logger"
+)
+
+var (
+	ErrServeAddr = errors.New("The control API can be served only on a loopback address or a unix socket")
+)
+
+// DefaultServeAddr is the address of the control API of the Server
+const DefaultServeAddr = "127.0.0.1:7381"
+
+const (
+	// BuildSucceeded is the status of a successful generation
+	BuildSucceeded = "succeeded"
+
+	// BuildFailed is the status of a generation that failed to load the models
+	// or to run the generator
+	BuildFailed = "failed"
+)
+
+// BuildEvent reports the outcome of a single generation of the Server
+type BuildEvent struct {
+	Status string `json:"status"`
+
+	// Trigger is what started the generation: startup, watch or api
+	Trigger string `json:"trigger"`
+
+	Error        string    `json:"error,omitempty"`
+	ChangedFiles []string  `json:"changedFiles,omitempty"`
+	Files        []string  `json:"files,omitempty"`
+	Duration     string    `json:"duration"`
+	Time         time.Time `json:"time"`
+}
+
+// ModelSchema describes a model loaded by the Server
+type ModelSchema struct {
+	Name    string            `json:"name"`
+	PkgPath string            `json:"pkgPath"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// Server keeps the models loaded by the watch of the Loader, regenerates on
+// changes and exposes a local control API for editors and tools:
+//
+//	POST /generate  reloads the models and regenerates, returns the BuildEvent
+//	GET  /schema    returns the ModelSchema of each loaded model
+//	GET  /files     returns the files created by the last successful generation
+//	GET  /status    returns the last BuildEvent
+//	GET  /events    streams BuildEvents as server-sent events
+type Server struct {
+	Loader      *plugins.Loader
+	Models      []string
+	RunFunc     RunFunc
+	Out         string
+	OutRelative bool
+
+	// mu guards the state of the last generation and the subscribers
+	mu          sync.Mutex
+	pkgSyms     []*plugins.PackageSymbols
+	files       []string
+	last        *BuildEvent
+	subscribers map[chan *BuildEvent]bool
+
+	// generating makes sure the generator never runs concurrently
+	generating sync.Mutex
+}
+
+// ListenAndServe generates once, then serves the control API on the address
+// and regenerates on changes until a signal is captured or the watch fails.
+// Addresses prefixed with unix: are served over a unix socket, tcp addresses
+// must be loopback ones, as the API writes to the disk without authentication
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan bool)
+	batches, errChan := s.Loader.Watch(s.Models, done)
+	defer close(done)
+
+	// the models are available right away, not only after the first change
+	s.Generate("startup")
+
+	srv := &http.Server{Handler: s.Handler()}
+	defer srv.Close()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	L.Method("Server", "ListenAndServe").Infoln("Serving the control API on ", addr)
+
+	for {
+		select {
+		case batch, ok := <-batches:
+			if !ok {
+				for err := range errChan {
+					if _, recoverable := err.(*plugins.WatchError); !recoverable {
+						return err
+					}
+				}
+				return nil
+			}
+
+			s.apply("watch", batch.ChangedFiles, batch.Packages, nil, time.Now().Add(-batch.Duration))
+
+		case err, ok := <-errChan:
+			if !ok {
+				return nil
+			}
+
+			watchErr, recoverable := err.(*plugins.WatchError)
+			if !recoverable {
+				L.Method("Server", "ListenAndServe").Errorln("The watcher failed: ", err.Error())
+				return err
+			}
+
+			s.apply("watch", watchErr.ChangedFiles, nil, watchErr, time.Now().Add(-watchErr.Duration))
+
+		case err := <-serveErr:
+			return err
+
+		case <-sigs:
+			L.Method("Server", "ListenAndServe").Infoln("Captured exit signal, stopping the server")
+			return nil
+		}
+	}
+}
+
+// Handler returns the handler of the control API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate", s.handleGenerate)
+	mux.HandleFunc("/schema", s.handleSchema)
+	mux.HandleFunc("/files", s.handleFiles)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/events", s.handleEvents)
+
+	return mux
+}
+
+// Generate reloads the models and runs the generator. Both are done within
+// the generating lock, so no other generation interleaves with the load
+func (s *Server) Generate(trigger string) *BuildEvent {
+	s.generating.Lock()
+	defer s.generating.Unlock()
+
+	started := time.Now()
+
+	pkgSyms, err := s.Loader.LoadPackages(s.Models)
+	return s.generate(trigger, nil, pkgSyms, err, started)
+}
+
+// apply runs the generator on the packages loaded by the watch
+func (s *Server) apply(trigger string, changed []string, pkgSyms []*plugins.PackageSymbols, err error, started time.Time) *BuildEvent {
+	s.generating.Lock()
+	defer s.generating.Unlock()
+
+	return s.generate(trigger, changed, pkgSyms, err, started)
+}
+
+// generate runs the generator on the loaded packages unless loading failed,
+// and publishes the outcome to the subscribers. The generating lock is held
+func (s *Server) generate(trigger string, changed []string, pkgSyms []*plugins.PackageSymbols, err error, started time.Time) *BuildEvent {
+	s.mu.Lock()
+	previous := s.files
+	s.mu.Unlock()
+
+	var files []string
+	if err == nil {
+		files, err = runPackages(s.RunFunc, pkgSyms, s.Out, s.OutRelative, previous)
+	}
+	if err == nil {
+		ignoreGenerated(s.Loader, files)
+	}
+
+	ev := &BuildEvent{
+		Status:       BuildSucceeded,
+		Trigger:      trigger,
+		ChangedFiles: changed,
+		Files:        files,
+		Duration:     time.Since(started).String(),
+		Time:         time.Now(),
+	}
+
+	entry := L.Method("Server", "generate").WithFields(Fields{
+		"Trigger":  trigger,
+		"Duration": ev.Duration,
+	})
+	if err != nil {
+		ev.Status = BuildFailed
+		ev.Error = err.Error()
+		entry.Errorln("Generation failed: ", err.Error())
+	} else {
+		entry.Infoln("Generation succeeded")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.pkgSyms = pkgSyms
+		s.files = files
+	}
+	s.last = ev
+
+	// slow subscribers miss events instead of blocking the generation
+	for sub := range s.subscribers {
+		select {
+		case sub <- ev:
+		default:
+		}
+	}
+
+	return ev
+}
+
+// Schema returns descriptions of the models loaded by the last successful generation
+func (s *Server) Schema() []*ModelSchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema := []*ModelSchema{}
+	for _, ps := range s.pkgSyms {
+		pkg := ps.Package
+		ReflectStructs(ps.Symbols...).Each(func(st *Struct) {
+			st.OriginalPackage = pkg.PkgPath
+
+			schema = append(schema, &ModelSchema{
+				Name:    st.Name(),
+				PkgPath: st.PkgPath(),
+				Fields:  st.Fields(),
+			})
+		})
+	}
+
+	return schema
+}
+
+// subscribe registers a new subscriber of the build events
+func (s *Server) subscribe() chan *BuildEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.subscribers == nil {
+		s.subscribers = map[chan *BuildEvent]bool{}
+	}
+
+	sub := make(chan *BuildEvent, 16)
+	s.subscribers[sub] = true
+
+	return sub
+}
+
+// unsubscribe removes the subscriber of the build events
+func (s *Server) unsubscribe(sub chan *BuildEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subscribers, sub)
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "generation must be triggered by POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ev := s.Generate("api")
+
+	status := http.StatusOK
+	if ev.Status == BuildFailed {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, ev)
+}
+
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Schema())
+}
+
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	files := append([]string{}, s.files...)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, files)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	last := s.last
+	s.mu.Unlock()
+
+	if last == nil {
+		http.Error(w, "nothing was generated yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, last)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := s.subscribe()
+	defer s.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// let the client know it's subscribed before any event is generated
+	fmt.Fprint(w, ": subscribed\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case ev := <-sub:
+			bb, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+
+			fmt.Fprintf(w, "event: build\ndata: %s\n\n", bb)
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeJSON writes the value as the JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		L.Method("Server", "writeJSON").Warnln("Failed to write the response: ", err.Error())
+	}
+}
+
+// listen listens on the loopback tcp address or on the unix socket for addresses
+// prefixed with unix:. Stale sockets of previous servers are removed and the
+// socket is accessible only by its owner
+func listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix:") {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, errors.Wrap(ErrServeAddr, err.Error())
+		}
+
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, errors.Wrap(ErrServeAddr, addr)
+		}
+
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, "unix:")
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		os.Remove(path)
+	} else {
+		conn.Close()
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
@@ -0,0 +1,218 @@
+package mirror
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/tools/go/packages"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const ServeTestDir = ".testserve"
+
+type ServerSuite struct {
+	suite.Suite
+
+	server *Server
+	http   *httptest.Server
+}
+
+type ListenCandidate struct {
+	name string
+	addr string
+
+	err error
+}
+
+// generateNames writes names of the models into the models.txt
+func generateNames(models StructSlice, out *Writer, _ *packages.Package) error {
+	f := out.File("models.txt")
+	for _, m := range models {
+		err := f.AddStringTemplate("// {{ . }}\n", m.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.Write()
+}
+
+func (s *ServerSuite) SetupTest() {
+	s.server = &Server{
+		Loader: &plugins.Loader{
+			TargetPath:       "./pkg/plugins/fixtures/usernosymbol",
+			GenerateSymbols:  true,
+			CacheDir:         filepath.Join(ServeTestDir, "cache"),
+			WatchIgnoreFiles: &plugins.IgnoredFiles{},
+		},
+		Models:  []string{"User"},
+		RunFunc: generateNames,
+		Out:     filepath.Join(ServeTestDir, "out"),
+	}
+	s.NoError(os.MkdirAll(s.server.Out, os.ModePerm))
+
+	s.http = httptest.NewServer(s.server.Handler())
+}
+
+func (s *ServerSuite) TearDownTest() {
+	s.http.Close()
+	s.NoError(os.RemoveAll(ServeTestDir))
+}
+
+// getJSON decodes the response of the GET request into the value
+func (s *ServerSuite) getJSON(path string, v interface{}) int {
+	res, err := http.Get(s.http.URL + path)
+	s.NoError(err)
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		s.NoError(json.NewDecoder(res.Body).Decode(v))
+	}
+
+	return res.StatusCode
+}
+
+func (s *ServerSuite) TestGenerate() {
+	// nothing is known before the first generation
+	s.EqualValues(http.StatusNotFound, s.getJSON("/status", &BuildEvent{}))
+
+	res, err := http.Post(s.http.URL+"/generate", "application/json", nil)
+	s.NoError(err)
+	defer res.Body.Close()
+	s.EqualValues(http.StatusOK, res.StatusCode)
+
+	ev := &BuildEvent{}
+	s.NoError(json.NewDecoder(res.Body).Decode(ev))
+	s.EqualValues(BuildSucceeded, ev.Status)
+	s.EqualValues("api", ev.Trigger)
+	s.EqualValues([]string{filepath.Join(s.server.Out, "models.txt")}, ev.Files)
+
+	schema := []*ModelSchema{}
+	s.EqualValues(http.StatusOK, s.getJSON("/schema", &schema))
+	s.Len(schema, 1)
+	s.EqualValues("User", schema[0].Name)
+	s.EqualValues("github.com/petomalina/mirror/pkg/plugins/fixtures/usernosymbol", schema[0].PkgPath)
+	s.Contains(schema[0].Fields, "Name")
+
+	files := []string{}
+	s.EqualValues(http.StatusOK, s.getJSON("/files", &files))
+	s.EqualValues(ev.Files, files)
+
+	// the generated files don't trigger the watch
+	generated, err := filepath.Abs(ev.Files[0])
+	s.NoError(err)
+	s.True(s.server.Loader.WatchIgnoreFiles.Contains(generated))
+
+	status := &BuildEvent{}
+	s.EqualValues(http.StatusOK, s.getJSON("/status", status))
+	s.EqualValues(BuildSucceeded, status.Status)
+}
+
+func (s *ServerSuite) TestGenerateFailure() {
+	s.server.Models = []string{"Unknown"}
+
+	res, err := http.Post(s.http.URL+"/generate", "application/json", nil)
+	s.NoError(err)
+	defer res.Body.Close()
+	s.EqualValues(http.StatusInternalServerError, res.StatusCode)
+
+	ev := &BuildEvent{}
+	s.NoError(json.NewDecoder(res.Body).Decode(ev))
+	s.EqualValues(BuildFailed, ev.Status)
+	s.NotEmpty(ev.Error)
+}
+
+func (s *ServerSuite) TestGenerateMethod() {
+	res, err := http.Get(s.http.URL + "/generate")
+	s.NoError(err)
+	res.Body.Close()
+	s.EqualValues(http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func (s *ServerSuite) TestEvents() {
+	res, err := http.Get(s.http.URL + "/events")
+	s.NoError(err)
+	defer res.Body.Close()
+	s.EqualValues("text/event-stream", res.Header.Get("Content-Type"))
+
+	// wait for the subscription before generating
+	events := bufio.NewReader(res.Body)
+	line, err := events.ReadString('\n')
+	s.NoError(err)
+	s.EqualValues(": subscribed\n", line)
+
+	s.server.Generate("api")
+
+	data := ""
+	for !strings.HasPrefix(data, "data: ") {
+		data, err = events.ReadString('\n')
+		s.NoError(err)
+	}
+
+	ev := &BuildEvent{}
+	s.NoError(json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), ev))
+	s.EqualValues(BuildSucceeded, ev.Status)
+}
+
+func (s *ServerSuite) TestListen() {
+	candidates := []ListenCandidate{
+		{
+			name: "Listen on the loopback address",
+			addr: "127.0.0.1:0",
+		},
+		{
+			name: "Listen on the localhost",
+			addr: "localhost:0",
+		},
+		{
+			name: "Listen on the unix socket",
+			addr: "unix:" + filepath.Join(ServeTestDir, "serve.sock"),
+		},
+		{
+			name: "Get error for all interfaces",
+			addr: ":0",
+			err:  ErrServeAddr,
+		},
+		{
+			name: "Get error for a non-loopback address",
+			addr: "0.0.0.0:0",
+			err:  ErrServeAddr,
+		},
+		{
+			name: "Get error for an address without port",
+			addr: "127.0.0.1",
+			err:  ErrServeAddr,
+		},
+	}
+
+	for _, c := range candidates {
+		fmt.Println("Running test case:", c.name)
+
+		ln, err := listen(c.addr)
+		s.EqualValues(c.err, errors.Cause(err))
+		if c.err != nil {
+			continue
+		}
+		s.NoError(ln.Close())
+	}
+
+	ln, err := listen("unix:" + filepath.Join(ServeTestDir, "serve.sock"))
+	s.NoError(err)
+	defer ln.Close()
+
+	info, err := os.Stat(filepath.Join(ServeTestDir, "serve.sock"))
+	s.NoError(err)
+	s.EqualValues(os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, &ServerSuite{})
+}
@@ -0,0 +1,169 @@
+package mirror
+
+import (
+	"fmt"
+	"github.com/petomalina/mirror/pkg/plugins"
+	"golang.org/x/tools/go/packages"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Qualifier returns the name the package is referred to by within
+// the generated code, or an empty string if the code is generated
+// into the package itself
+type Qualifier func(pkgPath, name string) string
+
+// QualifyFor returns the Qualifier for the code generated into the
+// package with the given import path
+func QualifyFor(pkgPath string) Qualifier {
+	return func(p, name string) string {
+		if p == pkgPath {
+			return ""
+		}
+
+		return name
+	}
+}
+
+// OutQualifier returns the Qualifier for the code written by the writer,
+// models are not qualified if the writer writes into their package
+func OutQualifier(out *Writer, pkg *packages.Package) Qualifier {
+	if sameDir(out.Dir(), plugins.PackageDir(pkg)) {
+		return QualifyFor(pkg.PkgPath)
+	}
+
+	return QualifyFor("")
+}
+
+// PackageName returns the name of the package of the model
+func (s *Struct) PackageName() string {
+	if s.OriginalPackageName != "" {
+		return s.OriginalPackageName
+	}
+
+	if s.Description != nil {
+		return path.Base(s.Description.PkgPath)
+	}
+
+	return strings.Split(reflect.TypeOf(s.Ref).Elem().String(), ".")[0]
+}
+
+// QualifiedName returns the name of the model as written in the generated code
+func (s *Struct) QualifiedName(q Qualifier) string {
+	if qual := q(s.PkgPath(), s.PackageName()); qual != "" {
+		return qual + "." + s.Name()
+	}
+
+	return s.Name()
+}
+
+// TypeString returns the type as written in the generated code, e.g. the type
+// of a field. Types declared by the model package refer to its OriginalPackage
+// instead of the package the model was loaded from
+func (s *Struct) TypeString(t reflect.Type, q Qualifier) string {
+	if t.Name() != "" {
+		pkgPath, name := s.typePackage(t)
+		if pkgPath == "" {
+			return t.Name()
+		}
+
+		if qual := q(pkgPath, name); qual != "" {
+			return qual + "." + t.Name()
+		}
+		return t.Name()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + s.TypeString(t.Elem(), q)
+	case reflect.Slice:
+		return "[]" + s.TypeString(t.Elem(), q)
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), s.TypeString(t.Elem(), q))
+	case reflect.Map:
+		return "map[" + s.TypeString(t.Key(), q) + "]" + s.TypeString(t.Elem(), q)
+	case reflect.Chan:
+		switch t.ChanDir() {
+		case reflect.RecvDir:
+			return "<-chan " + s.TypeString(t.Elem(), q)
+		case reflect.SendDir:
+			return "chan<- " + s.TypeString(t.Elem(), q)
+		}
+		return "chan " + s.TypeString(t.Elem(), q)
+	}
+
+	// unnamed structs, interfaces and functions are written as is
+	return t.String()
+}
+
+// TypeImports returns sorted import paths of the packages the type
+// refers to that need to be imported by the generated code
+func (s *Struct) TypeImports(t reflect.Type, q Qualifier) []string {
+	paths := map[string]bool{}
+	s.collectImports(t, q, paths)
+
+	imports := []string{}
+	for p := range paths {
+		imports = append(imports, p)
+	}
+	sort.Strings(imports)
+
+	return imports
+}
+
+func (s *Struct) collectImports(t reflect.Type, q Qualifier, paths map[string]bool) {
+	if t.Name() != "" {
+		pkgPath, name := s.typePackage(t)
+		if pkgPath != "" && q(pkgPath, name) != "" {
+			paths[pkgPath] = true
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Chan:
+		s.collectImports(t.Elem(), q, paths)
+	case reflect.Map:
+		s.collectImports(t.Key(), q, paths)
+		s.collectImports(t.Elem(), q, paths)
+	}
+}
+
+// typePackage returns the import path and the name of the package declaring
+// the named type, with the model package resolved to the original one
+func (s *Struct) typePackage(t reflect.Type) (string, string) {
+	if t.PkgPath() == "" {
+		return "", ""
+	}
+
+	if s.Ref != nil && t.PkgPath() == s.Type().PkgPath() {
+		return s.PkgPath(), s.PackageName()
+	}
+
+	return t.PkgPath(), strings.Split(t.String(), ".")[0]
+}
+
+// Type returns the named type of the Ref, skipping its pointers.
+// Nil is returned for described models
+func (s *Struct) Type() reflect.Type {
+	if s.Ref == nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(s.Ref)
+	for t.Kind() == reflect.Ptr && t.Name() == "" {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+
+	return errA == nil && errB == nil && absA == absB
+}